@@ -0,0 +1,258 @@
+package apperr
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/protoadapt"
+
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/money"
+)
+
+// Domain is the ErrorInfo domain attached to every domain error.
+const Domain = "ordercart.foodbuddy"
+
+// Kind classifies a domain error and decides its gRPC status code.
+type Kind int
+
+const (
+	KindNotFound Kind = iota + 1
+	KindInsufficientStock
+	KindRestaurantBanned
+	KindInvalidAddress
+	KindUnauthorized
+	KindConflict
+	KindInvalidArgument
+	KindFailedPrecondition
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindNotFound:
+		return "NOT_FOUND"
+	case KindInsufficientStock:
+		return "INSUFFICIENT_STOCK"
+	case KindRestaurantBanned:
+		return "RESTAURANT_BANNED"
+	case KindInvalidAddress:
+		return "INVALID_ADDRESS"
+	case KindUnauthorized:
+		return "UNAUTHORIZED"
+	case KindConflict:
+		return "CONFLICT"
+	case KindInvalidArgument:
+		return "INVALID_ARGUMENT"
+	case KindFailedPrecondition:
+		return "FAILED_PRECONDITION"
+	}
+	return "UNKNOWN"
+}
+
+// Code returns the gRPC status code for errors of kind k.
+func (k Kind) Code() codes.Code {
+	switch k {
+	case KindNotFound:
+		return codes.NotFound
+	case KindInsufficientStock, KindRestaurantBanned, KindFailedPrecondition:
+		return codes.FailedPrecondition
+	case KindInvalidAddress, KindInvalidArgument:
+		return codes.InvalidArgument
+	case KindUnauthorized:
+		return codes.PermissionDenied
+	case KindConflict:
+		return codes.Aborted
+	}
+	return codes.Unknown
+}
+
+// Error is a domain error. Its Details are attached to the gRPC status when
+// the error is returned from a handler.
+type Error struct {
+	Kind    Kind
+	Message string
+	// Reason is a machine readable reason reported in ErrorInfo. It defaults
+	// to the kind's name.
+	Reason   string
+	Metadata map[string]string
+	Details  []protoadapt.MessageV1
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) reason() string {
+	if e.Reason != "" {
+		return e.Reason
+	}
+	return e.Kind.String()
+}
+
+// ErrorInfo returns the ErrorInfo detail describing e.
+func (e *Error) ErrorInfo() *errdetails.ErrorInfo {
+	return &errdetails.ErrorInfo{
+		Reason:   e.reason(),
+		Domain:   Domain,
+		Metadata: e.Metadata,
+	}
+}
+
+// As returns the domain error in err's chain, if any.
+func As(err error) (*Error, bool) {
+	var e *Error
+	ok := errors.As(err, &e)
+	return e, ok
+}
+
+// IsKind reports whether err's chain contains a domain error of kind k.
+func IsKind(err error, k Kind) bool {
+	e, ok := As(err)
+	return ok && e.Kind == k
+}
+
+// NotFound reports that the resource of type resource with the given id does
+// not exist.
+func NotFound(resource, id string) *Error {
+	message := resource + " not found"
+	if id != "" {
+		message = fmt.Sprintf("%s %s not found", resource, id)
+	}
+	return &Error{
+		Kind:     KindNotFound,
+		Message:  message,
+		Metadata: map[string]string{"resourceType": resource, "resourceId": id},
+		Details: []protoadapt.MessageV1{&errdetails.ResourceInfo{
+			ResourceType: resource,
+			ResourceName: id,
+		}},
+	}
+}
+
+// InsufficientStock reports that a product has fewer units available than
+// were requested.
+func InsufficientStock(productID, productName string, available, requested int32) *Error {
+	return &Error{
+		Kind: KindInsufficientStock,
+		Message: fmt.Sprintf("insufficient stock for product %s: available %d, required %d",
+			productName, available, requested),
+		Metadata: map[string]string{
+			"productId": productID,
+			"available": strconv.Itoa(int(available)),
+			"requested": strconv.Itoa(int(requested)),
+		},
+		Details: []protoadapt.MessageV1{&errdetails.PreconditionFailure{
+			Violations: []*errdetails.PreconditionFailure_Violation{{
+				Type:        "STOCK",
+				Subject:     productID,
+				Description: fmt.Sprintf("only %d of %d requested units remain", available, requested),
+			}},
+		}},
+	}
+}
+
+// RestaurantBanned reports that a restaurant cannot take orders.
+func RestaurantBanned(restaurantID, reason string) *Error {
+	return &Error{
+		Kind:     KindRestaurantBanned,
+		Message:  fmt.Sprintf("restaurant is banned: %s", reason),
+		Metadata: map[string]string{"restaurantId": restaurantID, "banReason": reason},
+	}
+}
+
+// InvalidAddress reports that a delivery address failed validation.
+func InvalidAddress(addressID, reason string) *Error {
+	return &Error{
+		Kind:     KindInvalidAddress,
+		Message:  fmt.Sprintf("invalid delivery address: %s", reason),
+		Metadata: map[string]string{"addressId": addressID},
+		Details: []protoadapt.MessageV1{&errdetails.BadRequest{
+			FieldViolations: []*errdetails.BadRequest_FieldViolation{{
+				Field:       "deliveryAddressId",
+				Description: reason,
+			}},
+		}},
+	}
+}
+
+// Unauthorized reports that the caller may not act on a resource.
+func Unauthorized(message string) *Error {
+	return &Error{Kind: KindUnauthorized, Message: message}
+}
+
+// Conflict reports that a resource was changed concurrently or is in use.
+func Conflict(message string) *Error {
+	return &Error{Kind: KindConflict, Message: message}
+}
+
+// FailedPrecondition reports that the system is not in a state required for
+// the operation. reason is reported in ErrorInfo.
+func FailedPrecondition(reason, message string) *Error {
+	return &Error{Kind: KindFailedPrecondition, Reason: reason, Message: message}
+}
+
+// PriceChange is a product whose unit price differs from the price the cart
+// showed.
+type PriceChange struct {
+	ProductID   string
+	ProductName string
+	OldPrice    money.Money
+	NewPrice    money.Money
+}
+
+// PriceChanged reports that the prices of a cart changed since the user saw
+// them. expectedTotal and total are set when the client asked to be charged
+// a specific total and the order would cost a different one.
+func PriceChanged(changes []PriceChange, expectedTotal, total *money.Money) *Error {
+	failure := &errdetails.PreconditionFailure{}
+	for _, change := range changes {
+		failure.Violations = append(failure.Violations, &errdetails.PreconditionFailure_Violation{
+			Type:        "PRICE",
+			Subject:     change.ProductID,
+			Description: fmt.Sprintf("price of %s changed from %s to %s", change.ProductName, change.OldPrice, change.NewPrice),
+		})
+	}
+
+	e := &Error{
+		Kind:     KindFailedPrecondition,
+		Reason:   "PRICE_CHANGED",
+		Message:  fmt.Sprintf("prices changed for %d cart items, please review the cart", len(changes)),
+		Metadata: map[string]string{"changedItems": strconv.Itoa(len(changes))},
+	}
+	if expectedTotal != nil && total != nil {
+		e.Message = fmt.Sprintf("order total is %s, not the expected %s", total, expectedTotal)
+		e.Metadata["expectedTotal"] = expectedTotal.String()
+		e.Metadata["total"] = total.String()
+		failure.Violations = append(failure.Violations, &errdetails.PreconditionFailure_Violation{
+			Type:        "TOTAL",
+			Subject:     "order",
+			Description: e.Message,
+		})
+	}
+	e.Details = append(e.Details, failure)
+	return e
+}
+
+// FieldViolation describes one invalid request field.
+type FieldViolation struct {
+	Field       string
+	Description string
+}
+
+// InvalidArgument reports that request fields are invalid.
+func InvalidArgument(message string, violations ...FieldViolation) *Error {
+	e := &Error{Kind: KindInvalidArgument, Message: message}
+	if len(violations) > 0 {
+		badRequest := &errdetails.BadRequest{}
+		for _, v := range violations {
+			badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       v.Field,
+				Description: v.Description,
+			})
+		}
+		e.Details = append(e.Details, badRequest)
+	}
+	return e
+}
@@ -0,0 +1,51 @@
+package apperr
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+)
+
+// UnaryServerInterceptor converts the errors returned by handlers into gRPC
+// status errors. Domain errors get their kind's code and details, errors that
+// already carry a status keep its code, and anything else becomes Internal.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		if err != nil {
+			return resp, ToStatus(err).Err()
+		}
+		return resp, nil
+	}
+}
+
+// ToStatus converts err into a gRPC status as described on UnaryServerInterceptor.
+func ToStatus(err error) *status.Status {
+	if e, ok := As(err); ok {
+		st := status.New(e.Kind.Code(), err.Error())
+		details := append([]protoadapt.MessageV1{e.ErrorInfo()}, e.Details...)
+		withDetails, detailErr := st.WithDetails(details...)
+		if detailErr != nil {
+			log.Printf("Failed to attach error details: %v", detailErr)
+			return st
+		}
+		return withDetails
+	}
+
+	if st, ok := status.FromError(err); ok {
+		return st
+	}
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return status.New(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.New(codes.DeadlineExceeded, err.Error())
+	}
+	return status.New(codes.Internal, err.Error())
+}
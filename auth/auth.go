@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"context"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/apperr"
+)
+
+// Role is the kind of principal a token was issued to.
+type Role string
+
+const (
+	RoleUser       Role = "user"
+	RoleRestaurant Role = "restaurant"
+	RoleAdmin      Role = "admin"
+)
+
+// Identity is the authenticated caller of a request.
+type Identity struct {
+	Subject string
+	Role    Role
+}
+
+// Claims are the JWT claims issued by the User and Restaurant services. The
+// subject is taken from "sub", falling back to the role specific ID claim.
+type Claims struct {
+	Role         string `json:"role"`
+	UserID       string `json:"userId,omitempty"`
+	RestaurantID string `json:"restaurantId,omitempty"`
+	jwt.RegisteredClaims
+}
+
+type identityKey struct{}
+
+// NewContext returns a copy of ctx carrying id.
+func NewContext(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// FromContext returns the identity stored in ctx by the interceptor.
+func FromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(Identity)
+	return id, ok
+}
+
+// healthService is the gRPC health checking service, which load balancers and
+// orchestrators call without credentials.
+const healthService = "/grpc.health.v1.Health/"
+
+// UnaryServerInterceptor authenticates every call with the HS256 bearer token
+// in the "authorization" metadata and stores the caller's identity in the
+// request context. Calls without a valid token fail with Unauthenticated.
+// Health checks are not authenticated.
+func UnaryServerInterceptor(secret []byte) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if strings.HasPrefix(info.FullMethod, healthService) {
+			return handler(ctx, req)
+		}
+		id, err := authenticate(ctx, secret)
+		if err != nil {
+			return nil, err
+		}
+		return handler(NewContext(ctx, id), req)
+	}
+}
+
+func authenticate(ctx context.Context, secret []byte) (Identity, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return Identity{}, status.Error(codes.Unauthenticated, "missing authorization token")
+	}
+
+	tokenString, ok := strings.CutPrefix(values[0], "Bearer ")
+	if !ok {
+		return Identity{}, status.Error(codes.Unauthenticated, "authorization must be a bearer token")
+	}
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(strings.TrimSpace(tokenString), claims, func(token *jwt.Token) (interface{}, error) {
+		return secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return Identity{}, status.Errorf(codes.Unauthenticated, "invalid token: %v", err)
+	}
+
+	id := Identity{Subject: claims.Subject, Role: Role(strings.ToLower(claims.Role))}
+	switch id.Role {
+	case RoleUser:
+		if id.Subject == "" {
+			id.Subject = claims.UserID
+		}
+	case RoleRestaurant:
+		if id.Subject == "" {
+			id.Subject = claims.RestaurantID
+		}
+	case RoleAdmin:
+	default:
+		return Identity{}, status.Errorf(codes.Unauthenticated, "invalid token: unknown role %q", claims.Role)
+	}
+	if id.Subject == "" {
+		return Identity{}, status.Error(codes.Unauthenticated, "invalid token: missing subject")
+	}
+	return id, nil
+}
+
+// RequireUser allows the call if the caller is the user userID or an admin.
+func RequireUser(ctx context.Context, userID string) error {
+	return require(ctx, RoleUser, userID)
+}
+
+// RequireRestaurant allows the call if the caller is the restaurant
+// restaurantID or an admin.
+func RequireRestaurant(ctx context.Context, restaurantID string) error {
+	return require(ctx, RoleRestaurant, restaurantID)
+}
+
+// RequireOrderParty allows the call if the caller is the user who placed the
+// order, the restaurant it was placed with, or an admin.
+func RequireOrderParty(ctx context.Context, userID, restaurantID string) error {
+	if RequireUser(ctx, userID) == nil {
+		return nil
+	}
+	return RequireRestaurant(ctx, restaurantID)
+}
+
+// RequireAdmin allows the call only if the caller is an admin.
+func RequireAdmin(ctx context.Context) error {
+	return require(ctx, RoleAdmin, "")
+}
+
+func require(ctx context.Context, role Role, subject string) error {
+	id, ok := FromContext(ctx)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "request is not authenticated")
+	}
+	if id.Role == RoleAdmin || (id.Role == role && subject != "" && id.Subject == subject) {
+		return nil
+	}
+	return apperr.Unauthorized("caller is not allowed to act on this resource")
+}
@@ -1,28 +1,117 @@
 package clients
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net"
+	"time"
 
 	restaurantPb "github.com/liju-github/CentralisedFoodbuddyMicroserviceProto/Restaurant"
 	userPb "github.com/liju-github/CentralisedFoodbuddyMicroserviceProto/User"
 	config "github.com/liju-github/FoodBuddyMicroserviceOrderCart/configs"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
 )
 
-func NewRestaurantClient() (restaurantPb.RestaurantServiceClient, error) {
-	conn, err := grpc.NewClient("localhost:"+config.LoadConfig().RESTAURANTGRPCPORT, grpc.WithTransportCredentials(insecure.NewCredentials()))
+// RestaurantClient is the part of RestaurantService used by this service.
+type RestaurantClient interface {
+	GetRestaurantByID(ctx context.Context, in *restaurantPb.GetRestaurantByIDRequest, opts ...grpc.CallOption) (*restaurantPb.GetRestaurantByIDResponse, error)
+	CheckRestaurantBanStatus(ctx context.Context, in *restaurantPb.CheckRestaurantBanStatusRequest, opts ...grpc.CallOption) (*restaurantPb.CheckRestaurantBanStatusResponse, error)
+	GetProductByID(ctx context.Context, in *restaurantPb.GetProductByIDRequest, opts ...grpc.CallOption) (*restaurantPb.GetProductByIDResponse, error)
+	DecrementProductStockByValue(ctx context.Context, in *restaurantPb.DecrementProductStockByValueByValueRequest, opts ...grpc.CallOption) (*restaurantPb.DecrementProductStockByValueResponse, error)
+	IncremenentProductStockByValue(ctx context.Context, in *restaurantPb.IncremenentProductStockByValueRequest, opts ...grpc.CallOption) (*restaurantPb.IncremenentProductStockByValueResponse, error)
+	GetRestaurantProductsByID(ctx context.Context, in *restaurantPb.GetRestaurantProductsByIDRequest, opts ...grpc.CallOption) (*restaurantPb.GetRestaurantProductsByIDResponse, error)
+}
+
+// UserClient is the part of UserService used by this service.
+type UserClient interface {
+	ValidateUserAddress(ctx context.Context, in *userPb.ValidateUserAddressRequest, opts ...grpc.CallOption) (*userPb.ValidateUserAddressResponse, error)
+}
+
+// Clients holds the long-lived connections to the services OrderCart depends
+// on. It is created once at startup and shared by all requests.
+type Clients struct {
+	Restaurant RestaurantClient
+	User       UserClient
+
+	// Breakers guard the calls to each dependency.
+	RestaurantBreaker *CircuitBreaker
+	UserBreaker       *CircuitBreaker
+
+	conns []*grpc.ClientConn
+}
+
+const (
+	breakerFailureThreshold = 5
+	breakerOpenTimeout      = 30 * time.Second
+)
+
+// keepaliveParams pings idle connections with active calls so dead peers are
+// detected. The interval matches the gRPC server's default minimum so the
+// peers do not reject the pings.
+var keepaliveParams = keepalive.ClientParameters{
+	Time:    5 * time.Minute,
+	Timeout: 20 * time.Second,
+}
+
+// New dials the Restaurant and User services using the hosts and ports in cfg.
+// Connections are established lazily on the first call. Calls are bounded by
+// per-method timeouts, idempotent reads are retried and each dependency is
+// guarded by a circuit breaker.
+func New(cfg config.Config) (*Clients, error) {
+	restaurantBreaker := NewCircuitBreaker("RestaurantService", breakerFailureThreshold, breakerOpenTimeout)
+	restaurantConn, err := dial(net.JoinHostPort(cfg.RESTAURANTGRPCHOST, cfg.RESTAURANTGRPCPORT),
+		restaurantPolicy(cfg.ClientCallTimeout), restaurantBreaker)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to RestaurantService: %w", err)
 	}
-	return restaurantPb.NewRestaurantServiceClient(conn), nil
-}
 
-func NewUserClient() (userPb.UserServiceClient, error) {
-	conn, err := grpc.NewClient("localhost:"+config.LoadConfig().USERGRPCPORT, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	userBreaker := NewCircuitBreaker("UserService", breakerFailureThreshold, breakerOpenTimeout)
+	userConn, err := dial(net.JoinHostPort(cfg.USERGRPCHOST, cfg.USERGRPCPORT),
+		userPolicy(cfg.ClientCallTimeout), userBreaker)
 	if err != nil {
+		restaurantConn.Close()
 		return nil, fmt.Errorf("failed to connect to UserService: %w", err)
 	}
-	return userPb.NewUserServiceClient(conn), nil
 
+	return &Clients{
+		Restaurant:        restaurantPb.NewRestaurantServiceClient(restaurantConn),
+		User:              userPb.NewUserServiceClient(userConn),
+		RestaurantBreaker: restaurantBreaker,
+		UserBreaker:       userBreaker,
+		conns:             []*grpc.ClientConn{restaurantConn, userConn},
+	}, nil
+}
+
+// BreakerStates returns the circuit breaker state of every dependency.
+func (c *Clients) BreakerStates() map[string]BreakerState {
+	return map[string]BreakerState{
+		c.RestaurantBreaker.name: c.RestaurantBreaker.State(),
+		c.UserBreaker.name:       c.UserBreaker.State(),
+	}
+}
+
+// Close closes all connections.
+func (c *Clients) Close() error {
+	var errs []error
+	for _, conn := range c.conns {
+		if err := conn.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func dial(target string, policy Policy, breaker *CircuitBreaker) (*grpc.ClientConn, error) {
+	return grpc.NewClient(target,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithKeepaliveParams(keepaliveParams),
+		grpc.WithChainUnaryInterceptor(
+			retryInterceptor(policy),
+			breaker.interceptor(),
+			timeoutInterceptor(policy),
+		),
+	)
 }
@@ -0,0 +1,38 @@
+package clients
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// ReportHealth publishes the health of every dependency on server every
+// interval until ctx is cancelled. Each dependency is reported under its
+// service name, e.g. "RestaurantService", and is NOT_SERVING while its
+// circuit breaker is not closed.
+func (c *Clients) ReportHealth(ctx context.Context, server *health.Server, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		c.reportHealth(server)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Clients) reportHealth(server *health.Server) {
+	for name, state := range c.BreakerStates() {
+		status := healthpb.HealthCheckResponse_SERVING
+		if state != BreakerClosed {
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+		server.SetServingStatus(name, status)
+	}
+}
@@ -0,0 +1,38 @@
+package clients
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+func TestReportHealth(t *testing.T) {
+	c := &Clients{
+		RestaurantBreaker: NewCircuitBreaker("RestaurantService", 1, time.Hour),
+		UserBreaker:       NewCircuitBreaker("UserService", 1, time.Hour),
+	}
+	call(c.RestaurantBreaker, status.Error(codes.Unavailable, "down"))
+
+	server := health.NewServer()
+	c.reportHealth(server)
+
+	want := map[string]healthpb.HealthCheckResponse_ServingStatus{
+		"":                  healthpb.HealthCheckResponse_SERVING,
+		"RestaurantService": healthpb.HealthCheckResponse_NOT_SERVING,
+		"UserService":       healthpb.HealthCheckResponse_SERVING,
+	}
+	for service, wantStatus := range want {
+		resp, err := server.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+		if err != nil {
+			t.Fatalf("Check(%q): %v", service, err)
+		}
+		if resp.Status != wantStatus {
+			t.Errorf("Check(%q) = %s, want %s", service, resp.Status, wantStatus)
+		}
+	}
+}
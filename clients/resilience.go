@@ -0,0 +1,310 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	restaurantPb "github.com/liju-github/CentralisedFoodbuddyMicroserviceProto/Restaurant"
+	userPb "github.com/liju-github/CentralisedFoodbuddyMicroserviceProto/User"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Policy controls how calls to one dependency are bounded and retried.
+type Policy struct {
+	// DefaultTimeout bounds each attempt of methods without an entry in Timeouts.
+	DefaultTimeout time.Duration
+	// Timeouts overrides the per-attempt timeout of individual methods.
+	Timeouts map[string]time.Duration
+	// Retryable lists the idempotent methods that may be retried.
+	Retryable map[string]bool
+	// MaxAttempts is the total number of attempts for retryable methods.
+	MaxAttempts int
+	// BaseBackoff is the delay before the first retry; it doubles up to MaxBackoff.
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+}
+
+func restaurantPolicy(defaultTimeout time.Duration) Policy {
+	return Policy{
+		DefaultTimeout: defaultTimeout,
+		Timeouts: map[string]time.Duration{
+			restaurantPb.RestaurantService_GetRestaurantByID_FullMethodName:         2 * time.Second,
+			restaurantPb.RestaurantService_CheckRestaurantBanStatus_FullMethodName:  2 * time.Second,
+			restaurantPb.RestaurantService_GetProductByID_FullMethodName:            2 * time.Second,
+			restaurantPb.RestaurantService_GetRestaurantProductsByID_FullMethodName: 3 * time.Second,
+		},
+		Retryable: map[string]bool{
+			restaurantPb.RestaurantService_GetRestaurantByID_FullMethodName:         true,
+			restaurantPb.RestaurantService_CheckRestaurantBanStatus_FullMethodName:  true,
+			restaurantPb.RestaurantService_GetProductByID_FullMethodName:            true,
+			restaurantPb.RestaurantService_GetRestaurantProductsByID_FullMethodName: true,
+		},
+		MaxAttempts: 3,
+		BaseBackoff: 100 * time.Millisecond,
+		MaxBackoff:  time.Second,
+	}
+}
+
+func userPolicy(defaultTimeout time.Duration) Policy {
+	return Policy{
+		DefaultTimeout: defaultTimeout,
+		Timeouts: map[string]time.Duration{
+			userPb.UserService_ValidateUserAddress_FullMethodName: 2 * time.Second,
+		},
+		Retryable: map[string]bool{
+			userPb.UserService_ValidateUserAddress_FullMethodName: true,
+		},
+		MaxAttempts: 3,
+		BaseBackoff: 100 * time.Millisecond,
+		MaxBackoff:  time.Second,
+	}
+}
+
+// retryInterceptor retries retryable methods on transient errors with
+// exponential backoff. It is the outermost interceptor so that every attempt
+// passes through the circuit breaker and gets its own timeout.
+func retryInterceptor(policy Policy) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if !policy.Retryable[method] || policy.MaxAttempts <= 1 {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		delay := policy.BaseBackoff
+		var err error
+		for attempt := 1; ; attempt++ {
+			err = invoker(ctx, method, req, reply, cc, opts...)
+			if err == nil || attempt >= policy.MaxAttempts || !retryable(err) || ctx.Err() != nil {
+				return err
+			}
+
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(delay):
+			}
+			delay *= 2
+			if delay > policy.MaxBackoff {
+				delay = policy.MaxBackoff
+			}
+		}
+	}
+}
+
+// timeoutInterceptor bounds each attempt by the method's timeout unless the
+// caller's context already carries an earlier deadline.
+func timeoutInterceptor(policy Policy) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		timeout, ok := policy.Timeouts[method]
+		if !ok {
+			timeout = policy.DefaultTimeout
+		}
+		if timeout <= 0 {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= timeout {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// retryable reports whether err is a transient failure worth retrying.
+func retryable(err error) bool {
+	if isBreakerOpen(err) {
+		return false
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted:
+		return true
+	}
+	return false
+}
+
+// BreakerState is the state of a CircuitBreaker.
+type BreakerState int
+
+const (
+	// BreakerClosed lets all calls through.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen rejects all calls until the open timeout elapses.
+	BreakerOpen
+	// BreakerHalfOpen lets a single trial call through to probe the dependency.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// CircuitBreaker stops calling a dependency after FailureThreshold consecutive
+// failures, failing fast with Unavailable until OpenTimeout has passed and a
+// trial call succeeds. Calls abandoned by their caller say nothing about the
+// dependency and are not counted.
+type CircuitBreaker struct {
+	name             string
+	failureThreshold int
+	openTimeout      time.Duration
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+	// generation changes with every state change, so the outcome of a call
+	// admitted before it is ignored
+	generation uint64
+}
+
+// breakerTicket identifies a call admitted by a CircuitBreaker.
+type breakerTicket struct {
+	generation uint64
+	probe      bool
+}
+
+func NewCircuitBreaker(name string, failureThreshold int, openTimeout time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		name:             name,
+		failureThreshold: failureThreshold,
+		openTimeout:      openTimeout,
+	}
+}
+
+// State returns the current state of the breaker.
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.openTimeout {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+// allow reports whether a call may proceed, moving an expired open breaker to
+// half-open and admitting one trial call. The ticket of an admitted call is
+// passed to record with its outcome.
+func (b *CircuitBreaker) allow() (breakerTicket, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.openTimeout {
+			return breakerTicket{}, false
+		}
+		b.setState(BreakerHalfOpen)
+		b.probing = true
+		return breakerTicket{generation: b.generation, probe: true}, true
+	case BreakerHalfOpen:
+		if b.probing {
+			return breakerTicket{}, false
+		}
+		b.probing = true
+		return breakerTicket{generation: b.generation, probe: true}, true
+	}
+	return breakerTicket{generation: b.generation}, true
+}
+
+// record updates the breaker with the outcome of a call it allowed. Outcomes
+// of calls admitted before the last state change are ignored, and so are
+// calls the caller abandoned, except that an abandoned probe lets the next
+// call probe instead.
+func (b *CircuitBreaker) record(ticket breakerTicket, err error, abandoned bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ticket.generation != b.generation {
+		return
+	}
+	if ticket.probe {
+		b.probing = false
+	}
+	if abandoned {
+		return
+	}
+	if !countsAsFailure(err) {
+		b.failures = 0
+		b.setState(BreakerClosed)
+		return
+	}
+
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.failureThreshold {
+		b.openedAt = time.Now()
+		b.setState(BreakerOpen)
+	}
+}
+
+func (b *CircuitBreaker) setState(state BreakerState) {
+	if b.state != state {
+		log.Printf("Circuit breaker for %s is now %s", b.name, state)
+		b.state = state
+		b.generation++
+	}
+}
+
+// interceptor rejects calls with Unavailable while the breaker is open.
+func (b *CircuitBreaker) interceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ticket, ok := b.allow()
+		if !ok {
+			return &breakerOpenError{name: b.name}
+		}
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		b.record(ticket, err, callerAbandoned(ctx, err))
+		return err
+	}
+}
+
+// callerAbandoned reports whether a call failed because its caller cancelled
+// it or let its own deadline pass, rather than because of the dependency.
+func callerAbandoned(ctx context.Context, err error) bool {
+	switch status.Code(err) {
+	case codes.Canceled, codes.DeadlineExceeded:
+		return ctx.Err() != nil
+	}
+	return false
+}
+
+// breakerOpenError is returned for calls rejected by an open breaker. It
+// converts to an Unavailable gRPC status.
+type breakerOpenError struct {
+	name string
+}
+
+func (e *breakerOpenError) Error() string {
+	return e.name + " is unavailable: circuit breaker open"
+}
+
+func (e *breakerOpenError) GRPCStatus() *status.Status {
+	return status.New(codes.Unavailable, e.Error())
+}
+
+func isBreakerOpen(err error) bool {
+	var openErr *breakerOpenError
+	return errors.As(err, &openErr)
+}
+
+// countsAsFailure reports whether err indicates the dependency is unhealthy,
+// as opposed to rejecting a particular request.
+func countsAsFailure(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Internal:
+		return true
+	}
+	return false
+}
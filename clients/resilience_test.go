@@ -0,0 +1,175 @@
+package clients
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// call sends one call through the breaker's interceptor to a dependency that
+// answers with err, reporting whether the dependency was reached.
+func call(b *CircuitBreaker, err error) (reached bool, got error) {
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		reached = true
+		return err
+	}
+	got = b.interceptor()(context.Background(), "/test/Method", nil, nil, nil, invoker)
+	return reached, got
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	unavailable := status.Error(codes.Unavailable, "down")
+	notFound := status.Error(codes.NotFound, "no such product")
+	const openTimeout = 20 * time.Millisecond
+
+	tests := []struct {
+		name      string
+		failures  []error
+		waitOpen  bool
+		probe     error
+		wantState BreakerState
+	}{
+		{
+			name:      "stays closed below the threshold",
+			failures:  []error{unavailable, unavailable},
+			wantState: BreakerClosed,
+		},
+		{
+			name:      "request errors do not count",
+			failures:  []error{notFound, notFound, notFound, notFound},
+			wantState: BreakerClosed,
+		},
+		{
+			name:      "a success resets the failure count",
+			failures:  []error{unavailable, unavailable, nil, unavailable, unavailable},
+			wantState: BreakerClosed,
+		},
+		{
+			name:      "opens at the threshold",
+			failures:  []error{unavailable, unavailable, unavailable},
+			wantState: BreakerOpen,
+		},
+		{
+			name:      "closes after a successful probe",
+			failures:  []error{unavailable, unavailable, unavailable},
+			waitOpen:  true,
+			probe:     nil,
+			wantState: BreakerClosed,
+		},
+		{
+			name:      "reopens after a failed probe",
+			failures:  []error{unavailable, unavailable, unavailable},
+			waitOpen:  true,
+			probe:     status.Error(codes.DeadlineExceeded, "slow"),
+			wantState: BreakerOpen,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewCircuitBreaker("test", 3, openTimeout)
+			for _, err := range tt.failures {
+				call(b, err)
+			}
+			if tt.waitOpen {
+				time.Sleep(openTimeout)
+				if state := b.State(); state != BreakerHalfOpen {
+					t.Fatalf("State() after open timeout = %s, want half-open", state)
+				}
+				if reached, _ := call(b, tt.probe); !reached {
+					t.Fatal("probe was rejected")
+				}
+			}
+			if state := b.State(); state != tt.wantState {
+				t.Errorf("State() = %s, want %s", state, tt.wantState)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerOpenRejects(t *testing.T) {
+	b := NewCircuitBreaker("test", 1, time.Hour)
+	call(b, status.Error(codes.Unavailable, "down"))
+
+	reached, err := call(b, nil)
+	if reached {
+		t.Fatal("open breaker let a call through")
+	}
+	if status.Code(err) != codes.Unavailable || !isBreakerOpen(err) {
+		t.Errorf("open breaker returned %v, want Unavailable breaker error", err)
+	}
+	if retryable(err) {
+		t.Error("breaker rejection is retryable")
+	}
+}
+
+func TestCircuitBreakerHalfOpenSingleProbe(t *testing.T) {
+	b := NewCircuitBreaker("test", 1, time.Millisecond)
+	call(b, status.Error(codes.Unavailable, "down"))
+	time.Sleep(time.Millisecond)
+
+	// While the probe is in flight every other call fails fast
+	probe, ok := b.allow()
+	if !ok {
+		t.Fatal("half-open breaker rejected the probe")
+	}
+	if _, ok := b.allow(); ok {
+		t.Fatal("half-open breaker admitted a second call during the probe")
+	}
+	b.record(probe, nil, false)
+
+	if _, ok := b.allow(); !ok {
+		t.Error("breaker rejected a call after a successful probe")
+	}
+}
+
+func TestCircuitBreakerIgnoresAbandonedCalls(t *testing.T) {
+	b := NewCircuitBreaker("test", 1, time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return status.FromContextError(ctx.Err()).Err()
+	}
+
+	b.interceptor()(ctx, "/test/Method", nil, nil, nil, invoker)
+	if state := b.State(); state != BreakerClosed {
+		t.Errorf("State() after a cancelled call = %s, want closed", state)
+	}
+}
+
+func TestCircuitBreakerAbandonedProbe(t *testing.T) {
+	b := NewCircuitBreaker("test", 1, time.Millisecond)
+	call(b, status.Error(codes.Unavailable, "down"))
+	time.Sleep(time.Millisecond)
+
+	probe, _ := b.allow()
+	b.record(probe, status.Error(codes.Canceled, "caller went away"), true)
+	if _, ok := b.allow(); !ok {
+		t.Error("breaker rejected a new probe after the previous one was abandoned")
+	}
+}
+
+// TestCircuitBreakerLateOutcome checks that a call admitted before the breaker
+// opened cannot close it or free the half-open probe when it finishes late.
+func TestCircuitBreakerLateOutcome(t *testing.T) {
+	b := NewCircuitBreaker("test", 1, time.Millisecond)
+	slow, _ := b.allow()
+	call(b, status.Error(codes.Unavailable, "down"))
+	time.Sleep(time.Millisecond)
+
+	if _, ok := b.allow(); !ok {
+		t.Fatal("half-open breaker rejected the probe")
+	}
+	b.record(slow, nil, false)
+
+	if state := b.State(); state != BreakerHalfOpen {
+		t.Errorf("State() after a late success = %s, want half-open", state)
+	}
+	if _, ok := b.allow(); ok {
+		t.Error("late outcome freed the half-open probe")
+	}
+}
@@ -1,17 +1,34 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 
 	orderCartPb "github.com/liju-github/CentralisedFoodbuddyMicroserviceProto/OrderCart"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/apperr"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/auth"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/clients"
 	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/configs"
 	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/db"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/notify"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/outbox"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/payments"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/pricing"
 	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/repository"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/scheduler"
 	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/service"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/sweeper"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/validation"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/watchdog"
 )
 
 func main() {
@@ -30,11 +47,96 @@ func main() {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 
+	// Connect to dependent services
+	serviceClients, err := clients.New(config)
+	if err != nil {
+		log.Fatalf("Failed to create service clients: %v", err)
+	}
+	defer serviceClients.Close()
+
 	// Initialize repository
 	repo := repository.NewOrderCartRepository(dbConn)
 
+	// Pricing rules for taxes, packaging and delivery
+	pricingRules, err := pricing.ParseRules(config.TaxRates, config.PackagingFee, config.DeliveryFee, config.DeliveryBands)
+	if err != nil {
+		log.Fatalf("Invalid pricing configuration: %v", err)
+	}
+
+	// Payment provider; only the built-in fake gateway is available so far. It
+	// charges no one, so it must be chosen explicitly
+	switch config.PaymentProvider {
+	case "":
+		log.Fatalf("PAYMENTPROVIDER must be set")
+	case payments.FakeProviderName:
+		log.Printf("Using the fake payment gateway: online payments are not charged")
+	default:
+		log.Fatalf("Unknown payment provider %q", config.PaymentProvider)
+	}
+	fakeOutcome, err := payments.ParseOutcome(config.FakePaymentOutcome)
+	if err != nil {
+		log.Fatalf("Invalid payment configuration: %v", err)
+	}
+	paymentProvider := payments.WithTimeout(payments.NewFake(fakeOutcome), config.PaymentTimeout)
+
+	// Acceptance windows after which unconfirmed orders are cancelled
+	acceptanceOverrides, err := watchdog.ParseOverrides(config.AcceptanceOverrides)
+	if err != nil {
+		log.Fatalf("Invalid acceptance window configuration: %v", err)
+	}
+
 	// Initialize service
-	svc := service.NewOrderCartService(repo)
+	schedulePolicy := scheduler.Policy{
+		LeadTime:   config.ScheduleLeadTime,
+		MaxAdvance: config.ScheduleMaxAdvance,
+		DeferStock: config.DeferScheduledStock,
+	}
+	svc := service.NewOrderCartService(repo, serviceClients.Restaurant, serviceClients.User, pricing.NewEngine(pricingRules), schedulePolicy, paymentProvider)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Perform stock reservations and releases, payment operations and user
+	// notifications recorded in the outbox; notifications are only logged
+	// until a notification service is available
+	dispatcher := outbox.NewDispatcher(repo, serviceClients.Restaurant, paymentProvider, notify.NewLog())
+	dispatcherDone := make(chan struct{})
+	go func() {
+		defer close(dispatcherDone)
+		dispatcher.Run(ctx)
+	}()
+
+	// Remove carts idle for longer than the cart TTL
+	cartSweeper := sweeper.NewCartSweeper(repo, config.CartTTL, config.CartSweepInterval, config.ArchiveStaleCarts)
+	sweeperDone := make(chan struct{})
+	go func() {
+		defer close(sweeperDone)
+		cartSweeper.Run(ctx)
+	}()
+
+	// Fail orders whose payment authorization never completed
+	paymentSweeper := sweeper.NewPaymentSweeper(repo, config.PaymentPendingTTL, config.PaymentSweepInterval)
+	paymentSweeperDone := make(chan struct{})
+	go func() {
+		defer close(paymentSweeperDone)
+		paymentSweeper.Run(ctx)
+	}()
+
+	// Release scheduled orders to restaurants ahead of their delivery slot
+	orderScheduler := scheduler.NewScheduler(repo, config.ScheduleLeadTime, config.SchedulerInterval)
+	schedulerDone := make(chan struct{})
+	go func() {
+		defer close(schedulerDone)
+		orderScheduler.Run(ctx)
+	}()
+
+	// Cancel pending orders their restaurant does not accept in time
+	acceptanceWatchdog := watchdog.NewWatchdog(repo, config.AcceptanceWindow, acceptanceOverrides, config.AcceptanceInterval)
+	watchdogDone := make(chan struct{})
+	go func() {
+		defer close(watchdogDone)
+		acceptanceWatchdog.Run(ctx)
+	}()
 
 	// Initialize gRPC server
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", config.ORDERCARTGRPCPORT))
@@ -42,11 +144,48 @@ func main() {
 		log.Fatalf("Failed to listen: %v", err)
 	}
 
-	grpcServer := grpc.NewServer()
+	// Map domain errors to gRPC statuses, authenticate every call with the
+	// bearer JWT issued by the User and Restaurant services and validate requests
+	if config.JWTSecretKey == "" {
+		log.Fatalf("JWTSECRET must be set")
+	}
+	grpcServer := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(
+			apperr.UnaryServerInterceptor(),
+			auth.UnaryServerInterceptor([]byte(config.JWTSecretKey)),
+			validation.UnaryServerInterceptor(),
+		),
+	)
 	orderCartPb.RegisterOrderCartServiceServer(grpcServer, svc)
+	// RPCs not yet in the shared proto are served by the extension service
+	grpcServer.RegisterService(&service.ExtensionServiceDesc, svc)
+
+	// Report the health of the Restaurant and User services, as seen by
+	// their circuit breakers, through the standard health service
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+	healthDone := make(chan struct{})
+	go func() {
+		defer close(healthDone)
+		serviceClients.ReportHealth(ctx, healthServer, config.HealthInterval)
+	}()
+
+	go func() {
+		<-ctx.Done()
+		log.Printf("Shutting down OrderCart gRPC server")
+		grpcServer.GracefulStop()
+	}()
 
 	log.Printf("Starting OrderCart gRPC server on port %s", config.ORDERCARTGRPCPORT)
 	if err := grpcServer.Serve(lis); err != nil {
 		log.Fatalf("Failed to serve: %v", err)
 	}
+
+	stop()
+	<-dispatcherDone
+	<-sweeperDone
+	<-paymentSweeperDone
+	<-schedulerDone
+	<-watchdogDone
+	<-healthDone
 }
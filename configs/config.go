@@ -3,20 +3,45 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	DBUser       string
-	DBPassword   string
-	DBName       string
-	DBHost       string
-	DBPort       string
-	ORDERCARTGRPCPORT string
-	RESTAURANTGRPCPORT string
-	USERGRPCPORT string
-	JWTSecretKey string
+	DBUser               string
+	DBPassword           string
+	DBName               string
+	DBHost               string
+	DBPort               string
+	ORDERCARTGRPCPORT    string
+	RESTAURANTGRPCHOST   string
+	RESTAURANTGRPCPORT   string
+	USERGRPCHOST         string
+	USERGRPCPORT         string
+	JWTSecretKey         string
+	ClientCallTimeout    time.Duration
+	TaxRates             string
+	PackagingFee         string
+	DeliveryFee          string
+	DeliveryBands        string
+	CartTTL              time.Duration
+	CartSweepInterval    time.Duration
+	ArchiveStaleCarts    bool
+	ScheduleLeadTime     time.Duration
+	ScheduleMaxAdvance   time.Duration
+	DeferScheduledStock  bool
+	SchedulerInterval    time.Duration
+	PaymentProvider      string
+	FakePaymentOutcome   string
+	PaymentTimeout       time.Duration
+	PaymentPendingTTL    time.Duration
+	PaymentSweepInterval time.Duration
+	AcceptanceWindow     time.Duration
+	AcceptanceOverrides  string
+	AcceptanceInterval   time.Duration
+	HealthInterval       time.Duration
 }
 
 func LoadConfig() Config {
@@ -25,14 +50,74 @@ func LoadConfig() Config {
 	}
 
 	return Config{
-		DBUser:       os.Getenv("DBUSER"),
-		DBPassword:   os.Getenv("DBPASSWORD"),
-		DBName:       os.Getenv("DBNAME"),
-		DBHost:       os.Getenv("DBHOST"),
-		DBPort:       os.Getenv("DBPORT"),
-		ORDERCARTGRPCPORT: os.Getenv("ORDERCARTGRPCPORT"),
-		RESTAURANTGRPCPORT: os.Getenv("RESTAURANTGRPCPORT"),
-		USERGRPCPORT: os.Getenv("USERGRPCPORT"),
-		JWTSecretKey: os.Getenv("JWTSECRET"),
+		DBUser:               os.Getenv("DBUSER"),
+		DBPassword:           os.Getenv("DBPASSWORD"),
+		DBName:               os.Getenv("DBNAME"),
+		DBHost:               os.Getenv("DBHOST"),
+		DBPort:               os.Getenv("DBPORT"),
+		ORDERCARTGRPCPORT:    os.Getenv("ORDERCARTGRPCPORT"),
+		RESTAURANTGRPCHOST:   getEnv("RESTAURANTGRPCHOST", "localhost"),
+		RESTAURANTGRPCPORT:   os.Getenv("RESTAURANTGRPCPORT"),
+		USERGRPCHOST:         getEnv("USERGRPCHOST", "localhost"),
+		USERGRPCPORT:         os.Getenv("USERGRPCPORT"),
+		JWTSecretKey:         os.Getenv("JWTSECRET"),
+		ClientCallTimeout:    getDuration("CLIENTCALLTIMEOUT", 5*time.Second),
+		TaxRates:             getEnv("TAXRATES", "default:5"),
+		PackagingFee:         os.Getenv("PACKAGINGFEE"),
+		DeliveryFee:          os.Getenv("DELIVERYFEE"),
+		DeliveryBands:        os.Getenv("DELIVERYBANDS"),
+		CartTTL:              getDuration("CARTTTL", 30*24*time.Hour),
+		CartSweepInterval:    getDuration("CARTSWEEPINTERVAL", time.Hour),
+		ArchiveStaleCarts:    getBool("ARCHIVESTALECARTS", true),
+		ScheduleLeadTime:     getDuration("SCHEDULELEADTIME", 45*time.Minute),
+		ScheduleMaxAdvance:   getDuration("SCHEDULEMAXADVANCE", 7*24*time.Hour),
+		DeferScheduledStock:  getBool("DEFERSCHEDULEDSTOCK", false),
+		SchedulerInterval:    getDuration("SCHEDULERINTERVAL", time.Minute),
+		PaymentProvider:      os.Getenv("PAYMENTPROVIDER"),
+		FakePaymentOutcome:   getEnv("FAKEPAYMENTOUTCOME", "succeed"),
+		PaymentTimeout:       getDuration("PAYMENTTIMEOUT", 10*time.Second),
+		PaymentPendingTTL:    getDuration("PAYMENTPENDINGTTL", 15*time.Minute),
+		PaymentSweepInterval: getDuration("PAYMENTSWEEPINTERVAL", time.Minute),
+		AcceptanceWindow:     getDuration("ACCEPTANCEWINDOW", 15*time.Minute),
+		AcceptanceOverrides:  os.Getenv("ACCEPTANCEWINDOWOVERRIDES"),
+		AcceptanceInterval:   getDuration("ACCEPTANCEINTERVAL", time.Minute),
+		HealthInterval:       getDuration("HEALTHINTERVAL", 5*time.Second),
 	}
 }
+
+// getEnv returns the value of the environment variable key, or fallback if it
+// is unset or empty.
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// getDuration parses the environment variable key as a time.Duration such as
+// "5s", returning fallback if it is unset and exiting if it is malformed.
+func getDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("Invalid duration for %s: %v", key, err)
+	}
+	return d
+}
+
+// getBool parses the environment variable key as a boolean such as "true" or
+// "0", returning fallback if it is unset and exiting if it is malformed.
+func getBool(key string, fallback bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Fatalf("Invalid boolean for %s: %v", key, err)
+	}
+	return b
+}
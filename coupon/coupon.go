@@ -0,0 +1,66 @@
+package coupon
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/apperr"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/models"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/money"
+)
+
+// Coupon types
+const (
+	TypePercentage = "PERCENTAGE"
+	TypeFlat       = "FLAT"
+)
+
+// Normalize returns code in the form coupons are stored in.
+func Normalize(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Discount returns the discount c gives on an item subtotal at restaurantID,
+// for a user who has already redeemed it userRedemptions times. A
+// FailedPrecondition error explains why a coupon cannot be used.
+func Discount(c *models.Coupon, restaurantID string, subtotal money.Money, userRedemptions int64, now time.Time) (money.Money, error) {
+	switch {
+	case !c.Active:
+		return money.Money{}, unusable(c, "COUPON_INACTIVE", "is not active")
+	case !c.ValidFrom.IsZero() && now.Before(c.ValidFrom):
+		return money.Money{}, unusable(c, "COUPON_NOT_STARTED", "is not valid yet")
+	case !c.ValidUntil.IsZero() && now.After(c.ValidUntil):
+		return money.Money{}, unusable(c, "COUPON_EXPIRED", "has expired")
+	case c.RestaurantID != "" && c.RestaurantID != restaurantID:
+		return money.Money{}, unusable(c, "COUPON_NOT_APPLICABLE", "cannot be used at this restaurant")
+	case c.UsageLimit > 0 && c.UsedCount >= c.UsageLimit:
+		return money.Money{}, unusable(c, "COUPON_EXHAUSTED", "has been fully redeemed")
+	case c.PerUserLimit > 0 && userRedemptions >= int64(c.PerUserLimit):
+		return money.Money{}, unusable(c, "COUPON_USER_LIMIT_REACHED", "has already been used the maximum number of times")
+	case subtotal.Minor < c.MinOrder.Minor:
+		return money.Money{}, unusable(c, "COUPON_MIN_ORDER_NOT_MET", fmt.Sprintf("requires an order of at least %s", c.MinOrder))
+	}
+
+	var discount money.Money
+	switch c.Type {
+	case TypePercentage:
+		discount = subtotal.MulDiv(c.PercentOff, 10000)
+	case TypeFlat:
+		discount = money.New(c.FlatOff.Minor, subtotal.Currency)
+	default:
+		return money.Money{}, fmt.Errorf("coupon %s has unknown type %q", c.Code, c.Type)
+	}
+
+	if !c.MaxDiscount.IsZero() && discount.Minor > c.MaxDiscount.Minor {
+		discount.Minor = c.MaxDiscount.Minor
+	}
+	if discount.Minor > subtotal.Minor {
+		discount.Minor = subtotal.Minor
+	}
+	return discount, nil
+}
+
+func unusable(c *models.Coupon, reason, problem string) error {
+	return apperr.FailedPrecondition(reason, fmt.Sprintf("coupon %s %s", c.Code, problem))
+}
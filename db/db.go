@@ -30,10 +30,14 @@ func Connect(dbUser, dbPassword, dbHost, dbPort, dbName string) (*gorm.DB, error
 	sqlDB.SetConnMaxLifetime(time.Hour)
 
 	// Auto-migrate the schema
-	err = db.AutoMigrate(&models.CartItem{}, &models.Order{}, &models.OrderItem{})
+	err = db.AutoMigrate(&models.CartItem{}, &models.Order{}, &models.OrderItem{}, &models.OrderStatusEvent{}, &models.OutboxMessage{}, &models.IdempotentRequest{}, &models.OrderCharge{}, &models.Coupon{}, &models.CartCoupon{}, &models.CouponRedemption{}, &models.ArchivedCartItem{}, &models.ProductOption{}, &models.CartInstructions{}, &models.Payment{}, &models.Wallet{}, &models.WalletTransaction{}, &models.Refund{}, &models.RefundItem{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to migrate database: %w", err)
 	}
 
+	if err := migrateMoneyColumns(db); err != nil {
+		return nil, fmt.Errorf("failed to migrate money columns: %w", err)
+	}
+
 	return db, nil
 }
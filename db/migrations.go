@@ -0,0 +1,50 @@
+package db
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/models"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/money"
+)
+
+// legacyMoneyColumns lists the float columns that held amounts in major units
+// before they moved to <prefix>minor and <prefix>currency columns.
+var legacyMoneyColumns = []struct {
+	model  interface{}
+	column string
+	prefix string
+}{
+	{&models.CartItem{}, "price", "price_"},
+	{&models.OrderItem{}, "price", "price_"},
+	{&models.Order{}, "total_amount", "total_"},
+}
+
+// migrateMoneyColumns copies amounts from the legacy float columns into the
+// minor unit columns created by AutoMigrate and drops the legacy columns. It
+// is a no-op once the legacy columns are gone.
+func migrateMoneyColumns(db *gorm.DB) error {
+	migrator := db.Migrator()
+	for _, legacy := range legacyMoneyColumns {
+		if !migrator.HasColumn(legacy.model, legacy.column) {
+			continue
+		}
+
+		err := db.Unscoped().
+			Model(legacy.model).
+			Where("1 = 1").
+			UpdateColumns(map[string]interface{}{
+				legacy.prefix + "minor":    gorm.Expr("ROUND(COALESCE(" + legacy.column + ", 0) * 100)"),
+				legacy.prefix + "currency": money.DefaultCurrency,
+			}).Error
+		if err != nil {
+			return fmt.Errorf("failed to copy %s into minor units: %w", legacy.column, err)
+		}
+
+		if err := migrator.DropColumn(legacy.model, legacy.column); err != nil {
+			return fmt.Errorf("failed to drop legacy column %s: %w", legacy.column, err)
+		}
+	}
+	return nil
+}
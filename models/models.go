@@ -4,6 +4,8 @@ import (
 	"time"
 
 	"gorm.io/gorm"
+
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/money"
 )
 
 type Address struct {
@@ -15,14 +17,20 @@ type Address struct {
 
 type CartItem struct {
 	gorm.Model
-	UserID       string `gorm:"type:varchar(255);index"`
-	ProductID    string `gorm:"type:varchar(255)"`
-	RestaurantID string `gorm:"type:varchar(255);index"`
-	ProductName  string `gorm:"type:varchar(255)"`
-	Description  string `gorm:"type:text"`
-	Category     string `gorm:"type:varchar(255)"`
-	Price        float64
+	UserID       string      `gorm:"type:varchar(255);index"`
+	ProductID    string      `gorm:"type:varchar(255)"`
+	RestaurantID string      `gorm:"type:varchar(255);index"`
+	ProductName  string      `gorm:"type:varchar(255)"`
+	Description  string      `gorm:"type:text"`
+	Category     string      `gorm:"type:varchar(255)"`
+	Price        money.Money `gorm:"embedded;embeddedPrefix:price_"`
 	Quantity     int32
+	Unavailable  bool // set by RefreshCart when the product is gone or out of stock
+	// LineKey tells apart lines of the same product with different options
+	// or instructions. It is empty for a product without either.
+	LineKey             string      `gorm:"type:varchar(64);default:''"`
+	Options             LineOptions `gorm:"serializer:json;type:text"`
+	SpecialInstructions string      `gorm:"type:varchar(255)"`
 }
 
 type Order struct {
@@ -32,25 +40,261 @@ type Order struct {
 	RestaurantID      string `gorm:"type:varchar(255);index"`
 	RestaurantName    string `gorm:"type:varchar(255)"`
 	RestaurantPhone   uint64
-	StreetName        string `gorm:"type:varchar(255)"`
-	Locality          string `gorm:"type:varchar(255)"`
-	State             string `gorm:"type:varchar(255)"`
-	Pincode           string `gorm:"type:varchar(20)"`
-	TotalAmount       float64
-	OrderStatus       string `gorm:"type:varchar(50)"`
+	StreetName        string      `gorm:"type:varchar(255)"`
+	Locality          string      `gorm:"type:varchar(255)"`
+	State             string      `gorm:"type:varchar(255)"`
+	Pincode           string      `gorm:"type:varchar(20)"`
+	Total             money.Money `gorm:"embedded;embeddedPrefix:total_"`
+	OrderStatus       string      `gorm:"type:varchar(50)"`
 	CreatedAt         time.Time
-	DeliveryAddressID string      `gorm:"type:varchar(255)"`
-	CancelReason      string      `gorm:"type:varchar(255)"`
-	OrderItems        []OrderItem `gorm:"foreignKey:OrderID;references:OrderID"`
+	DeliveryAddressID string `gorm:"type:varchar(255)"`
+	CancelReason      string `gorm:"type:varchar(255)"`
+	// RejectionCode is the orderstate rejection code of an order the
+	// restaurant rejected.
+	RejectionCode string `gorm:"type:varchar(20)"`
+	// Instructions from the user for the rider and for the kitchen
+	DeliveryInstructions string `gorm:"type:varchar(500)"`
+	KitchenNote          string `gorm:"type:varchar(500)"`
+	// PaymentMethod is one of the payments package methods; it is empty for
+	// orders placed before payments were taken.
+	PaymentMethod string `gorm:"type:varchar(20)"`
+	// ScheduledFor is the delivery slot of a scheduled order. StockDeferred
+	// orders reserve their stock only when released to the restaurant.
+	ScheduledFor  *time.Time `gorm:"index"`
+	StockDeferred bool
+	ReleasedAt    *time.Time
+	// PendingSince is when the order started waiting for the restaurant to
+	// accept it.
+	PendingSince *time.Time    `gorm:"index"`
+	OrderItems   []OrderItem   `gorm:"foreignKey:OrderID;references:OrderID"`
+	OrderCharges []OrderCharge `gorm:"foreignKey:OrderID;references:OrderID"`
+	Payment      *Payment      `gorm:"foreignKey:OrderID;references:OrderID"`
+}
+
+// Payment is the payment taken for an order through a payment provider.
+// Status is one of the payments package statuses.
+type Payment struct {
+	gorm.Model
+	PaymentID         string      `gorm:"type:varchar(255);uniqueIndex"`
+	OrderID           string      `gorm:"type:varchar(255);uniqueIndex"`
+	Provider          string      `gorm:"type:varchar(50)"`
+	Status            string      `gorm:"type:varchar(20)"`
+	Amount            money.Money `gorm:"embedded;embeddedPrefix:amount_"`
+	ProviderReference string      `gorm:"type:varchar(255)"`
+	FailureReason     string      `gorm:"type:varchar(255)"`
+	AuthorizedAt      *time.Time
+	CapturedAt        *time.Time
 }
 
 type OrderItem struct {
 	gorm.Model
-	OrderID     string `gorm:"type:varchar(255);index"`
+	OrderID     string      `gorm:"type:varchar(255);index"`
+	ProductID   string      `gorm:"type:varchar(255)"`
+	ProductName string      `gorm:"type:varchar(255)"`
+	Description string      `gorm:"type:text"`
+	Category    string      `gorm:"type:varchar(255)"`
+	Price       money.Money `gorm:"embedded;embeddedPrefix:price_"`
+	Quantity    int32
+	// LineKey, Options and SpecialInstructions are copied from the cart line
+	LineKey             string      `gorm:"type:varchar(64);default:''"`
+	Options             LineOptions `gorm:"serializer:json;type:text"`
+	SpecialInstructions string      `gorm:"type:varchar(255)"`
+	// Discount and Tax are the item's share of the order's discount and the
+	// tax charged on it, frozen from the bill the order was placed at
+	Discount money.Money `gorm:"embedded;embeddedPrefix:discount_"`
+	Tax      money.Money `gorm:"embedded;embeddedPrefix:tax_"`
+}
+
+// LineOption is a variant or add-on selected on a cart or order line, with
+// the amount it adds to the product's unit price at the time it was chosen.
+type LineOption struct {
+	OptionID   string
+	GroupName  string
+	Name       string
+	PriceDelta money.Money
+}
+
+// LineOptions are the options selected on a line, stored as JSON.
+type LineOptions []LineOption
+
+// ProductOption is a variant or add-on a restaurant offers for a product,
+// such as a size or an extra topping. Options in a SINGLE group are mutually
+// exclusive; any number of options in a MULTI group may be chosen.
+type ProductOption struct {
+	gorm.Model
+	OptionID     string      `gorm:"type:varchar(255);uniqueIndex"`
+	RestaurantID string      `gorm:"type:varchar(255);index"`
+	ProductID    string      `gorm:"type:varchar(255);index"`
+	GroupName    string      `gorm:"type:varchar(100)"`
+	GroupType    string      `gorm:"type:varchar(20)"`
+	Name         string      `gorm:"type:varchar(255)"`
+	PriceDelta   money.Money `gorm:"embedded;embeddedPrefix:price_delta_"`
+	Active       bool
+}
+
+type OrderStatusEvent struct {
+	gorm.Model
+	OrderID    string `gorm:"type:varchar(255);index"`
+	FromStatus string `gorm:"type:varchar(50)"`
+	ToStatus   string `gorm:"type:varchar(50)"`
+	ActorType  string `gorm:"type:varchar(50)"`
+	ActorID    string `gorm:"type:varchar(255)"`
+	Reason     string `gorm:"type:varchar(255)"`
+}
+
+// OutboxMessage is a call to another service recorded in the same
+// transaction as the state change that requires it. The outbox dispatcher
+// performs it later, retrying until it succeeds or runs out of attempts.
+type OutboxMessage struct {
+	gorm.Model
+	AggregateID   string    `gorm:"type:varchar(255);index"`
+	Type          string    `gorm:"type:varchar(50)"`
+	Payload       string    `gorm:"type:text"`
+	Status        string    `gorm:"type:varchar(20);index:idx_outbox_due"`
+	NextAttemptAt time.Time `gorm:"index:idx_outbox_due"`
+	Attempts      int32
+	LastError     string `gorm:"type:text"`
+}
+
+// IdempotentRequest remembers the outcome of a request sent with an
+// idempotency key so that retries of it return the original response.
+type IdempotentRequest struct {
+	gorm.Model
+	UserID         string `gorm:"type:varchar(255);uniqueIndex:idx_idempotent_user_key"`
+	IdempotencyKey string `gorm:"type:varchar(255);uniqueIndex:idx_idempotent_user_key"`
+	RequestHash    string `gorm:"type:varchar(64)"`
+	Status         string `gorm:"type:varchar(20)"`
+	// LeaseID identifies the request currently holding the key. It changes
+	// when an abandoned key is taken over, so the abandoned request can no
+	// longer complete or release it.
+	LeaseID   string `gorm:"type:varchar(64)"`
+	Response  []byte
+	ExpiresAt time.Time `gorm:"index"`
+}
+
+// OrderCharge is a charge on top of an order's items frozen from the bill it
+// was placed with, such as a tax, the delivery fee or a discount (negative).
+type OrderCharge struct {
+	gorm.Model
+	OrderID string      `gorm:"type:varchar(255);index"`
+	Type    string      `gorm:"type:varchar(20)"`
+	Label   string      `gorm:"type:varchar(255)"`
+	Rate    int64       // basis points, for taxes
+	Amount  money.Money `gorm:"embedded;embeddedPrefix:amount_"`
+}
+
+// Coupon is a promo code giving a percentage or flat discount on the item
+// subtotal. Zero limits and amounts mean no limit.
+type Coupon struct {
+	gorm.Model
+	Code         string      `gorm:"type:varchar(50);uniqueIndex"`
+	Type         string      `gorm:"type:varchar(20)"`
+	PercentOff   int64       // basis points, for percentage coupons
+	FlatOff      money.Money `gorm:"embedded;embeddedPrefix:flat_off_"`
+	MinOrder     money.Money `gorm:"embedded;embeddedPrefix:min_order_"`
+	MaxDiscount  money.Money `gorm:"embedded;embeddedPrefix:max_discount_"`
+	RestaurantID string      `gorm:"type:varchar(255);index"` // empty for every restaurant
+	ValidFrom    time.Time
+	ValidUntil   time.Time
+	PerUserLimit int32
+	UsageLimit   int32
+	UsedCount    int32
+	Active       bool
+}
+
+// CartCoupon is the coupon a user applied to their cart at a restaurant.
+type CartCoupon struct {
+	gorm.Model
+	UserID       string `gorm:"type:varchar(255);uniqueIndex:idx_cart_coupon"`
+	RestaurantID string `gorm:"type:varchar(255);uniqueIndex:idx_cart_coupon"`
+	CouponCode   string `gorm:"type:varchar(50)"`
+}
+
+// CartInstructions are the order-level instructions a user left on their
+// cart at a restaurant. They are copied to the order when it is placed.
+type CartInstructions struct {
+	gorm.Model
+	UserID               string `gorm:"type:varchar(255);uniqueIndex:idx_cart_instructions"`
+	RestaurantID         string `gorm:"type:varchar(255);uniqueIndex:idx_cart_instructions"`
+	DeliveryInstructions string `gorm:"type:varchar(500)"`
+	KitchenNote          string `gorm:"type:varchar(500)"`
+}
+
+// CouponRedemption records a coupon used by an order. It is written in the
+// same transaction as the order.
+type CouponRedemption struct {
+	gorm.Model
+	CouponCode string      `gorm:"type:varchar(50);index:idx_redemption_user"`
+	UserID     string      `gorm:"type:varchar(255);index:idx_redemption_user"`
+	OrderID    string      `gorm:"type:varchar(255);uniqueIndex"`
+	Discount   money.Money `gorm:"embedded;embeddedPrefix:discount_"`
+}
+
+// ArchivedCartItem is a cart item removed by the cart sweeper because its
+// cart was idle for longer than the cart TTL.
+type ArchivedCartItem struct {
+	gorm.Model
+	CartItemID     uint
+	UserID         string      `gorm:"type:varchar(255);index"`
+	ProductID      string      `gorm:"type:varchar(255)"`
+	RestaurantID   string      `gorm:"type:varchar(255);index"`
+	ProductName    string      `gorm:"type:varchar(255)"`
+	Category       string      `gorm:"type:varchar(255)"`
+	Price          money.Money `gorm:"embedded;embeddedPrefix:price_"`
+	Quantity       int32
+	LastActivityAt time.Time
+	// LineKey, Options and SpecialInstructions are copied from the cart line
+	LineKey             string      `gorm:"type:varchar(64);default:''"`
+	Options             LineOptions `gorm:"serializer:json;type:text"`
+	SpecialInstructions string      `gorm:"type:varchar(255)"`
+}
+
+// Refund returns part or all of an order's payment to the user. Refunds of
+// individual items list them in Items. Status is one of the payments package
+// refund statuses.
+type Refund struct {
+	gorm.Model
+	RefundID          string       `gorm:"type:varchar(255);uniqueIndex"`
+	OrderID           string       `gorm:"type:varchar(255);index"`
+	PaymentID         string       `gorm:"type:varchar(255)"`
+	Amount            money.Money  `gorm:"embedded;embeddedPrefix:amount_"`
+	Reason            string       `gorm:"type:varchar(255)"`
+	Status            string       `gorm:"type:varchar(20)"`
+	ActorType         string       `gorm:"type:varchar(20)"`
+	ActorID           string       `gorm:"type:varchar(255)"`
+	ProviderReference string       `gorm:"type:varchar(255)"`
+	FailureReason     string       `gorm:"type:text"`
+	Items             []RefundItem `gorm:"foreignKey:RefundID;references:RefundID"`
+}
+
+// RefundItem is the quantity of an order item a refund covers.
+type RefundItem struct {
+	gorm.Model
+	RefundID    string `gorm:"type:varchar(255);index"`
+	OrderItemID uint   `gorm:"index"`
 	ProductID   string `gorm:"type:varchar(255)"`
-	ProductName string `gorm:"type:varchar(255)"`
-	Description string `gorm:"type:text"`
-	Category    string `gorm:"type:varchar(255)"`
-	Price       float64
 	Quantity    int32
+	Amount      money.Money `gorm:"embedded;embeddedPrefix:amount_"`
+}
+
+// Wallet is a user's prepaid balance. Held is the part of Balance reserved
+// for wallet payments that have not been captured yet.
+type Wallet struct {
+	gorm.Model
+	UserID  string      `gorm:"type:varchar(255);uniqueIndex"`
+	Balance money.Money `gorm:"embedded;embeddedPrefix:balance_"`
+	Held    money.Money `gorm:"embedded;embeddedPrefix:held_"`
+}
+
+// WalletTransaction is an entry in a wallet's ledger, together with the
+// wallet's balance and held amount after it.
+type WalletTransaction struct {
+	gorm.Model
+	UserID       string      `gorm:"type:varchar(255);index"`
+	Type         string      `gorm:"type:varchar(20)"`
+	Amount       money.Money `gorm:"embedded;embeddedPrefix:amount_"`
+	OrderID      string      `gorm:"type:varchar(255);index"`
+	Description  string      `gorm:"type:varchar(255)"`
+	BalanceAfter money.Money `gorm:"embedded;embeddedPrefix:balance_after_"`
+	HeldAfter    money.Money `gorm:"embedded;embeddedPrefix:held_after_"`
 }
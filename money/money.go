@@ -0,0 +1,99 @@
+package money
+
+import (
+	"fmt"
+	"math"
+)
+
+// DefaultCurrency is the currency of all prices handled by the platform.
+const DefaultCurrency = "INR"
+
+// minorPerMajor is the number of minor units (paise, cents) in one major unit.
+const minorPerMajor = 100
+
+// Money is an amount in the minor unit of its currency, e.g. paise for INR.
+// Stored as an embedded struct it maps to <prefix>minor BIGINT and
+// <prefix>currency CHAR(3) columns.
+type Money struct {
+	Minor    int64  `gorm:"not null;default:0"`
+	Currency string `gorm:"type:char(3)"`
+}
+
+// New returns minor units of currency.
+func New(minor int64, currency string) Money {
+	return Money{Minor: minor, Currency: currency}
+}
+
+// Zero returns a zero amount of currency.
+func Zero(currency string) Money {
+	return Money{Currency: currency}
+}
+
+// FromMajor converts a decimal amount in major units, such as the prices
+// reported by RestaurantService, rounding half away from zero to the nearest
+// minor unit.
+func FromMajor(amount float64, currency string) Money {
+	return Money{Minor: int64(math.Round(amount * minorPerMajor)), Currency: currency}
+}
+
+// Major returns the amount in major units for APIs that carry prices as
+// decimals. It must not be used for arithmetic.
+func (m Money) Major() float64 {
+	return float64(m.Minor) / minorPerMajor
+}
+
+// Times returns m multiplied by quantity.
+func (m Money) Times(quantity int64) Money {
+	return Money{Minor: m.Minor * quantity, Currency: m.Currency}
+}
+
+// MulDiv returns m × num / den rounded half away from zero, e.g. a tax rate
+// in basis points with den 10000.
+func (m Money) MulDiv(num, den int64) Money {
+	product := m.Minor * num
+	quotient, remainder := product/den, product%den
+	if remainder < 0 {
+		remainder = -remainder
+	}
+	if 2*remainder >= den {
+		if product < 0 {
+			quotient--
+		} else {
+			quotient++
+		}
+	}
+	return Money{Minor: quotient, Currency: m.Currency}
+}
+
+// Add returns m + other. Adding amounts in different currencies is an error;
+// a zero amount without currency takes the other's currency.
+func (m Money) Add(other Money) (Money, error) {
+	switch {
+	case m.Currency == "":
+		m.Currency = other.Currency
+	case other.Currency != "" && other.Currency != m.Currency:
+		return Money{}, fmt.Errorf("cannot add %s to %s", other.Currency, m.Currency)
+	}
+	m.Minor += other.Minor
+	return m, nil
+}
+
+// Sub returns m - other under the same currency rules as Add.
+func (m Money) Sub(other Money) (Money, error) {
+	return m.Add(Money{Minor: -other.Minor, Currency: other.Currency})
+}
+
+// IsZero reports whether the amount is zero.
+func (m Money) IsZero() bool {
+	return m.Minor == 0
+}
+
+func (m Money) String() string {
+	sign := ""
+	minor := m.Minor
+	if minor < 0 {
+		sign = "-"
+		minor = -minor
+	}
+	return fmt.Sprintf("%s %s%d.%02d", m.Currency, sign, minor/minorPerMajor, minor%minorPerMajor)
+}
@@ -0,0 +1,100 @@
+package money
+
+import "testing"
+
+func TestFromMajor(t *testing.T) {
+	tests := []struct {
+		amount float64
+		want   int64
+	}{
+		{0, 0},
+		{1, 100},
+		{19.99, 1999},
+		{0.1 + 0.2, 30},
+		{2.675, 268},
+		{0.005, 1},
+		{-0.005, -1},
+		{-12.34, -1234},
+	}
+
+	for _, tt := range tests {
+		got := FromMajor(tt.amount, DefaultCurrency)
+		if got.Minor != tt.want || got.Currency != DefaultCurrency {
+			t.Errorf("FromMajor(%v) = %+v, want %d %s", tt.amount, got, tt.want, DefaultCurrency)
+		}
+	}
+}
+
+func TestMajor(t *testing.T) {
+	if got := New(1999, DefaultCurrency).Major(); got != 19.99 {
+		t.Errorf("Major() = %v, want 19.99", got)
+	}
+	if got := New(-5, DefaultCurrency).Major(); got != -0.05 {
+		t.Errorf("Major() = %v, want -0.05", got)
+	}
+}
+
+func TestMulDiv(t *testing.T) {
+	tests := []struct {
+		name     string
+		minor    int64
+		num, den int64
+		want     int64
+	}{
+		{"exact", 10000, 500, 10000, 500},
+		{"rounds down below half", 1001, 500, 10000, 50},
+		{"rounds half up", 1010, 500, 10000, 51},
+		{"rounds half away from zero when negative", -1010, 500, 10000, -51},
+		{"rounds down below half when negative", -1001, 500, 10000, -50},
+		{"proportional share", 100, 1, 3, 33},
+		{"proportional share rounding up", 200, 1, 3, 67},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := New(tt.minor, DefaultCurrency).MulDiv(tt.num, tt.den)
+			if got.Minor != tt.want {
+				t.Errorf("%d × %d / %d = %d, want %d", tt.minor, tt.num, tt.den, got.Minor, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdd(t *testing.T) {
+	sum, err := New(150, "INR").Add(New(250, "INR"))
+	if err != nil || sum != New(400, "INR") {
+		t.Errorf("Add = %+v, %v; want 400 INR", sum, err)
+	}
+
+	sum, err = Money{}.Add(New(250, "USD"))
+	if err != nil || sum != New(250, "USD") {
+		t.Errorf("zero Add = %+v, %v; want the other currency", sum, err)
+	}
+
+	if _, err := New(1, "INR").Add(New(1, "USD")); err == nil {
+		t.Error("adding different currencies succeeded")
+	}
+
+	diff, err := New(100, "INR").Sub(New(250, "INR"))
+	if err != nil || diff != New(-150, "INR") {
+		t.Errorf("Sub = %+v, %v; want -150 INR", diff, err)
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		m    Money
+		want string
+	}{
+		{New(1999, "INR"), "INR 19.99"},
+		{New(5, "INR"), "INR 0.05"},
+		{New(-1205, "INR"), "INR -12.05"},
+		{Zero("INR"), "INR 0.00"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.m.String(); got != tt.want {
+			t.Errorf("String() = %q, want %q", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package notify
+
+import (
+	"context"
+	"log"
+)
+
+// Notification is a message about an order for the user who placed it.
+type Notification struct {
+	UserID  string
+	OrderID string
+	Message string
+}
+
+// Notifier delivers notifications to users.
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// Log is a Notifier that writes notifications to the service log, for running
+// without a notification service.
+type Log struct{}
+
+func NewLog() *Log {
+	return &Log{}
+}
+
+func (l *Log) Notify(ctx context.Context, n Notification) error {
+	log.Printf("Notify user %s about order %s: %s", n.UserID, n.OrderID, n.Message)
+	return nil
+}
@@ -0,0 +1,164 @@
+package orderstate
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Status is the lifecycle state of an order.
+type Status string
+
+const (
+	// PaymentPending orders are saved while their payment is authorized.
+	// Once it is authorized the order starts Reserving its stock; if it is
+	// declined the order becomes Failed.
+	PaymentPending Status = "PAYMENT_PENDING"
+	// Reserving orders are saved but the restaurant stock for their items is
+	// still being decremented by the outbox dispatcher. Once every item is
+	// reserved the order becomes Pending; if reservation fails it becomes Failed.
+	Reserving Status = "RESERVING"
+	Failed    Status = "FAILED"
+	// Scheduled orders are waiting for their delivery slot. The scheduler
+	// releases them to Pending, or to Reserving if their stock was deferred,
+	// a lead time before the slot.
+	Scheduled      Status = "SCHEDULED"
+	Pending        Status = "PENDING"
+	Confirmed      Status = "CONFIRMED"
+	Preparing      Status = "PREPARING"
+	Ready          Status = "READY"
+	OutForDelivery Status = "OUT_FOR_DELIVERY"
+	Delivered      Status = "DELIVERED"
+	Cancelled      Status = "CANCELLED"
+	// PartiallyRefunded orders had part of their payment refunded; Refunded
+	// orders all of it.
+	PartiallyRefunded Status = "PARTIALLY_REFUNDED"
+	Refunded          Status = "REFUNDED"
+)
+
+// Actor identifies who is requesting a status change.
+type Actor string
+
+const (
+	ActorUser       Actor = "USER"
+	ActorRestaurant Actor = "RESTAURANT"
+	ActorSystem     Actor = "SYSTEM"
+	// ActorAdmin is recorded for support actions such as refunds. Admins do
+	// not move orders between statuses themselves.
+	ActorAdmin Actor = "ADMIN"
+)
+
+// transitions lists, for every status, the statuses it may move to and the
+// actors allowed to make that move. Statuses missing from the map are terminal.
+var transitions = map[Status]map[Status][]Actor{
+	PaymentPending: {
+		Reserving: {ActorSystem},
+		Scheduled: {ActorSystem},
+		Failed:    {ActorSystem},
+	},
+	Reserving: {
+		Pending:   {ActorSystem},
+		Scheduled: {ActorSystem},
+		Failed:    {ActorSystem},
+		Cancelled: {ActorUser, ActorSystem},
+	},
+	Scheduled: {
+		Pending:   {ActorSystem},
+		Reserving: {ActorSystem},
+		Cancelled: {ActorUser, ActorRestaurant, ActorSystem},
+	},
+	Pending: {
+		Confirmed: {ActorRestaurant},
+		Cancelled: {ActorUser, ActorRestaurant, ActorSystem},
+	},
+	Confirmed: {
+		Preparing: {ActorRestaurant},
+		Cancelled: {ActorRestaurant, ActorSystem},
+	},
+	Preparing: {
+		Ready: {ActorRestaurant},
+	},
+	Ready: {
+		OutForDelivery: {ActorRestaurant, ActorSystem},
+	},
+	OutForDelivery: {
+		Delivered: {ActorRestaurant, ActorSystem},
+	},
+	Delivered: {
+		PartiallyRefunded: {ActorSystem},
+		Refunded:          {ActorSystem},
+	},
+	Cancelled: {
+		PartiallyRefunded: {ActorSystem},
+		Refunded:          {ActorSystem},
+	},
+	PartiallyRefunded: {
+		Refunded: {ActorSystem},
+	},
+}
+
+// Parse normalises s and returns the matching Status, or an error if s is not
+// a known order status.
+func Parse(s string) (Status, error) {
+	status := Status(strings.ToUpper(strings.TrimSpace(s)))
+	if !status.Valid() {
+		return "", fmt.Errorf("unknown order status %q", s)
+	}
+	return status, nil
+}
+
+// Valid reports whether s is one of the known order statuses.
+func (s Status) Valid() bool {
+	switch s {
+	case PaymentPending, Reserving, Failed, Scheduled, Pending, Confirmed, Preparing, Ready, OutForDelivery, Delivered, Cancelled, PartiallyRefunded, Refunded:
+		return true
+	}
+	return false
+}
+
+// Terminal reports whether no further transitions are possible from s.
+func (s Status) Terminal() bool {
+	return len(transitions[s]) == 0
+}
+
+func (s Status) String() string {
+	return string(s)
+}
+
+// CanTransition reports whether actor may move an order from one status to another.
+func CanTransition(actor Actor, from, to Status) bool {
+	for _, allowed := range transitions[from][to] {
+		if allowed == actor {
+			return true
+		}
+	}
+	return false
+}
+
+// TransitionError describes a status change that is not allowed.
+type TransitionError struct {
+	Actor Actor
+	From  Status
+	To    Status
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("%s cannot move order from %s to %s", strings.ToLower(string(e.Actor)), e.From, e.To)
+}
+
+// Transition validates that actor may move an order from the status string
+// from to to, returning the parsed target status. It returns a
+// *TransitionError if the move is not allowed.
+func Transition(actor Actor, from, to string) (Status, error) {
+	fromStatus, err := Parse(from)
+	if err != nil {
+		return "", err
+	}
+	toStatus, err := Parse(to)
+	if err != nil {
+		return "", err
+	}
+	if !CanTransition(actor, fromStatus, toStatus) {
+		return "", &TransitionError{Actor: actor, From: fromStatus, To: toStatus}
+	}
+	return toStatus, nil
+}
@@ -0,0 +1,103 @@
+package orderstate
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTransition(t *testing.T) {
+	tests := []struct {
+		name    string
+		actor   Actor
+		from    string
+		to      string
+		want    Status
+		wantErr bool
+	}{
+		{"restaurant confirms pending", ActorRestaurant, "PENDING", "CONFIRMED", Confirmed, false},
+		{"user cannot confirm", ActorUser, "PENDING", "CONFIRMED", "", true},
+		{"user cancels pending", ActorUser, "PENDING", "CANCELLED", Cancelled, false},
+		{"user cannot cancel confirmed", ActorUser, "CONFIRMED", "CANCELLED", "", true},
+		{"restaurant cancels confirmed", ActorRestaurant, "CONFIRMED", "CANCELLED", Cancelled, false},
+		{"system cancels confirmed", ActorSystem, "CONFIRMED", "CANCELLED", Cancelled, false},
+		{"restaurant prepares confirmed", ActorRestaurant, "CONFIRMED", "PREPARING", Preparing, false},
+		{"restaurant cannot skip preparing", ActorRestaurant, "CONFIRMED", "READY", "", true},
+		{"system delivers", ActorSystem, "OUT_FOR_DELIVERY", "DELIVERED", Delivered, false},
+		{"nobody leaves delivered except refunds", ActorRestaurant, "DELIVERED", "CANCELLED", "", true},
+		{"system refunds delivered", ActorSystem, "DELIVERED", "REFUNDED", Refunded, false},
+		{"admin cannot move orders", ActorAdmin, "PENDING", "CANCELLED", "", true},
+		{"statuses are normalised", ActorRestaurant, " pending ", "confirmed", Confirmed, false},
+		{"unknown from status", ActorRestaurant, "LOST", "CONFIRMED", "", true},
+		{"unknown to status", ActorRestaurant, "PENDING", "ACCEPTED", "", true},
+		{"system releases scheduled", ActorSystem, "SCHEDULED", "PENDING", Pending, false},
+		{"restaurant cannot release scheduled", ActorRestaurant, "SCHEDULED", "PENDING", "", true},
+		{"system authorizes payment", ActorSystem, "PAYMENT_PENDING", "RESERVING", Reserving, false},
+		{"user cannot cancel payment pending", ActorUser, "PAYMENT_PENDING", "CANCELLED", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Transition(tt.actor, tt.from, tt.to)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Transition(%s, %q, %q) error = %v, want error %v", tt.actor, tt.from, tt.to, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Transition(%s, %q, %q) = %q, want %q", tt.actor, tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransitionErrorKinds(t *testing.T) {
+	var transitionErr *TransitionError
+
+	_, err := Transition(ActorUser, "PENDING", "CONFIRMED")
+	if !errors.As(err, &transitionErr) {
+		t.Errorf("illegal move returned %v, want a *TransitionError", err)
+	}
+
+	_, err = Transition(ActorUser, "PENDING", "ACCEPTED")
+	if err == nil || errors.As(err, &transitionErr) {
+		t.Errorf("unknown status returned %v, want a parse error", err)
+	}
+}
+
+func TestTerminal(t *testing.T) {
+	tests := []struct {
+		status Status
+		want   bool
+	}{
+		{Pending, false},
+		{Delivered, false},
+		{Cancelled, false},
+		{Refunded, true},
+		{Failed, true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.status.Terminal(); got != tt.want {
+			t.Errorf("%s.Terminal() = %v, want %v", tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestParseRejectionCode(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    RejectionCode
+		wantErr bool
+	}{
+		{"OUT_OF_STOCK", RejectOutOfStock, false},
+		{" closing_soon ", RejectClosingSoon, false},
+		{"too_busy", RejectTooBusy, false},
+		{"CLOSED", "", true},
+		{"", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseRejectionCode(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseRejectionCode(%q) = %q, %v; want %q, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
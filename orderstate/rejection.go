@@ -0,0 +1,41 @@
+package orderstate
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RejectionCode is the reason a restaurant gives for rejecting an order.
+type RejectionCode string
+
+const (
+	RejectOutOfStock  RejectionCode = "OUT_OF_STOCK"
+	RejectClosingSoon RejectionCode = "CLOSING_SOON"
+	RejectTooBusy     RejectionCode = "TOO_BUSY"
+)
+
+// rejectionDescriptions are the explanations shown to users for every code.
+var rejectionDescriptions = map[RejectionCode]string{
+	RejectOutOfStock:  "some items are out of stock",
+	RejectClosingSoon: "the restaurant is closing soon",
+	RejectTooBusy:     "the restaurant is too busy",
+}
+
+// ParseRejectionCode normalises s and returns the matching RejectionCode, or
+// an error if s is not a known rejection code.
+func ParseRejectionCode(s string) (RejectionCode, error) {
+	code := RejectionCode(strings.ToUpper(strings.TrimSpace(s)))
+	if _, ok := rejectionDescriptions[code]; !ok {
+		return "", fmt.Errorf("unknown rejection code %q", s)
+	}
+	return code, nil
+}
+
+// Description returns the explanation of c shown to users.
+func (c RejectionCode) Description() string {
+	return rejectionDescriptions[c]
+}
+
+func (c RejectionCode) String() string {
+	return string(c)
+}
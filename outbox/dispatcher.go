@@ -0,0 +1,248 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	restaurantPb "github.com/liju-github/CentralisedFoodbuddyMicroserviceProto/Restaurant"
+	clients "github.com/liju-github/FoodBuddyMicroserviceOrderCart/clients"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/models"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/notify"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/payments"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/repository"
+)
+
+const (
+	defaultBatchSize    = 50
+	defaultPollInterval = 2 * time.Second
+	defaultLease        = time.Minute
+	defaultMaxAttempts  = 8
+	baseRetryDelay      = 2 * time.Second
+	maxRetryDelay       = 5 * time.Minute
+
+	// idempotencyKeyHeader carries the key of a stock message to the
+	// restaurant service
+	idempotencyKeyHeader = "idempotency-key"
+)
+
+// Dispatcher performs the outbox messages written by the repository: it
+// decrements restaurant stock for reserving orders and gives stock back for
+// cancelled or failed ones, captures, voids and refunds payments and notifies
+// users, retrying failed calls with exponential backoff.
+type Dispatcher struct {
+	repo             repository.OrderCartRepository
+	restaurantClient clients.RestaurantClient
+	paymentProvider  payments.Provider
+	notifier         notify.Notifier
+	batchSize        int
+	pollInterval     time.Duration
+	lease            time.Duration
+	maxAttempts      int32
+}
+
+func NewDispatcher(repo repository.OrderCartRepository, restaurantClient clients.RestaurantClient, paymentProvider payments.Provider, notifier notify.Notifier) *Dispatcher {
+	return &Dispatcher{
+		repo:             repo,
+		restaurantClient: restaurantClient,
+		paymentProvider:  paymentProvider,
+		notifier:         notifier,
+		batchSize:        defaultBatchSize,
+		pollInterval:     defaultPollInterval,
+		lease:            defaultLease,
+		maxAttempts:      defaultMaxAttempts,
+	}
+}
+
+// Run dispatches due messages until ctx is cancelled.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.DispatchBatch(ctx); err != nil {
+			log.Printf("Outbox dispatch failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DispatchBatch claims and performs one batch of due messages.
+func (d *Dispatcher) DispatchBatch(ctx context.Context) error {
+	messages, err := d.repo.ClaimOutboxMessages(d.batchSize, d.lease)
+	if err != nil {
+		return fmt.Errorf("failed to claim outbox messages: %w", err)
+	}
+
+	for i := range messages {
+		msg := &messages[i]
+		if err := d.dispatch(ctx, msg); err != nil {
+			log.Printf("Failed to record outcome of outbox message %d: %v", msg.ID, err)
+		}
+	}
+	return nil
+}
+
+// dispatch performs msg and records the outcome. The returned error only
+// reports failures to record that outcome.
+func (d *Dispatcher) dispatch(ctx context.Context, msg *models.OutboxMessage) error {
+	switch msg.Type {
+	case repository.OutboxDecrementStock, repository.OutboxIncrementStock:
+		return d.dispatchStock(ctx, msg)
+	case repository.OutboxCapturePayment, repository.OutboxVoidPayment, repository.OutboxRefundPayment:
+		return d.dispatchPayment(ctx, msg)
+	case repository.OutboxNotifyUser:
+		return d.dispatchNotification(ctx, msg)
+	}
+	return d.fail(msg, fmt.Sprintf("unknown outbox message type %q", msg.Type))
+}
+
+func (d *Dispatcher) dispatchStock(ctx context.Context, msg *models.OutboxMessage) error {
+	payload, err := repository.DecodeStockPayload(msg)
+	if err != nil {
+		return d.fail(msg, fmt.Sprintf("invalid payload: %v", err))
+	}
+
+	if payload.Key != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, idempotencyKeyHeader, msg.Type+":"+payload.Key)
+	}
+	if msg.Type == repository.OutboxDecrementStock {
+		_, err = d.restaurantClient.DecrementProductStockByValue(ctx, &restaurantPb.DecrementProductStockByValueByValueRequest{
+			ProductId:    payload.ProductID,
+			RestaurantId: payload.RestaurantID,
+			Value:        payload.Quantity,
+		})
+		if err == nil {
+			return d.repo.CompleteStockReservation(msg)
+		}
+	} else {
+		_, err = d.restaurantClient.IncremenentProductStockByValue(ctx, &restaurantPb.IncremenentProductStockByValueRequest{
+			ProductId:    payload.ProductID,
+			RestaurantId: payload.RestaurantID,
+			Value:        payload.Quantity,
+		})
+		if err == nil {
+			return d.repo.MarkOutboxMessageDone(msg.ID)
+		}
+	}
+
+	log.Printf("Outbox %s for order %s product %s failed (attempt %d): %v",
+		msg.Type, payload.OrderID, payload.ProductID, msg.Attempts+1, err)
+	return d.retry(msg, err)
+}
+
+func (d *Dispatcher) dispatchPayment(ctx context.Context, msg *models.OutboxMessage) error {
+	payload, err := repository.DecodePaymentPayload(msg)
+	if err != nil {
+		return d.fail(msg, fmt.Sprintf("invalid payload: %v", err))
+	}
+
+	var reference string
+	switch msg.Type {
+	case repository.OutboxCapturePayment:
+		err = d.paymentProvider.Capture(ctx, payload.Reference, payload.Amount())
+	case repository.OutboxVoidPayment:
+		authorization := payload.Reference
+		if authorization == "" {
+			// Authorizations are deduplicated by payment ID, so authorizing
+			// again finds the one whose outcome was lost, if any
+			authorization, err = d.paymentProvider.Authorize(ctx, payments.AuthorizeRequest{
+				PaymentID: payload.PaymentID,
+				OrderID:   payload.OrderID,
+				Amount:    payload.Amount(),
+			})
+		}
+		if err == nil {
+			err = d.paymentProvider.Void(ctx, authorization)
+		}
+	case repository.OutboxRefundPayment:
+		reference, err = d.paymentProvider.Refund(ctx, payload.Reference, payload.RefundID, payload.Amount())
+	}
+	if err == nil {
+		return d.repo.CompletePaymentOperation(msg, reference)
+	}
+
+	log.Printf("Outbox %s for order %s payment %s failed (attempt %d): %v",
+		msg.Type, payload.OrderID, payload.PaymentID, msg.Attempts+1, err)
+	return d.retry(msg, err)
+}
+
+func (d *Dispatcher) dispatchNotification(ctx context.Context, msg *models.OutboxMessage) error {
+	payload, err := repository.DecodeNotificationPayload(msg)
+	if err != nil {
+		return d.fail(msg, fmt.Sprintf("invalid payload: %v", err))
+	}
+
+	err = d.notifier.Notify(ctx, notify.Notification{
+		UserID:  payload.UserID,
+		OrderID: payload.OrderID,
+		Message: payload.Message,
+	})
+	if err == nil {
+		return d.repo.MarkOutboxMessageDone(msg.ID)
+	}
+
+	log.Printf("Outbox %s for order %s user %s failed (attempt %d): %v",
+		msg.Type, payload.OrderID, payload.UserID, msg.Attempts+1, err)
+	return d.retry(msg, err)
+}
+
+// retry reschedules msg after a failed attempt, or gives up on it if err is
+// permanent or it ran out of attempts. A stock decrement that ran out of
+// attempts may still have been applied, so it is left for an operator to
+// reconcile.
+func (d *Dispatcher) retry(msg *models.OutboxMessage, err error) error {
+	switch {
+	case permanent(err):
+		return d.fail(msg, err.Error())
+	case msg.Attempts+1 < d.maxAttempts:
+		return d.repo.RescheduleOutboxMessage(msg.ID, time.Now().Add(backoff(msg.Attempts)), err.Error())
+	case msg.Type == repository.OutboxDecrementStock:
+		log.Printf("Outbox %s %d gave up with an unknown outcome; reconcile its stock by hand", msg.Type, msg.ID)
+		return d.repo.FailStockReservation(msg, err.Error(), true)
+	}
+	return d.fail(msg, err.Error())
+}
+
+// fail gives up on msg. A failed stock decrement fails its order's reservation
+// and releases whatever stock was already taken, and a failed refund can be
+// issued again.
+func (d *Dispatcher) fail(msg *models.OutboxMessage, reason string) error {
+	switch msg.Type {
+	case repository.OutboxDecrementStock:
+		return d.repo.FailStockReservation(msg, reason, false)
+	case repository.OutboxRefundPayment:
+		return d.repo.FailRefund(msg, reason)
+	}
+	return d.repo.MarkOutboxMessageFailed(msg.ID, reason)
+}
+
+// permanent reports whether retrying err cannot succeed.
+func permanent(err error) bool {
+	if payments.IsDeclined(err) {
+		return true
+	}
+	switch status.Code(err) {
+	case codes.InvalidArgument, codes.NotFound, codes.FailedPrecondition, codes.OutOfRange:
+		return true
+	}
+	return false
+}
+
+func backoff(attempts int32) time.Duration {
+	delay := baseRetryDelay << attempts
+	if delay <= 0 || delay > maxRetryDelay {
+		return maxRetryDelay
+	}
+	return delay
+}
@@ -0,0 +1,181 @@
+package payments
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/money"
+)
+
+// FakeProviderName is the name of the built-in fake gateway.
+const FakeProviderName = "fake"
+
+// Outcome is how the fake gateway answers every call.
+type Outcome string
+
+const (
+	OutcomeSucceed Outcome = "succeed"
+	OutcomeDecline Outcome = "decline"
+	// OutcomeTimeout calls never answer; they block until their context ends.
+	OutcomeTimeout Outcome = "timeout"
+)
+
+// ParseOutcome returns the Outcome named by s.
+func ParseOutcome(s string) (Outcome, error) {
+	outcome := Outcome(strings.ToLower(strings.TrimSpace(s)))
+	switch outcome {
+	case OutcomeSucceed, OutcomeDecline, OutcomeTimeout:
+		return outcome, nil
+	}
+	return "", fmt.Errorf("unknown fake payment outcome %q", s)
+}
+
+// Fake is an in-memory payment gateway for local runs and tests. It keeps
+// track of what it authorized, captured and refunded, and declines operations
+// a real gateway would refuse, such as capturing more than was authorized.
+type Fake struct {
+	mu             sync.Mutex
+	outcome        Outcome
+	authorizations map[string]*fakeAuthorization
+	refunds        map[string]string
+}
+
+type fakeAuthorization struct {
+	amount   money.Money
+	captured money.Money
+	refunded money.Money
+	voided   bool
+}
+
+func NewFake(outcome Outcome) *Fake {
+	return &Fake{
+		outcome:        outcome,
+		authorizations: make(map[string]*fakeAuthorization),
+		refunds:        make(map[string]string),
+	}
+}
+
+// SetOutcome changes how subsequent calls are answered.
+func (f *Fake) SetOutcome(outcome Outcome) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.outcome = outcome
+}
+
+func (f *Fake) Name() string {
+	return FakeProviderName
+}
+
+func (f *Fake) Authorize(ctx context.Context, req AuthorizeRequest) (string, error) {
+	if err := f.answer(ctx); err != nil {
+		return "", err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	reference := "fake_auth_" + req.PaymentID
+	if _, ok := f.authorizations[reference]; !ok {
+		f.authorizations[reference] = &fakeAuthorization{
+			amount:   req.Amount,
+			captured: money.Zero(req.Amount.Currency),
+			refunded: money.Zero(req.Amount.Currency),
+		}
+	}
+	return reference, nil
+}
+
+func (f *Fake) Capture(ctx context.Context, reference string, amount money.Money) error {
+	if err := f.answer(ctx); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	auth, err := f.authorization(reference)
+	if err != nil {
+		return err
+	}
+	switch {
+	case auth.voided:
+		return &DeclineError{Reason: "authorization was voided"}
+	case auth.captured.Minor > 0:
+		// Captures are idempotent
+		return nil
+	case amount.Minor > auth.amount.Minor:
+		return &DeclineError{Reason: fmt.Sprintf("capture of %s exceeds authorized %s", amount, auth.amount)}
+	}
+	auth.captured = amount
+	return nil
+}
+
+func (f *Fake) Void(ctx context.Context, reference string) error {
+	if err := f.answer(ctx); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	auth, err := f.authorization(reference)
+	if err != nil {
+		return err
+	}
+	if auth.captured.Minor > 0 {
+		return &DeclineError{Reason: "authorization was already captured"}
+	}
+	auth.voided = true
+	return nil
+}
+
+func (f *Fake) Refund(ctx context.Context, reference, refundID string, amount money.Money) (string, error) {
+	if err := f.answer(ctx); err != nil {
+		return "", err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if refundReference, ok := f.refunds[refundID]; ok {
+		return refundReference, nil
+	}
+	auth, err := f.authorization(reference)
+	if err != nil {
+		return "", err
+	}
+	refundable := auth.captured.Minor - auth.refunded.Minor
+	if amount.Minor > refundable {
+		return "", &DeclineError{Reason: fmt.Sprintf("refund of %s exceeds refundable %s",
+			amount, money.New(refundable, auth.captured.Currency))}
+	}
+	auth.refunded.Minor += amount.Minor
+
+	refundReference := "fake_refund_" + uuid.New().String()
+	f.refunds[refundID] = refundReference
+	return refundReference, nil
+}
+
+// answer applies the configured outcome to a call.
+func (f *Fake) answer(ctx context.Context) error {
+	f.mu.Lock()
+	outcome := f.outcome
+	f.mu.Unlock()
+
+	switch outcome {
+	case OutcomeDecline:
+		return &DeclineError{Reason: "declined by fake gateway"}
+	case OutcomeTimeout:
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return nil
+}
+
+func (f *Fake) authorization(reference string) (*fakeAuthorization, error) {
+	auth, ok := f.authorizations[reference]
+	if !ok {
+		return nil, &DeclineError{Reason: fmt.Sprintf("unknown authorization %s", reference)}
+	}
+	return auth, nil
+}
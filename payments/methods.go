@@ -0,0 +1,30 @@
+package payments
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Payment methods an order can be paid with
+const (
+	// MethodOnline orders are paid through the payment provider.
+	MethodOnline = "ONLINE"
+	// MethodCOD orders are paid in cash on delivery and take no payment.
+	MethodCOD = "COD"
+	// MethodWallet orders are paid from the user's wallet.
+	MethodWallet = "WALLET"
+)
+
+// WalletProviderName is the provider recorded on payments taken from a
+// wallet. They are captured and released by this service itself.
+const WalletProviderName = "wallet"
+
+// ParseMethod normalises s and returns the matching payment method.
+func ParseMethod(s string) (string, error) {
+	method := strings.ToUpper(strings.TrimSpace(s))
+	switch method {
+	case MethodOnline, MethodCOD, MethodWallet:
+		return method, nil
+	}
+	return "", fmt.Errorf("unknown payment method %q", s)
+}
@@ -0,0 +1,143 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/money"
+)
+
+// Payment statuses
+const (
+	// StatusPending payments are being authorized with the provider.
+	StatusPending = "PENDING"
+	// StatusAuthorized payments hold the amount on the user's instrument
+	// until they are captured or voided.
+	StatusAuthorized = "AUTHORIZED"
+	StatusCaptured   = "CAPTURED"
+	StatusVoided     = "VOIDED"
+	// StatusPartiallyRefunded payments had part of their captured amount
+	// refunded; StatusRefunded payments all of it.
+	StatusPartiallyRefunded = "PARTIALLY_REFUNDED"
+	StatusRefunded          = "REFUNDED"
+	// StatusDeclined payments were refused by the provider; StatusFailed
+	// payments could not be authorized for any other reason.
+	StatusDeclined = "DECLINED"
+	StatusFailed   = "FAILED"
+)
+
+// Refund statuses
+const (
+	RefundPending   = "PENDING"
+	RefundCompleted = "COMPLETED"
+	RefundFailed    = "FAILED"
+)
+
+// ErrTimeout is returned when the provider does not answer in time. The
+// outcome of the operation is unknown.
+var ErrTimeout = errors.New("payment provider timed out")
+
+// DeclineError reports that the provider refused an operation. Retrying it
+// cannot succeed.
+type DeclineError struct {
+	Reason string
+}
+
+func (e *DeclineError) Error() string {
+	return fmt.Sprintf("payment declined: %s", e.Reason)
+}
+
+// IsDeclined reports whether err's chain contains a DeclineError.
+func IsDeclined(err error) bool {
+	var decline *DeclineError
+	return errors.As(err, &decline)
+}
+
+// IsOutcomeUnknown reports whether err leaves the outcome of an operation
+// unknown: the provider did not answer in time or could not be reached, or
+// the call was abandoned, so it may have been carried out all the same.
+func IsOutcomeUnknown(err error) bool {
+	if errors.Is(err, ErrTimeout) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return true
+	}
+	switch status.Code(err) {
+	case codes.DeadlineExceeded, codes.Unavailable, codes.Canceled:
+		return true
+	}
+	return false
+}
+
+// AuthorizeRequest describes the amount to hold for an order.
+type AuthorizeRequest struct {
+	// PaymentID identifies the payment and lets the provider deduplicate
+	// retried authorizations.
+	PaymentID string
+	OrderID   string
+	UserID    string
+	Amount    money.Money
+}
+
+// Provider is a payment gateway. Authorize holds an amount and returns the
+// provider's reference for it, which the other operations act on.
+type Provider interface {
+	Name() string
+	Authorize(ctx context.Context, req AuthorizeRequest) (string, error)
+	Capture(ctx context.Context, reference string, amount money.Money) error
+	Void(ctx context.Context, reference string) error
+	// Refund returns amount of a captured payment. refundID lets the provider
+	// deduplicate retried refunds; the provider's refund reference is returned.
+	Refund(ctx context.Context, reference, refundID string, amount money.Money) (string, error)
+}
+
+// WithTimeout bounds every call to provider by timeout, reporting calls that
+// run out of time as ErrTimeout.
+func WithTimeout(provider Provider, timeout time.Duration) Provider {
+	return &timeoutProvider{provider: provider, timeout: timeout}
+}
+
+type timeoutProvider struct {
+	provider Provider
+	timeout  time.Duration
+}
+
+func (p *timeoutProvider) Name() string {
+	return p.provider.Name()
+}
+
+func (p *timeoutProvider) Authorize(ctx context.Context, req AuthorizeRequest) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	reference, err := p.provider.Authorize(ctx, req)
+	return reference, timeoutErr(ctx, err)
+}
+
+func (p *timeoutProvider) Capture(ctx context.Context, reference string, amount money.Money) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	return timeoutErr(ctx, p.provider.Capture(ctx, reference, amount))
+}
+
+func (p *timeoutProvider) Void(ctx context.Context, reference string) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	return timeoutErr(ctx, p.provider.Void(ctx, reference))
+}
+
+func (p *timeoutProvider) Refund(ctx context.Context, reference, refundID string, amount money.Money) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	refundReference, err := p.provider.Refund(ctx, reference, refundID, amount)
+	return refundReference, timeoutErr(ctx, err)
+}
+
+func timeoutErr(ctx context.Context, err error) error {
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return ErrTimeout
+	}
+	return err
+}
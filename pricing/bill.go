@@ -0,0 +1,219 @@
+package pricing
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/models"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/money"
+)
+
+// Charge types of the order charges frozen from a bill.
+const (
+	ChargeDiscount  = "DISCOUNT"
+	ChargeTax       = "TAX"
+	ChargePackaging = "PACKAGING"
+	ChargeDelivery  = "DELIVERY"
+)
+
+// Discount is an amount taken off the item subtotal, such as a coupon.
+type Discount struct {
+	Code   string
+	Amount money.Money
+}
+
+// Options are the inputs to a quote besides the lines themselves.
+type Options struct {
+	// Pincode selects the delivery band. An empty pincode gets the default
+	// delivery fee.
+	Pincode   string
+	Discounts []Discount
+}
+
+// BillLine is a line of a bill with its share of the discount and its tax.
+type BillLine struct {
+	Line
+	Amount   money.Money
+	Discount money.Money
+	TaxRate  int64
+	Tax      money.Money
+}
+
+// TaxLine is the tax charged at one rate over the lines taxed at that rate.
+type TaxLine struct {
+	Rate    int64
+	Taxable money.Money
+	Amount  money.Money
+}
+
+// Bill is an itemized price for a set of lines.
+type Bill struct {
+	Lines        []BillLine
+	Subtotal     money.Money
+	Discounts    []Discount
+	Discount     money.Money
+	Taxes        []TaxLine
+	Tax          money.Money
+	Packaging    money.Money
+	DeliveryBand string
+	DeliveryFee  money.Money
+	GrandTotal   money.Money
+}
+
+// Engine prices carts and orders under a set of rules.
+type Engine struct {
+	rules Rules
+}
+
+func NewEngine(rules Rules) *Engine {
+	return &Engine{rules: rules}
+}
+
+// Quote returns the bill for lines. Discounts are applied in order up to the
+// subtotal and spread over the lines in proportion to their amount, and tax
+// is charged on the discounted amount of each line at its category's rate.
+// Packaging and delivery are only charged for a non-empty bill.
+func (e *Engine) Quote(lines []Line, opts Options) (*Bill, error) {
+	subtotal, err := Total(lines)
+	if err != nil {
+		return nil, err
+	}
+	currency := subtotal.Currency
+
+	bill := &Bill{
+		Subtotal:    subtotal,
+		Discount:    money.Zero(currency),
+		Tax:         money.Zero(currency),
+		Packaging:   money.Zero(currency),
+		DeliveryFee: money.Zero(currency),
+	}
+
+	// Apply discounts in order until they use up the subtotal
+	for _, discount := range opts.Discounts {
+		if discount.Amount.Minor > subtotal.Minor-bill.Discount.Minor {
+			discount.Amount.Minor = subtotal.Minor - bill.Discount.Minor
+		}
+		if discount.Amount.Minor <= 0 {
+			continue
+		}
+		if bill.Discount, err = bill.Discount.Add(discount.Amount); err != nil {
+			return nil, err
+		}
+		bill.Discounts = append(bill.Discounts, discount)
+	}
+
+	// Spread the discount over the lines and tax what remains
+	taxes := make(map[int64]*TaxLine)
+	remaining := bill.Discount
+	var units int64
+	for i, line := range lines {
+		billLine := BillLine{Line: line, Amount: line.Amount(), TaxRate: e.rules.taxRate(line.Category)}
+		if i == len(lines)-1 {
+			billLine.Discount = remaining
+		} else if subtotal.Minor > 0 {
+			billLine.Discount = bill.Discount.MulDiv(billLine.Amount.Minor, subtotal.Minor)
+		}
+		remaining.Minor -= billLine.Discount.Minor
+
+		taxable, err := billLine.Amount.Sub(billLine.Discount)
+		if err != nil {
+			return nil, err
+		}
+		billLine.Tax = taxable.MulDiv(billLine.TaxRate, basisPointsPerUnit)
+		bill.Lines = append(bill.Lines, billLine)
+		units += int64(line.Quantity)
+
+		if billLine.TaxRate == 0 {
+			continue
+		}
+		tax, ok := taxes[billLine.TaxRate]
+		if !ok {
+			tax = &TaxLine{Rate: billLine.TaxRate, Taxable: money.Zero(currency), Amount: money.Zero(currency)}
+			taxes[billLine.TaxRate] = tax
+		}
+		tax.Taxable.Minor += taxable.Minor
+		tax.Amount.Minor += billLine.Tax.Minor
+		bill.Tax.Minor += billLine.Tax.Minor
+	}
+	for _, tax := range taxes {
+		bill.Taxes = append(bill.Taxes, *tax)
+	}
+	sort.Slice(bill.Taxes, func(i, j int) bool { return bill.Taxes[i].Rate < bill.Taxes[j].Rate })
+
+	if len(lines) > 0 {
+		bill.Packaging = e.rules.PackagingPerUnit.Times(units)
+		bill.DeliveryBand, bill.DeliveryFee = e.rules.deliveryFee(opts.Pincode)
+	}
+
+	bill.GrandTotal = subtotal
+	for _, amount := range []money.Money{bill.Discount.Times(-1), bill.Tax, bill.Packaging, bill.DeliveryFee} {
+		if bill.GrandTotal, err = bill.GrandTotal.Add(amount); err != nil {
+			return nil, err
+		}
+	}
+	return bill, nil
+}
+
+// Charges returns the bill's charges on top of the items as order charges, in
+// the order they appear on a receipt. Zero charges are omitted.
+func (b *Bill) Charges(orderID string) []models.OrderCharge {
+	var charges []models.OrderCharge
+	add := func(chargeType, label string, rate int64, amount money.Money) {
+		if amount.IsZero() {
+			return
+		}
+		charges = append(charges, models.OrderCharge{
+			OrderID: orderID,
+			Type:    chargeType,
+			Label:   label,
+			Rate:    rate,
+			Amount:  amount,
+		})
+	}
+
+	for _, discount := range b.Discounts {
+		add(ChargeDiscount, discount.Code, 0, discount.Amount.Times(-1))
+	}
+	for _, tax := range b.Taxes {
+		add(ChargeTax, fmt.Sprintf("Tax %s%%", formatRate(tax.Rate)), tax.Rate, tax.Amount)
+	}
+	add(ChargePackaging, "Packaging", 0, b.Packaging)
+	add(ChargeDelivery, "Delivery", 0, b.DeliveryFee)
+	return charges
+}
+
+// FreezeItems copies each bill line's share of the discount and its tax onto
+// the order item it was quoted from. items must be the items the bill was
+// quoted for, in the same order.
+func (b *Bill) FreezeItems(items []models.OrderItem) {
+	for i := range items {
+		items[i].Discount = b.Lines[i].Discount
+		items[i].Tax = b.Lines[i].Tax
+	}
+}
+
+// PaidAmounts returns what was paid for each of items: its amount less its
+// share of the discount, plus its tax, as frozen onto it when it was ordered.
+// Items ordered before the discount and tax were frozen paid their amount.
+func PaidAmounts(items []models.OrderItem) []money.Money {
+	paid := make([]money.Money, len(items))
+	for i, line := range OrderLines(items) {
+		amount := line.Amount()
+		amount.Minor += items[i].Tax.Minor - items[i].Discount.Minor
+		paid[i] = amount
+	}
+	return paid
+}
+
+// formatRate formats a rate in basis points as a percentage, e.g. 250 as "2.5".
+func formatRate(rate int64) string {
+	whole, fraction := rate/100, rate%100
+	switch {
+	case fraction == 0:
+		return fmt.Sprintf("%d", whole)
+	case fraction%10 == 0:
+		return fmt.Sprintf("%d.%d", whole, fraction/10)
+	default:
+		return fmt.Sprintf("%d.%02d", whole, fraction)
+	}
+}
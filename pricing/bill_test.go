@@ -0,0 +1,217 @@
+package pricing
+
+import (
+	"testing"
+
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/models"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/money"
+)
+
+func inr(minor int64) money.Money {
+	return money.New(minor, money.DefaultCurrency)
+}
+
+func testEngine(t *testing.T) *Engine {
+	t.Helper()
+	rules, err := ParseRules("default:5,beverages:18", "2.50", "30", "56:40,5600:20")
+	if err != nil {
+		t.Fatalf("ParseRules: %v", err)
+	}
+	return NewEngine(rules)
+}
+
+func TestQuote(t *testing.T) {
+	lines := []Line{
+		{ProductID: "p1", Category: "Food", UnitPrice: inr(10000), Quantity: 2},
+		{ProductID: "p2", Category: "Beverages", UnitPrice: inr(5000), Quantity: 1},
+	}
+
+	tests := []struct {
+		name         string
+		opts         Options
+		wantDiscount int64
+		wantTax      int64
+		wantBand     string
+		wantDelivery int64
+		wantTotal    int64
+	}{
+		{
+			name:         "default delivery fee",
+			wantTax:      1000 + 900,
+			wantDelivery: 3000,
+			wantTotal:    25000 + 1900 + 750 + 3000,
+		},
+		{
+			name:         "longest matching delivery band",
+			opts:         Options{Pincode: "560001"},
+			wantTax:      1900,
+			wantBand:     "5600",
+			wantDelivery: 2000,
+			wantTotal:    25000 + 1900 + 750 + 2000,
+		},
+		{
+			name:         "shorter delivery band",
+			opts:         Options{Pincode: "561001"},
+			wantTax:      1900,
+			wantBand:     "56",
+			wantDelivery: 4000,
+			wantTotal:    25000 + 1900 + 750 + 4000,
+		},
+		{
+			// The discount is spread 4000/1000 over the lines in proportion
+			// to their amount and tax is charged on what remains
+			name:         "discount before tax",
+			opts:         Options{Pincode: "560001", Discounts: []Discount{{Code: "SAVE50", Amount: inr(5000)}}},
+			wantDiscount: 5000,
+			wantTax:      800 + 720,
+			wantBand:     "5600",
+			wantDelivery: 2000,
+			wantTotal:    25000 - 5000 + 1520 + 750 + 2000,
+		},
+		{
+			name:         "discounts are capped at the subtotal",
+			opts:         Options{Discounts: []Discount{{Code: "A", Amount: inr(20000)}, {Code: "B", Amount: inr(20000)}}},
+			wantDiscount: 25000,
+			wantDelivery: 3000,
+			wantTotal:    750 + 3000,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bill, err := testEngine(t).Quote(lines, tt.opts)
+			if err != nil {
+				t.Fatalf("Quote: %v", err)
+			}
+			if bill.Subtotal != inr(25000) {
+				t.Errorf("Subtotal = %v, want INR 250.00", bill.Subtotal)
+			}
+			if bill.Discount.Minor != tt.wantDiscount {
+				t.Errorf("Discount = %v, want %d", bill.Discount, tt.wantDiscount)
+			}
+			if bill.Tax.Minor != tt.wantTax {
+				t.Errorf("Tax = %v, want %d", bill.Tax, tt.wantTax)
+			}
+			if bill.Packaging.Minor != 750 {
+				t.Errorf("Packaging = %v, want 750", bill.Packaging)
+			}
+			if bill.DeliveryBand != tt.wantBand || bill.DeliveryFee.Minor != tt.wantDelivery {
+				t.Errorf("Delivery = %q %v, want %q %d", bill.DeliveryBand, bill.DeliveryFee, tt.wantBand, tt.wantDelivery)
+			}
+			if bill.GrandTotal.Minor != tt.wantTotal {
+				t.Errorf("GrandTotal = %v, want %d", bill.GrandTotal, tt.wantTotal)
+			}
+		})
+	}
+}
+
+func TestQuoteEmpty(t *testing.T) {
+	bill, err := testEngine(t).Quote(nil, Options{Pincode: "560001"})
+	if err != nil {
+		t.Fatalf("Quote: %v", err)
+	}
+	if !bill.GrandTotal.IsZero() || !bill.Packaging.IsZero() || !bill.DeliveryFee.IsZero() {
+		t.Errorf("empty bill = %+v, want nothing charged", bill)
+	}
+}
+
+func TestCharges(t *testing.T) {
+	bill, err := testEngine(t).Quote([]Line{
+		{ProductID: "p1", Category: "Food", UnitPrice: inr(10000), Quantity: 1},
+	}, Options{Discounts: []Discount{{Code: "SAVE10", Amount: inr(1000)}}})
+	if err != nil {
+		t.Fatalf("Quote: %v", err)
+	}
+
+	charges := bill.Charges("order_1")
+	want := []struct {
+		chargeType string
+		label      string
+		amount     int64
+	}{
+		{ChargeDiscount, "SAVE10", -1000},
+		{ChargeTax, "Tax 5%", 450},
+		{ChargePackaging, "Packaging", 250},
+		{ChargeDelivery, "Delivery", 3000},
+	}
+	if len(charges) != len(want) {
+		t.Fatalf("got %d charges, want %d: %+v", len(charges), len(want), charges)
+	}
+	for i, w := range want {
+		c := charges[i]
+		if c.OrderID != "order_1" || c.Type != w.chargeType || c.Label != w.label || c.Amount.Minor != w.amount {
+			t.Errorf("charge %d = %s %q %v, want %s %q %d", i, c.Type, c.Label, c.Amount, w.chargeType, w.label, w.amount)
+		}
+	}
+}
+
+func TestPaidAmounts(t *testing.T) {
+	items := []models.OrderItem{
+		{ProductID: "p1", Category: "Food", Price: inr(10000), Quantity: 1},
+		{ProductID: "p2", Category: "Beverages", Price: inr(10000), Quantity: 1},
+	}
+
+	tests := []struct {
+		name string
+		opts Options
+		want []int64
+	}{
+		{
+			// Each item pays the tax of its own category
+			name: "two tax rates",
+			want: []int64{10000 + 500, 10000 + 1800},
+		},
+		{
+			name: "discount before tax",
+			opts: Options{Discounts: []Discount{{Code: "SAVE50", Amount: inr(5000)}}},
+			want: []int64{7500 + 375, 7500 + 1350},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ordered := append([]models.OrderItem(nil), items...)
+			bill, err := testEngine(t).Quote(OrderLines(ordered), tt.opts)
+			if err != nil {
+				t.Fatalf("Quote: %v", err)
+			}
+			bill.FreezeItems(ordered)
+
+			paid := PaidAmounts(ordered)
+			var total int64
+			for i, want := range tt.want {
+				if paid[i].Minor != want {
+					t.Errorf("item %d paid %v, want %d", i, paid[i], want)
+				}
+				total += paid[i].Minor
+			}
+			if want := bill.Subtotal.Minor - bill.Discount.Minor + bill.Tax.Minor; total != want {
+				t.Errorf("items paid %d in total, want %d", total, want)
+			}
+		})
+	}
+
+	legacy := PaidAmounts(items)
+	if legacy[0].Minor != 10000 || legacy[1].Minor != 10000 {
+		t.Errorf("items without frozen discount and tax paid %v, want their amounts", legacy)
+	}
+}
+
+func TestParseRulesErrors(t *testing.T) {
+	tests := []struct {
+		name                                string
+		tax, packaging, delivery, deliveryB string
+	}{
+		{"tax rate without category", "5", "", "", ""},
+		{"tax rate over 100", "default:101", "", "", ""},
+		{"negative packaging fee", "", "-1", "", ""},
+		{"malformed delivery fee", "", "", "abc", ""},
+		{"delivery band without fee", "", "", "", "56:"},
+	}
+
+	for _, tt := range tests {
+		if _, err := ParseRules(tt.tax, tt.packaging, tt.delivery, tt.deliveryB); err == nil {
+			t.Errorf("%s: ParseRules succeeded", tt.name)
+		}
+	}
+}
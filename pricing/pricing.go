@@ -0,0 +1,86 @@
+package pricing
+
+import (
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/models"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/money"
+)
+
+// Line is a priced quantity of one product.
+type Line struct {
+	ProductID   string
+	ProductName string
+	Category    string
+	UnitPrice   money.Money
+	Quantity    int32
+}
+
+// Amount returns unit price × quantity.
+func (l Line) Amount() money.Money {
+	return l.UnitPrice.Times(int64(l.Quantity))
+}
+
+// UnitPrice returns the price of one unit of a product with the given
+// options selected.
+func UnitPrice(price money.Money, options models.LineOptions) money.Money {
+	for _, option := range options {
+		price.Minor += option.PriceDelta.Minor
+	}
+	return price
+}
+
+// Total returns the sum of unit price × quantity over lines. Every cart and
+// order total is computed here so they always agree to the minor unit.
+func Total(lines []Line) (money.Money, error) {
+	total := money.Zero(money.DefaultCurrency)
+	if len(lines) > 0 {
+		total = money.Zero(lines[0].UnitPrice.Currency)
+	}
+	for _, line := range lines {
+		var err error
+		total, err = total.Add(line.Amount())
+		if err != nil {
+			return money.Money{}, err
+		}
+	}
+	return total, nil
+}
+
+// CartLines returns the priced lines of a set of cart items.
+func CartLines(items []models.CartItem) []Line {
+	lines := make([]Line, len(items))
+	for i, item := range items {
+		lines[i] = Line{
+			ProductID:   item.ProductID,
+			ProductName: item.ProductName,
+			Category:    item.Category,
+			UnitPrice:   UnitPrice(item.Price, item.Options),
+			Quantity:    item.Quantity,
+		}
+	}
+	return lines
+}
+
+// OrderLines returns the priced lines of a set of order items.
+func OrderLines(items []models.OrderItem) []Line {
+	lines := make([]Line, len(items))
+	for i, item := range items {
+		lines[i] = Line{
+			ProductID:   item.ProductID,
+			ProductName: item.ProductName,
+			Category:    item.Category,
+			UnitPrice:   UnitPrice(item.Price, item.Options),
+			Quantity:    item.Quantity,
+		}
+	}
+	return lines
+}
+
+// CartTotal returns the total of a set of cart items.
+func CartTotal(items []models.CartItem) (money.Money, error) {
+	return Total(CartLines(items))
+}
+
+// OrderTotal returns the total of a set of order items.
+func OrderTotal(items []models.OrderItem) (money.Money, error) {
+	return Total(OrderLines(items))
+}
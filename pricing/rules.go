@@ -0,0 +1,128 @@
+package pricing
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/money"
+)
+
+// basisPointsPerUnit is the number of basis points in a rate of 1.
+const basisPointsPerUnit = 10000
+
+// defaultCategory is the tax rate key applied to categories without a rate
+// of their own.
+const defaultCategory = "default"
+
+// DeliveryBand is the delivery fee charged for pincodes starting with
+// PincodePrefix. Bands approximate distance from the restaurant's area.
+type DeliveryBand struct {
+	PincodePrefix string
+	Fee           money.Money
+}
+
+// Rules are the charges added on top of the price of the items.
+type Rules struct {
+	// TaxRates maps a lowercase product category to its tax rate in basis
+	// points. The "default" entry applies to every other category.
+	TaxRates map[string]int64
+	// PackagingPerUnit is charged for every unit ordered.
+	PackagingPerUnit money.Money
+	// DeliveryBands are matched by longest pincode prefix; DeliveryFee is
+	// charged when no band matches.
+	DeliveryBands []DeliveryBand
+	DeliveryFee   money.Money
+}
+
+// taxRate returns the tax rate for category in basis points.
+func (r Rules) taxRate(category string) int64 {
+	if rate, ok := r.TaxRates[strings.ToLower(strings.TrimSpace(category))]; ok {
+		return rate
+	}
+	return r.TaxRates[defaultCategory]
+}
+
+// deliveryFee returns the delivery band and fee for pincode.
+func (r Rules) deliveryFee(pincode string) (string, money.Money) {
+	band, fee := "", r.DeliveryFee
+	for _, b := range r.DeliveryBands {
+		if strings.HasPrefix(pincode, b.PincodePrefix) && len(b.PincodePrefix) > len(band) {
+			band, fee = b.PincodePrefix, b.Fee
+		}
+	}
+	return band, fee
+}
+
+// ParseRules builds Rules from their configuration strings:
+//   - taxRates: comma separated category:percent pairs, e.g. "default:5,beverages:18"
+//   - packagingFee and deliveryFee: amounts in major units, e.g. "2.50"
+//   - deliveryBands: comma separated pincode-prefix:fee pairs, e.g. "6820:20,68:35"
+func ParseRules(taxRates, packagingFee, deliveryFee, deliveryBands string) (Rules, error) {
+	rules := Rules{TaxRates: make(map[string]int64)}
+
+	for _, pair := range splitList(taxRates) {
+		category, value, err := splitPair(pair)
+		if err != nil {
+			return Rules{}, fmt.Errorf("invalid tax rate %q: %w", pair, err)
+		}
+		percent, err := strconv.ParseFloat(value, 64)
+		if err != nil || percent < 0 || percent > 100 {
+			return Rules{}, fmt.Errorf("invalid tax rate %q", pair)
+		}
+		rules.TaxRates[strings.ToLower(category)] = int64(math.Round(percent * basisPointsPerUnit / 100))
+	}
+
+	var err error
+	if rules.PackagingPerUnit, err = parseAmount(packagingFee); err != nil {
+		return Rules{}, fmt.Errorf("invalid packaging fee: %w", err)
+	}
+	if rules.DeliveryFee, err = parseAmount(deliveryFee); err != nil {
+		return Rules{}, fmt.Errorf("invalid delivery fee: %w", err)
+	}
+
+	for _, pair := range splitList(deliveryBands) {
+		prefix, value, err := splitPair(pair)
+		if err != nil {
+			return Rules{}, fmt.Errorf("invalid delivery band %q: %w", pair, err)
+		}
+		fee, err := parseAmount(value)
+		if err != nil {
+			return Rules{}, fmt.Errorf("invalid delivery band %q: %w", pair, err)
+		}
+		rules.DeliveryBands = append(rules.DeliveryBands, DeliveryBand{PincodePrefix: prefix, Fee: fee})
+	}
+
+	return rules, nil
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func splitPair(pair string) (string, string, error) {
+	key, value, ok := strings.Cut(pair, ":")
+	key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+	if !ok || key == "" || value == "" {
+		return "", "", fmt.Errorf("expected key:value")
+	}
+	return key, value, nil
+}
+
+func parseAmount(value string) (money.Money, error) {
+	if strings.TrimSpace(value) == "" {
+		return money.Zero(money.DefaultCurrency), nil
+	}
+	amount, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || amount < 0 {
+		return money.Money{}, fmt.Errorf("invalid amount %q", value)
+	}
+	return money.FromMajor(amount, money.DefaultCurrency), nil
+}
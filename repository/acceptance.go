@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/models"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/orderstate"
+)
+
+// pendingSince is when an order started waiting for the restaurant. Orders
+// that became pending before pending_since was recorded fall back to their
+// creation time.
+const pendingSince = "COALESCE(pending_since, created_at)"
+
+// FindUnacceptedOrders returns the IDs of up to limit pending orders that have
+// been waiting for their restaurant since before cutoff, longest waiting
+// first, leaving out the orders in skip. overrides maps restaurant IDs to the
+// cutoff used for their orders instead.
+func (r *orderCartRepo) FindUnacceptedOrders(cutoff time.Time, overrides map[string]time.Time, skip []string, limit int) ([]string, error) {
+	expired := r.db.Where(pendingSince+" <= ?", cutoff)
+	if len(overrides) > 0 {
+		restaurantIDs := make([]string, 0, len(overrides))
+		for restaurantID := range overrides {
+			restaurantIDs = append(restaurantIDs, restaurantID)
+		}
+		sort.Strings(restaurantIDs)
+
+		expired = r.db.Where("restaurant_id NOT IN ? AND "+pendingSince+" <= ?", restaurantIDs, cutoff)
+		for _, restaurantID := range restaurantIDs {
+			expired = expired.Or("restaurant_id = ? AND "+pendingSince+" <= ?", restaurantID, overrides[restaurantID])
+		}
+	}
+
+	query := r.db.Model(&models.Order{}).
+		Where("order_status = ?", string(orderstate.Pending)).
+		Where(expired)
+	if len(skip) > 0 {
+		query = query.Where("order_id NOT IN ?", skip)
+	}
+	var orderIDs []string
+	err := query.
+		Order(pendingSince+", id").
+		Limit(limit).
+		Pluck("order_id", &orderIDs).Error
+	return orderIDs, err
+}
+
+// ExpireUnacceptedOrder cancels a pending order the restaurant did not accept
+// in time on behalf of the system, gives its stock back, releases its payment
+// and notifies the user with message, all in one transaction. The order row is
+// locked with SKIP LOCKED so that replicas running the same check, or a
+// restaurant confirming the order at that moment, never race on it. It
+// reports whether the order was cancelled; orders that are locked elsewhere or
+// no longer pending are left alone.
+func (r *orderCartRepo) ExpireUnacceptedOrder(orderID, reason, message string) (bool, error) {
+	var expired bool
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var order models.Order
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("order_id = ?", orderID).
+			First(&order).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if order.OrderStatus != string(orderstate.Pending) {
+			return nil
+		}
+
+		err = cancelOrder(tx, &models.OrderStatusEvent{
+			OrderID:    order.OrderID,
+			FromStatus: order.OrderStatus,
+			ToStatus:   string(orderstate.Cancelled),
+			ActorType:  string(orderstate.ActorSystem),
+			Reason:     reason,
+		}, map[string]interface{}{
+			"order_status":  string(orderstate.Cancelled),
+			"cancel_reason": reason,
+		})
+		if err != nil {
+			return err
+		}
+		if err := enqueueUserNotification(tx, &order, message); err != nil {
+			return err
+		}
+		expired = true
+		return nil
+	})
+	return expired, err
+}
@@ -0,0 +1,276 @@
+package repository
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/models"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/pricing"
+)
+
+// CartKey identifies a user's cart at one restaurant.
+type CartKey struct {
+	UserID       string
+	RestaurantID string
+}
+
+// CartSummary describes a cart and the value of its items.
+type CartSummary struct {
+	UserID         string
+	RestaurantID   string
+	LineCount      int64
+	TotalQuantity  int64
+	ValueMinor     int64
+	Currency       string
+	LastActivityAt time.Time
+}
+
+// FindStaleCarts returns up to limit carts whose items were all last touched
+// before cutoff.
+func (r *orderCartRepo) FindStaleCarts(cutoff time.Time, limit int) ([]CartKey, error) {
+	var keys []CartKey
+	err := r.db.Model(&models.CartItem{}).
+		Select("user_id, restaurant_id").
+		Group("user_id, restaurant_id").
+		Having("MAX(updated_at) < ?", cutoff).
+		Limit(limit).
+		Scan(&keys).Error
+	return keys, err
+}
+
+// SweepCart removes a stale cart, copying its items to the archive first if
+// archive is set. The cart is locked and skipped if any item was touched at
+// or after cutoff in the meantime. It returns the number of items removed.
+func (r *orderCartRepo) SweepCart(key CartKey, cutoff time.Time, archive bool) (int64, error) {
+	var removed int64
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var items []models.CartItem
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND restaurant_id = ?", key.UserID, key.RestaurantID).
+			Find(&items).Error
+		if err != nil {
+			return err
+		}
+
+		var lastActivity time.Time
+		ids := make([]uint, len(items))
+		for i, item := range items {
+			if item.UpdatedAt.After(lastActivity) {
+				lastActivity = item.UpdatedAt
+			}
+			ids[i] = item.ID
+		}
+		if len(items) == 0 || !lastActivity.Before(cutoff) {
+			return nil
+		}
+
+		if archive {
+			archived := make([]models.ArchivedCartItem, len(items))
+			for i, item := range items {
+				archived[i] = models.ArchivedCartItem{
+					CartItemID:          item.ID,
+					UserID:              item.UserID,
+					ProductID:           item.ProductID,
+					RestaurantID:        item.RestaurantID,
+					ProductName:         item.ProductName,
+					Category:            item.Category,
+					Price:               item.Price,
+					Quantity:            item.Quantity,
+					LastActivityAt:      lastActivity,
+					LineKey:             item.LineKey,
+					Options:             item.Options,
+					SpecialInstructions: item.SpecialInstructions,
+				}
+			}
+			if err := tx.Create(&archived).Error; err != nil {
+				return err
+			}
+		}
+
+		result := tx.Unscoped().Where("id IN ?", ids).Delete(&models.CartItem{})
+		if result.Error != nil {
+			return result.Error
+		}
+		removed = result.RowsAffected
+
+		err = tx.Unscoped().
+			Where("user_id = ? AND restaurant_id = ?", key.UserID, key.RestaurantID).
+			Delete(&models.CartCoupon{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Unscoped().
+			Where("user_id = ? AND restaurant_id = ?", key.UserID, key.RestaurantID).
+			Delete(&models.CartInstructions{}).Error
+	})
+	return removed, err
+}
+
+// PurgeDeletedCartItems hard-deletes up to limit cart items that were removed
+// from their cart before cutoff, returning the number deleted.
+func (r *orderCartRepo) PurgeDeletedCartItems(cutoff time.Time, limit int) (int64, error) {
+	var ids []uint
+	err := r.db.Unscoped().Model(&models.CartItem{}).
+		Where("deleted_at < ?", cutoff).
+		Limit(limit).
+		Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+	result := r.db.Unscoped().Where("id IN ?", ids).Delete(&models.CartItem{})
+	return result.RowsAffected, result.Error
+}
+
+// GetAbandonedCarts returns carts idle since before idleSince and worth at
+// least minValueMinor, most valuable first. Carts are valued in Go with the
+// price deltas of their lines' options, which are stored as JSON.
+func (r *orderCartRepo) GetAbandonedCarts(idleSince time.Time, minValueMinor int64, limit, offset int) ([]CartSummary, error) {
+	idle := r.db.Model(&models.CartItem{}).
+		Select("user_id, restaurant_id").
+		Group("user_id, restaurant_id").
+		Having("MAX(updated_at) < ?", idleSince)
+	var items []models.CartItem
+	err := r.db.
+		Joins("JOIN (?) AS idle ON idle.user_id = cart_items.user_id AND idle.restaurant_id = cart_items.restaurant_id", idle).
+		Find(&items).Error
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make(map[CartKey]*CartSummary)
+	var carts []*CartSummary
+	for _, item := range items {
+		key := CartKey{UserID: item.UserID, RestaurantID: item.RestaurantID}
+		cart, ok := summaries[key]
+		if !ok {
+			cart = &CartSummary{UserID: item.UserID, RestaurantID: item.RestaurantID, Currency: item.Price.Currency}
+			summaries[key] = cart
+			carts = append(carts, cart)
+		}
+		cart.LineCount++
+		cart.TotalQuantity += int64(item.Quantity)
+		cart.ValueMinor += pricing.UnitPrice(item.Price, item.Options).Minor * int64(item.Quantity)
+		if item.UpdatedAt.After(cart.LastActivityAt) {
+			cart.LastActivityAt = item.UpdatedAt
+		}
+	}
+
+	var abandoned []CartSummary
+	for _, cart := range carts {
+		if cart.ValueMinor >= minValueMinor {
+			abandoned = append(abandoned, *cart)
+		}
+	}
+	sort.Slice(abandoned, func(i, j int) bool {
+		if abandoned[i].ValueMinor != abandoned[j].ValueMinor {
+			return abandoned[i].ValueMinor > abandoned[j].ValueMinor
+		}
+		return abandoned[i].LastActivityAt.Before(abandoned[j].LastActivityAt)
+	})
+
+	if offset >= len(abandoned) {
+		return nil, nil
+	}
+	abandoned = abandoned[offset:]
+	if limit > 0 && limit < len(abandoned) {
+		abandoned = abandoned[:limit]
+	}
+	return abandoned, nil
+}
+
+// GetCartInstructions returns the instructions left on a cart, or nil if
+// there are none.
+func (r *orderCartRepo) GetCartInstructions(userID, restaurantID string) (*models.CartInstructions, error) {
+	var instructions models.CartInstructions
+	err := r.db.Where("user_id = ? AND restaurant_id = ?", userID, restaurantID).First(&instructions).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &instructions, nil
+}
+
+// SetCartInstructions saves the instructions left on a cart, replacing any
+// left before.
+func (r *orderCartRepo) SetCartInstructions(instructions *models.CartInstructions) error {
+	return r.db.Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"delivery_instructions", "kitchen_note", "updated_at"}),
+	}).Create(instructions).Error
+}
+
+func (r *orderCartRepo) RemoveCartInstructions(userID, restaurantID string) error {
+	return r.db.Unscoped().Where("user_id = ? AND restaurant_id = ?", userID, restaurantID).Delete(&models.CartInstructions{}).Error
+}
+
+// restoreCart puts the items, coupon and instructions of an order that failed
+// before it was paid back into the user's cart, so that they can try again.
+// Items are merged into matching lines added since; a coupon or instructions
+// set since are kept. It must run before the order's coupon redemption is
+// released.
+func restoreCart(tx *gorm.DB, order *models.Order) error {
+	for _, item := range order.OrderItems {
+		var existing models.CartItem
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND restaurant_id = ? AND product_id = ? AND line_key = ?", order.UserID, order.RestaurantID, item.ProductID, item.LineKey).
+			Limit(1).
+			Find(&existing)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			existing.Quantity += item.Quantity
+			if err := tx.Save(&existing).Error; err != nil {
+				return err
+			}
+			continue
+		}
+
+		err := tx.Create(&models.CartItem{
+			UserID:              order.UserID,
+			ProductID:           item.ProductID,
+			RestaurantID:        order.RestaurantID,
+			ProductName:         item.ProductName,
+			Description:         item.Description,
+			Category:            item.Category,
+			Price:               item.Price,
+			Quantity:            item.Quantity,
+			LineKey:             item.LineKey,
+			Options:             item.Options,
+			SpecialInstructions: item.SpecialInstructions,
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	var redemptions []models.CouponRedemption
+	if err := tx.Where("order_id = ?", order.OrderID).Limit(1).Find(&redemptions).Error; err != nil {
+		return err
+	}
+	if len(redemptions) > 0 {
+		err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.CartCoupon{
+			UserID:       order.UserID,
+			RestaurantID: order.RestaurantID,
+			CouponCode:   redemptions[0].CouponCode,
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	if order.DeliveryInstructions == "" && order.KitchenNote == "" {
+		return nil
+	}
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.CartInstructions{
+		UserID:               order.UserID,
+		RestaurantID:         order.RestaurantID,
+		DeliveryInstructions: order.DeliveryInstructions,
+		KitchenNote:          order.KitchenNote,
+	}).Error
+}
@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/apperr"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/models"
+)
+
+func (r *orderCartRepo) GetCoupon(code string) (*models.Coupon, error) {
+	var coupon models.Coupon
+	err := r.db.Where("code = ?", code).First(&coupon).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, apperr.NotFound("coupon", code)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &coupon, nil
+}
+
+// LockCoupon returns a coupon, locking it until the surrounding transaction
+// ends so its usage limits can be checked and consumed atomically. It must be
+// called through WithTx.
+func (r *orderCartRepo) LockCoupon(code string) (*models.Coupon, error) {
+	var coupon models.Coupon
+	err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).Where("code = ?", code).First(&coupon).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, apperr.NotFound("coupon", code)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &coupon, nil
+}
+
+func (r *orderCartRepo) CountCouponRedemptions(code, userID string) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.CouponRedemption{}).
+		Where("coupon_code = ? AND user_id = ?", code, userID).
+		Count(&count).Error
+	return count, err
+}
+
+// RedeemCoupon records a redemption and counts it against the coupon's
+// global usage limit.
+func (r *orderCartRepo) RedeemCoupon(redemption *models.CouponRedemption) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Coupon{}).
+			Where("code = ? AND (usage_limit = 0 OR used_count < usage_limit)", redemption.CouponCode).
+			UpdateColumn("used_count", gorm.Expr("used_count + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return apperr.FailedPrecondition("COUPON_EXHAUSTED", "coupon "+redemption.CouponCode+" has been fully redeemed")
+		}
+		return tx.Create(redemption).Error
+	})
+}
+
+// releaseCouponRedemption deletes the coupon redemption of an order that will
+// not be delivered and gives the use back to the coupon, so the user can apply
+// it again. Orders placed without a coupon are left alone.
+func releaseCouponRedemption(tx *gorm.DB, orderID string) error {
+	var redemption models.CouponRedemption
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("order_id = ?", orderID).First(&redemption).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Unscoped().Delete(&redemption).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.Coupon{}).
+		Where("code = ? AND used_count > 0", redemption.CouponCode).
+		UpdateColumn("used_count", gorm.Expr("used_count - 1")).Error
+}
+
+// GetCartCoupon returns the coupon applied to a cart, or nil if there is none.
+func (r *orderCartRepo) GetCartCoupon(userID, restaurantID string) (*models.CartCoupon, error) {
+	var cartCoupon models.CartCoupon
+	err := r.db.Where("user_id = ? AND restaurant_id = ?", userID, restaurantID).First(&cartCoupon).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cartCoupon, nil
+}
+
+// SetCartCoupon applies a coupon to a cart, replacing any coupon applied before.
+func (r *orderCartRepo) SetCartCoupon(userID, restaurantID, code string) error {
+	return r.db.Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"coupon_code", "updated_at"}),
+	}).Create(&models.CartCoupon{
+		UserID:       userID,
+		RestaurantID: restaurantID,
+		CouponCode:   code,
+	}).Error
+}
+
+func (r *orderCartRepo) RemoveCartCoupon(userID, restaurantID string) error {
+	return r.db.Unscoped().Where("user_id = ? AND restaurant_id = ?", userID, restaurantID).Delete(&models.CartCoupon{}).Error
+}
@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/apperr"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/models"
+)
+
+// Idempotent request statuses
+const (
+	IdempotencyInProgress = "IN_PROGRESS"
+	IdempotencyCompleted  = "COMPLETED"
+)
+
+// ErrIdempotencyLeaseLost is returned when a request no longer holds its
+// idempotency key because another request took it over.
+var ErrIdempotencyLeaseLost = apperr.Conflict("idempotency key was taken over by another request")
+
+// BeginIdempotentRequest tries to claim req's idempotency key for its user.
+// It returns the claimed record and true if the caller should process the
+// request, or the existing record and false if another request already holds
+// the key. Expired records, and in-progress records not renewed for longer
+// than lease, are taken over under req's LeaseID.
+func (r *orderCartRepo) BeginIdempotentRequest(req *models.IdempotentRequest, lease time.Duration) (*models.IdempotentRequest, bool, error) {
+	var existing models.IdempotentRequest
+	err := r.db.Where("user_id = ? AND idempotency_key = ?", req.UserID, req.IdempotencyKey).First(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		req.Status = IdempotencyInProgress
+		if err := r.db.Create(req).Error; err != nil {
+			// A concurrent request may have claimed the key first
+			if r.db.Where("user_id = ? AND idempotency_key = ?", req.UserID, req.IdempotencyKey).First(&existing).Error == nil {
+				return &existing, false, nil
+			}
+			return nil, false, err
+		}
+		return req, true, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	now := time.Now()
+	expired := existing.ExpiresAt.Before(now)
+	abandoned := existing.Status == IdempotencyInProgress && existing.UpdatedAt.Add(lease).Before(now)
+	if !expired && !abandoned {
+		return &existing, false, nil
+	}
+
+	result := r.db.Model(&models.IdempotentRequest{}).
+		Where("id = ? AND updated_at = ?", existing.ID, existing.UpdatedAt).
+		Updates(map[string]interface{}{
+			"request_hash": req.RequestHash,
+			"status":       IdempotencyInProgress,
+			"lease_id":     req.LeaseID,
+			"response":     nil,
+			"expires_at":   req.ExpiresAt,
+		})
+	if result.Error != nil {
+		return nil, false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		// Another request took it over first
+		return &existing, false, nil
+	}
+
+	existing.RequestHash = req.RequestHash
+	existing.Status = IdempotencyInProgress
+	existing.LeaseID = req.LeaseID
+	existing.Response = nil
+	existing.ExpiresAt = req.ExpiresAt
+	return &existing, true, nil
+}
+
+// CompleteIdempotentRequest stores the response to replay for a claimed key.
+// It may be called again to replace the response. It fails with
+// ErrIdempotencyLeaseLost if the key was taken over.
+func (r *orderCartRepo) CompleteIdempotentRequest(id uint, leaseID string, response []byte) error {
+	result := r.db.Model(&models.IdempotentRequest{}).
+		Where("id = ? AND lease_id = ?", id, leaseID).
+		Updates(map[string]interface{}{
+			"status":   IdempotencyCompleted,
+			"response": response,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrIdempotencyLeaseLost
+	}
+	return nil
+}
+
+// RenewIdempotentRequest extends the lease on a claimed key so that it is not
+// taken over while its request is still being processed. It fails with
+// ErrIdempotencyLeaseLost if the key was taken over.
+func (r *orderCartRepo) RenewIdempotentRequest(id uint, leaseID string) error {
+	result := r.db.Model(&models.IdempotentRequest{}).
+		Where("id = ? AND lease_id = ?", id, leaseID).
+		Update("updated_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrIdempotencyLeaseLost
+	}
+	return nil
+}
+
+// ReleaseIdempotentRequest deletes a claimed key so the request can be
+// retried. Keys taken over by another request are left alone.
+func (r *orderCartRepo) ReleaseIdempotentRequest(id uint, leaseID string) error {
+	return r.db.Unscoped().Where("lease_id = ?", leaseID).Delete(&models.IdempotentRequest{}, id).Error
+}
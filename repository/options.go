@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/models"
+)
+
+// GetProductOptions returns the options of a product, inactive ones included.
+func (r *orderCartRepo) GetProductOptions(productID string) ([]models.ProductOption, error) {
+	var options []models.ProductOption
+	err := r.db.Where("product_id = ?", productID).Order("id").Find(&options).Error
+	return options, err
+}
+
+// GetProductOptionsByID returns the options with the given IDs, keyed by
+// option ID. Unknown IDs are missing from the result.
+func (r *orderCartRepo) GetProductOptionsByID(optionIDs []string) (map[string]models.ProductOption, error) {
+	byID := make(map[string]models.ProductOption, len(optionIDs))
+	if len(optionIDs) == 0 {
+		return byID, nil
+	}
+	var options []models.ProductOption
+	if err := r.db.Where("option_id IN ?", optionIDs).Find(&options).Error; err != nil {
+		return nil, err
+	}
+	for _, option := range options {
+		byID[option.OptionID] = option
+	}
+	return byID, nil
+}
+
+// ReplaceProductOptions saves the options of a product. Existing options are
+// updated by option ID, and options no longer listed are deactivated rather
+// than deleted so cart lines that refer to them can still be shown.
+func (r *orderCartRepo) ReplaceProductOptions(productID string, options []models.ProductOption) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		keep := make([]string, 0, len(options))
+		for i := range options {
+			option := &options[i]
+			keep = append(keep, option.OptionID)
+
+			var existing models.ProductOption
+			result := tx.Where("option_id = ?", option.OptionID).Limit(1).Find(&existing)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected > 0 {
+				option.ID = existing.ID
+				option.CreatedAt = existing.CreatedAt
+			}
+			if err := tx.Save(option).Error; err != nil {
+				return err
+			}
+		}
+
+		query := tx.Model(&models.ProductOption{}).Where("product_id = ?", productID)
+		if len(keep) > 0 {
+			query = query.Where("option_id NOT IN ?", keep)
+		}
+		return query.Update("active", false).Error
+	})
+}
@@ -0,0 +1,355 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/models"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/orderstate"
+)
+
+// Outbox message types
+const (
+	OutboxDecrementStock = "DECREMENT_STOCK"
+	OutboxIncrementStock = "INCREMENT_STOCK"
+	OutboxCapturePayment = "CAPTURE_PAYMENT"
+	OutboxVoidPayment    = "VOID_PAYMENT"
+	OutboxRefundPayment  = "REFUND_PAYMENT"
+	OutboxNotifyUser     = "NOTIFY_USER"
+)
+
+// Outbox message statuses
+const (
+	OutboxPending   = "PENDING"
+	OutboxDone      = "DONE"
+	OutboxFailed    = "FAILED"
+	OutboxCancelled = "CANCELLED"
+	// OutboxUnknown marks a message given up on without knowing whether it
+	// took effect. It is left for an operator to reconcile.
+	OutboxUnknown = "UNKNOWN"
+)
+
+// StockPayload is the payload of stock decrement and increment messages.
+// Key identifies the order line whose stock moves; a decrement and the
+// increment compensating it share the key. It is sent as idempotency-key
+// metadata, but the restaurant service is not known to deduplicate by it, so
+// only decrements known to be applied are ever compensated.
+type StockPayload struct {
+	OrderID      string `json:"orderId"`
+	RestaurantID string `json:"restaurantId"`
+	ProductID    string `json:"productId"`
+	Quantity     int32  `json:"quantity"`
+	Key          string `json:"key,omitempty"`
+}
+
+// StockLineKey returns the key of the stock messages for line number line of
+// an order.
+func StockLineKey(orderID string, line int) string {
+	return fmt.Sprintf("%s/%d", orderID, line)
+}
+
+// NewStockOutboxMessage builds a pending outbox message of msgType for payload.
+func NewStockOutboxMessage(msgType string, payload StockPayload) (models.OutboxMessage, error) {
+	return newOutboxMessage(payload.OrderID, msgType, payload)
+}
+
+func newOutboxMessage(orderID, msgType string, payload interface{}) (models.OutboxMessage, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return models.OutboxMessage{}, err
+	}
+	return models.OutboxMessage{
+		AggregateID:   orderID,
+		Type:          msgType,
+		Payload:       string(data),
+		Status:        OutboxPending,
+		NextAttemptAt: time.Now(),
+	}, nil
+}
+
+// DecodeStockPayload decodes the payload of a stock outbox message.
+func DecodeStockPayload(msg *models.OutboxMessage) (StockPayload, error) {
+	var payload StockPayload
+	err := json.Unmarshal([]byte(msg.Payload), &payload)
+	return payload, err
+}
+
+// NotificationPayload is the payload of user notification messages.
+type NotificationPayload struct {
+	OrderID string `json:"orderId"`
+	UserID  string `json:"userId"`
+	Message string `json:"message"`
+}
+
+// DecodeNotificationPayload decodes the payload of a user notification
+// outbox message.
+func DecodeNotificationPayload(msg *models.OutboxMessage) (NotificationPayload, error) {
+	var payload NotificationPayload
+	err := json.Unmarshal([]byte(msg.Payload), &payload)
+	return payload, err
+}
+
+// ClaimOutboxMessages returns up to limit pending messages that are due and
+// pushes their next attempt lease into the future, so that other dispatchers
+// skip them while this one works on them.
+func (r *orderCartRepo) ClaimOutboxMessages(limit int, lease time.Duration) ([]models.OutboxMessage, error) {
+	var messages []models.OutboxMessage
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", OutboxPending, now).
+			Order("id").
+			Limit(limit).
+			Find(&messages).Error
+		if err != nil || len(messages) == 0 {
+			return err
+		}
+
+		ids := make([]uint, len(messages))
+		for i, msg := range messages {
+			ids[i] = msg.ID
+		}
+		return tx.Model(&models.OutboxMessage{}).
+			Where("id IN ?", ids).
+			Update("next_attempt_at", now.Add(lease)).Error
+	})
+	return messages, err
+}
+
+func (r *orderCartRepo) MarkOutboxMessageDone(id uint) error {
+	return markOutboxMessageDone(r.db, id)
+}
+
+func (r *orderCartRepo) RescheduleOutboxMessage(id uint, nextAttemptAt time.Time, lastErr string) error {
+	return r.db.Model(&models.OutboxMessage{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"attempts":        gorm.Expr("attempts + 1"),
+		"next_attempt_at": nextAttemptAt,
+		"last_error":      lastErr,
+	}).Error
+}
+
+func (r *orderCartRepo) MarkOutboxMessageFailed(id uint, lastErr string) error {
+	return markOutboxMessageFailed(r.db, id, lastErr)
+}
+
+// CompleteStockReservation marks a stock decrement as done. If it was the last
+// outstanding decrement of a reserving order the order becomes pending, or
+// scheduled if it waits for a delivery slot; if the order was cancelled or
+// failed in the meantime the decrement is compensated. Releasing the order's
+// stock cannot have done so, as the decrement was not known to be applied.
+func (r *orderCartRepo) CompleteStockReservation(msg *models.OutboxMessage) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		// Lock the order first, as releasing its stock does, so that the
+		// release either sees this decrement done or it sees the order over
+		order, err := lockOrder(tx, msg.AggregateID)
+		if err != nil {
+			return err
+		}
+		if err := markOutboxMessageDone(tx, msg.ID); err != nil {
+			return err
+		}
+
+		if order.OrderStatus != string(orderstate.Reserving) {
+			payload, err := DecodeStockPayload(msg)
+			if err != nil {
+				return err
+			}
+			return enqueueStockMessage(tx, OutboxIncrementStock, payload)
+		}
+
+		var outstanding int64
+		err = tx.Model(&models.OutboxMessage{}).
+			Where("aggregate_id = ? AND type = ? AND status <> ?", order.OrderID, OutboxDecrementStock, OutboxDone).
+			Count(&outstanding).Error
+		if err != nil || outstanding > 0 {
+			return err
+		}
+
+		next, reason := orderstate.Pending, "stock reserved"
+		if order.ScheduledFor != nil && order.ReleasedAt == nil {
+			next, reason = orderstate.Scheduled, "stock reserved for scheduled order"
+		}
+		return applyStatusEvent(tx, &models.OrderStatusEvent{
+			OrderID:    order.OrderID,
+			FromStatus: order.OrderStatus,
+			ToStatus:   string(next),
+			ActorType:  string(orderstate.ActorSystem),
+			Reason:     reason,
+		}, map[string]interface{}{"order_status": string(next)})
+	})
+}
+
+// FailStockReservation gives up on a stock decrement, fails its order if it
+// is still reserving, gives back any stock already decremented for it and
+// releases its coupon redemption.
+// If outcomeUnknown is set the decrement may have been applied all the same.
+// It is marked OutboxUnknown for an operator to reconcile rather than
+// compensated, since an increment for a decrement that never applied would
+// inflate the stock.
+func (r *orderCartRepo) FailStockReservation(msg *models.OutboxMessage, reason string, outcomeUnknown bool) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := markOutboxMessageFailed(tx, msg.ID, reason); err != nil {
+			return err
+		}
+		if outcomeUnknown {
+			err := tx.Model(&models.OutboxMessage{}).Where("id = ?", msg.ID).Update("status", OutboxUnknown).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		order, err := lockOrder(tx, msg.AggregateID)
+		if err != nil {
+			return err
+		}
+		if order.OrderStatus != string(orderstate.Reserving) {
+			// The order was cancelled meanwhile and its stock already released
+			return nil
+		}
+
+		err = applyStatusEvent(tx, &models.OrderStatusEvent{
+			OrderID:    order.OrderID,
+			FromStatus: order.OrderStatus,
+			ToStatus:   string(orderstate.Failed),
+			ActorType:  string(orderstate.ActorSystem),
+			Reason:     reason,
+		}, map[string]interface{}{
+			"order_status":  string(orderstate.Failed),
+			"cancel_reason": reason,
+		})
+		if err != nil {
+			return err
+		}
+		if err := releaseCouponRedemption(tx, order.OrderID); err != nil {
+			return err
+		}
+		if err := enqueueStockRelease(tx, order); err != nil {
+			return err
+		}
+		return enqueuePaymentRelease(tx, order)
+	})
+}
+
+func markOutboxMessageDone(tx *gorm.DB, id uint) error {
+	return tx.Model(&models.OutboxMessage{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":     OutboxDone,
+		"attempts":   gorm.Expr("attempts + 1"),
+		"last_error": "",
+	}).Error
+}
+
+func markOutboxMessageFailed(tx *gorm.DB, id uint, lastErr string) error {
+	return tx.Model(&models.OutboxMessage{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":     OutboxFailed,
+		"attempts":   gorm.Expr("attempts + 1"),
+		"last_error": lastErr,
+	}).Error
+}
+
+func lockOrder(tx *gorm.DB, orderID string) (*models.Order, error) {
+	var order models.Order
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Preload("OrderItems").
+		Where("order_id = ?", orderID).
+		First(&order).Error
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// enqueueUserNotification enqueues a notification about order for the user
+// who placed it.
+func enqueueUserNotification(tx *gorm.DB, order *models.Order, message string) error {
+	msg, err := newOutboxMessage(order.OrderID, OutboxNotifyUser, NotificationPayload{
+		OrderID: order.OrderID,
+		UserID:  order.UserID,
+		Message: message,
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Create(&msg).Error
+}
+
+// enqueueStockReservation enqueues the stock decrements of every item of order.
+func enqueueStockReservation(tx *gorm.DB, order *models.Order) error {
+	for i, item := range order.OrderItems {
+		err := enqueueStockMessage(tx, OutboxDecrementStock, StockPayload{
+			OrderID:      order.OrderID,
+			RestaurantID: order.RestaurantID,
+			ProductID:    item.ProductID,
+			Quantity:     item.Quantity,
+			Key:          StockLineKey(order.OrderID, i),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func enqueueStockMessage(tx *gorm.DB, msgType string, payload StockPayload) error {
+	msg, err := NewStockOutboxMessage(msgType, payload)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&msg).Error
+}
+
+// enqueueStockRelease gives back the stock held by order. Decrements not done
+// yet are cancelled; one already sent to the restaurant service is
+// compensated if it completes after all. Done decrements are compensated with
+// an increment under their key.
+func enqueueStockRelease(tx *gorm.DB, order *models.Order) error {
+	var decrements []models.OutboxMessage
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("aggregate_id = ? AND type = ?", order.OrderID, OutboxDecrementStock).
+		Find(&decrements).Error
+	if err != nil {
+		return err
+	}
+
+	// Orders placed before the outbox existed decremented stock synchronously,
+	// while scheduled orders with deferred stock have not decremented any yet
+	if len(decrements) == 0 && !order.StockDeferred {
+		for i, item := range order.OrderItems {
+			err := enqueueStockMessage(tx, OutboxIncrementStock, StockPayload{
+				OrderID:      order.OrderID,
+				RestaurantID: order.RestaurantID,
+				ProductID:    item.ProductID,
+				Quantity:     item.Quantity,
+				Key:          StockLineKey(order.OrderID, i),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, msg := range decrements {
+		switch msg.Status {
+		case OutboxPending:
+			err := tx.Model(&models.OutboxMessage{}).
+				Where("id = ?", msg.ID).
+				Update("status", OutboxCancelled).Error
+			if err != nil {
+				return err
+			}
+		case OutboxDone:
+			payload, err := DecodeStockPayload(&msg)
+			if err != nil {
+				return err
+			}
+			if err := enqueueStockMessage(tx, OutboxIncrementStock, payload); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
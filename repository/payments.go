@@ -0,0 +1,397 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/apperr"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/models"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/money"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/orderstate"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/payments"
+)
+
+// ErrPaymentStatusConflict is returned when a payment is no longer in the
+// status an update expected.
+var ErrPaymentStatusConflict = apperr.Conflict("payment status changed")
+
+// PaymentPayload is the payload of payment capture, void and refund messages.
+type PaymentPayload struct {
+	OrderID   string `json:"orderId"`
+	PaymentID string `json:"paymentId"`
+	// Reference is the provider's reference of the authorization. It is
+	// empty on the void of an authorization whose outcome was never known.
+	Reference   string `json:"reference"`
+	RefundID    string `json:"refundId,omitempty"`
+	AmountMinor int64  `json:"amountMinor"`
+	Currency    string `json:"currency"`
+}
+
+// Amount returns the amount to capture or refund.
+func (p PaymentPayload) Amount() money.Money {
+	return money.New(p.AmountMinor, p.Currency)
+}
+
+// DecodePaymentPayload decodes the payload of a payment outbox message.
+func DecodePaymentPayload(msg *models.OutboxMessage) (PaymentPayload, error) {
+	var payload PaymentPayload
+	err := json.Unmarshal([]byte(msg.Payload), &payload)
+	return payload, err
+}
+
+func (r *orderCartRepo) GetOrderPayment(orderID string) (*models.Payment, error) {
+	var payment models.Payment
+	err := r.db.Where("order_id = ?", orderID).First(&payment).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, apperr.NotFound("payment", orderID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+// AuthorizeOrderPayment records that the pending payment of an order was
+// authorized under the provider's reference. The order starts reserving its
+// stock, or waits for its slot if its stock is deferred.
+func (r *orderCartRepo) AuthorizeOrderPayment(orderID, reference string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		order, payment, err := lockPendingPayment(tx, orderID)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Model(payment).Updates(map[string]interface{}{
+			"status":             payments.StatusAuthorized,
+			"provider_reference": reference,
+			"authorized_at":      time.Now(),
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		next := orderstate.Reserving
+		if order.StockDeferred {
+			next = orderstate.Scheduled
+		} else if err := enqueueStockReservation(tx, order); err != nil {
+			return err
+		}
+		return applyStatusEvent(tx, &models.OrderStatusEvent{
+			OrderID:    order.OrderID,
+			FromStatus: order.OrderStatus,
+			ToStatus:   string(next),
+			ActorType:  string(orderstate.ActorSystem),
+			Reason:     "payment authorized",
+		}, map[string]interface{}{"order_status": string(next)})
+	})
+}
+
+// FailOrderPayment records that the pending payment of an order was declined
+// or failed and fails the order. Its items, coupon and instructions go back
+// into the user's cart and its coupon redemption is released.
+func (r *orderCartRepo) FailOrderPayment(orderID, paymentStatus, reason string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		order, payment, err := lockPendingPayment(tx, orderID)
+		if err != nil {
+			return err
+		}
+		return failPayment(tx, order, payment, paymentStatus, reason)
+	})
+}
+
+// FindStalePendingPayments returns the IDs of up to limit orders placed before
+// cutoff whose payment is still waiting for authorization, oldest first,
+// leaving out the orders in skip.
+func (r *orderCartRepo) FindStalePendingPayments(cutoff time.Time, skip []string, limit int) ([]string, error) {
+	query := r.db.Model(&models.Order{}).
+		Where("order_status = ? AND created_at <= ?", string(orderstate.PaymentPending), cutoff)
+	if len(skip) > 0 {
+		query = query.Where("order_id NOT IN ?", skip)
+	}
+	var orderIDs []string
+	err := query.
+		Order("created_at, id").
+		Limit(limit).
+		Pluck("order_id", &orderIDs).Error
+	return orderIDs, err
+}
+
+// ExpirePendingPayment fails an order whose payment authorization never
+// completed, as FailOrderPayment does, with reason. The provider may have
+// authorized the payment all the same, so a void of whatever it authorized
+// under the payment's ID is queued. The order row is locked
+// with SKIP LOCKED so that replicas running the same check, or the
+// authorization being recorded at that moment, never race on it. It reports
+// whether the order was failed; orders that are locked elsewhere or whose
+// payment is no longer pending are left alone.
+func (r *orderCartRepo) ExpirePendingPayment(orderID, reason string) (bool, error) {
+	var expired bool
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var order models.Order
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Preload("OrderItems").
+			Where("order_id = ?", orderID).
+			First(&order).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if order.OrderStatus != string(orderstate.PaymentPending) {
+			return nil
+		}
+
+		payment, err := lockPayment(tx, orderID)
+		if err != nil {
+			return err
+		}
+		if payment.Status != payments.StatusPending {
+			return nil
+		}
+		if err := failPayment(tx, &order, payment, payments.StatusFailed, reason); err != nil {
+			return err
+		}
+		err = enqueuePaymentMessage(tx, OutboxVoidPayment, PaymentPayload{
+			OrderID:     order.OrderID,
+			PaymentID:   payment.PaymentID,
+			AmountMinor: payment.Amount.Minor,
+			Currency:    payment.Amount.Currency,
+		})
+		if err != nil {
+			return err
+		}
+		expired = true
+		return nil
+	})
+	return expired, err
+}
+
+// failPayment marks the locked pending payment of order as failed or
+// declined, fails the order, restores the user's cart and releases the
+// order's coupon redemption.
+func failPayment(tx *gorm.DB, order *models.Order, payment *models.Payment, paymentStatus, reason string) error {
+	err := tx.Model(payment).Updates(map[string]interface{}{
+		"status":         paymentStatus,
+		"failure_reason": reason,
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	cancelReason := "payment failed: " + reason
+	if paymentStatus == payments.StatusDeclined {
+		cancelReason = "payment declined: " + reason
+	}
+	err = applyStatusEvent(tx, &models.OrderStatusEvent{
+		OrderID:    order.OrderID,
+		FromStatus: order.OrderStatus,
+		ToStatus:   string(orderstate.Failed),
+		ActorType:  string(orderstate.ActorSystem),
+		Reason:     cancelReason,
+	}, map[string]interface{}{
+		"order_status":  string(orderstate.Failed),
+		"cancel_reason": cancelReason,
+	})
+	if err != nil {
+		return err
+	}
+	if err := restoreCart(tx, order); err != nil {
+		return err
+	}
+	return releaseCouponRedemption(tx, order.OrderID)
+}
+
+// CompletePaymentOperation marks a payment capture, void or refund as done
+// and updates the payment; reference is the provider's reference of a
+// refund. A capture that completes after its order was cancelled or failed,
+// or after the payment was voided, is refunded. A void that completes after
+// the payment was captured never overwrites the capture; what is left of the
+// payment is refunded instead.
+func (r *orderCartRepo) CompletePaymentOperation(msg *models.OutboxMessage, reference string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := markOutboxMessageDone(tx, msg.ID); err != nil {
+			return err
+		}
+
+		order, err := lockOrder(tx, msg.AggregateID)
+		if err != nil {
+			return err
+		}
+		payment, err := lockPayment(tx, order.OrderID)
+		if err != nil {
+			return err
+		}
+
+		switch msg.Type {
+		case OutboxCapturePayment:
+			voided := payment.Status == payments.StatusVoided
+			err := tx.Model(payment).Updates(map[string]interface{}{
+				"status":      payments.StatusCaptured,
+				"captured_at": time.Now(),
+			}).Error
+			if err != nil {
+				return err
+			}
+			switch orderstate.Status(order.OrderStatus) {
+			case orderstate.Cancelled, orderstate.Failed:
+				return enqueuePaymentRelease(tx, order)
+			}
+			if voided {
+				// The void raced ahead of the capture at the provider
+				return enqueuePaymentRelease(tx, order)
+			}
+			return nil
+		case OutboxVoidPayment:
+			switch payment.Status {
+			case payments.StatusAuthorized:
+				return tx.Model(payment).Update("status", payments.StatusVoided).Error
+			case payments.StatusCaptured, payments.StatusPartiallyRefunded:
+				return enqueuePaymentRelease(tx, order)
+			}
+			// Refunded payments have nothing left to give back, and payments
+			// that failed keep their status
+			return nil
+		case OutboxRefundPayment:
+			payload, err := DecodePaymentPayload(msg)
+			if err != nil {
+				return err
+			}
+			refund, err := lockRefund(tx, payload.RefundID)
+			if err != nil {
+				return err
+			}
+			return completeRefund(tx, order, payment, refund, reference)
+		}
+		return fmt.Errorf("unknown payment operation %q", msg.Type)
+	})
+}
+
+// lockPendingPayment locks an order and its payment, which must still be
+// pending.
+func lockPendingPayment(tx *gorm.DB, orderID string) (*models.Order, *models.Payment, error) {
+	order, err := lockOrder(tx, orderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	payment, err := lockPayment(tx, orderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if payment.Status != payments.StatusPending {
+		return nil, nil, ErrPaymentStatusConflict
+	}
+	return order, payment, nil
+}
+
+func lockPayment(tx *gorm.DB, orderID string) (*models.Payment, error) {
+	var payment models.Payment
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("order_id = ?", orderID).
+		First(&payment).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, apperr.NotFound("payment", orderID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+// findPayment returns the payment of an order, or nil for orders placed
+// before payments were taken.
+func findPayment(tx *gorm.DB, orderID string) (*models.Payment, error) {
+	var found []models.Payment
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("order_id = ?", orderID).
+		Limit(1).
+		Find(&found).Error
+	if err != nil || len(found) == 0 {
+		return nil, err
+	}
+	return &found[0], nil
+}
+
+// enqueuePaymentCapture enqueues the capture of an order's authorized payment.
+// Wallet payments are captured at once.
+func enqueuePaymentCapture(tx *gorm.DB, orderID string) error {
+	payment, err := findPayment(tx, orderID)
+	if err != nil || payment == nil || payment.Status != payments.StatusAuthorized {
+		return err
+	}
+	if payment.Provider == payments.WalletProviderName {
+		order, err := lockOrder(tx, orderID)
+		if err != nil {
+			return err
+		}
+		return captureWalletPayment(tx, order.UserID, payment)
+	}
+	return enqueuePaymentMessage(tx, OutboxCapturePayment, PaymentPayload{
+		OrderID:     orderID,
+		PaymentID:   payment.PaymentID,
+		Reference:   payment.ProviderReference,
+		AmountMinor: payment.Amount.Minor,
+		Currency:    payment.Amount.Currency,
+	})
+}
+
+// enqueuePaymentRelease gives back the money taken for order: captures that
+// have not been dispatched yet are cancelled, authorized payments are voided
+// and whatever is left of captured ones is refunded. Wallet payments are
+// released at once.
+func enqueuePaymentRelease(tx *gorm.DB, order *models.Order) error {
+	payment, err := findPayment(tx, order.OrderID)
+	if err != nil || payment == nil {
+		return err
+	}
+
+	err = tx.Model(&models.OutboxMessage{}).
+		Where("aggregate_id = ? AND type = ? AND status = ?", order.OrderID, OutboxCapturePayment, OutboxPending).
+		Update("status", OutboxCancelled).Error
+	if err != nil {
+		return err
+	}
+
+	switch payment.Status {
+	case payments.StatusAuthorized:
+		if payment.Provider == payments.WalletProviderName {
+			return voidWalletPayment(tx, order.UserID, payment)
+		}
+		return enqueuePaymentMessage(tx, OutboxVoidPayment, PaymentPayload{
+			OrderID:     order.OrderID,
+			PaymentID:   payment.PaymentID,
+			Reference:   payment.ProviderReference,
+			AmountMinor: payment.Amount.Minor,
+			Currency:    payment.Amount.Currency,
+		})
+	case payments.StatusCaptured, payments.StatusPartiallyRefunded:
+		remaining, err := refundableAmount(tx, payment)
+		if err != nil || remaining.Minor <= 0 {
+			return err
+		}
+		return startRefund(tx, order, payment, &models.Refund{
+			RefundID:  newRefundID(),
+			OrderID:   order.OrderID,
+			PaymentID: payment.PaymentID,
+			Amount:    remaining,
+			Reason:    "order " + strings.ToLower(order.OrderStatus),
+			Status:    payments.RefundPending,
+			ActorType: string(orderstate.ActorSystem),
+		})
+	}
+	return nil
+}
+
+func enqueuePaymentMessage(tx *gorm.DB, msgType string, payload PaymentPayload) error {
+	msg, err := newOutboxMessage(payload.OrderID, msgType, payload)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&msg).Error
+}
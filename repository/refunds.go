@@ -0,0 +1,303 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/apperr"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/models"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/money"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/orderstate"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/payments"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/pricing"
+)
+
+// RefundRequest describes a refund to issue for an order. Full refunds
+// return whatever is left of the payment; otherwise Items lists the products
+// and quantities to refund at what was paid for them, discount and tax included.
+type RefundRequest struct {
+	OrderID   string
+	Full      bool
+	Items     []RefundItemRequest
+	Reason    string
+	ActorType string
+	ActorID   string
+}
+
+// RefundItemRequest is a quantity of a product to refund.
+type RefundItemRequest struct {
+	ProductID string
+	Quantity  int32
+}
+
+// IssueRefund records a refund of a delivered, cancelled or partially
+// refunded order and starts paying it out. Refunds never exceed the captured
+// payment less the refunds already issued, and item refunds never exceed the
+// quantity ordered less the quantity already refunded.
+func (r *orderCartRepo) IssueRefund(req RefundRequest) (*models.Refund, error) {
+	var refund *models.Refund
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		order, err := lockOrder(tx, req.OrderID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return apperr.NotFound("order", req.OrderID)
+		}
+		if err != nil {
+			return err
+		}
+		switch orderstate.Status(order.OrderStatus) {
+		case orderstate.Delivered, orderstate.Cancelled, orderstate.PartiallyRefunded:
+		default:
+			return apperr.FailedPrecondition("ORDER_NOT_REFUNDABLE",
+				fmt.Sprintf("order %s is %s and cannot be refunded", order.OrderID, order.OrderStatus))
+		}
+
+		payment, err := findPayment(tx, order.OrderID)
+		if err != nil {
+			return err
+		}
+		if payment == nil || (payment.Status != payments.StatusCaptured && payment.Status != payments.StatusPartiallyRefunded) {
+			return apperr.FailedPrecondition("PAYMENT_NOT_REFUNDABLE",
+				fmt.Sprintf("order %s has no captured payment to refund", order.OrderID))
+		}
+
+		remaining, err := refundableAmount(tx, payment)
+		if err != nil {
+			return err
+		}
+		refund = &models.Refund{
+			RefundID:  newRefundID(),
+			OrderID:   order.OrderID,
+			PaymentID: payment.PaymentID,
+			Amount:    remaining,
+			Reason:    req.Reason,
+			Status:    payments.RefundPending,
+			ActorType: req.ActorType,
+			ActorID:   req.ActorID,
+		}
+		if !req.Full {
+			refund.Items, refund.Amount, err = refundItems(tx, order, req.Items)
+			if err != nil {
+				return err
+			}
+		}
+		if remaining.Minor <= 0 || refund.Amount.Minor > remaining.Minor {
+			return apperr.FailedPrecondition("REFUND_EXCEEDS_PAID",
+				fmt.Sprintf("refund of %s exceeds the %s left to refund on order %s", refund.Amount, remaining, order.OrderID))
+		}
+		for i := range refund.Items {
+			refund.Items[i].RefundID = refund.RefundID
+		}
+
+		return startRefund(tx, order, payment, refund)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return refund, nil
+}
+
+func (r *orderCartRepo) GetOrderRefunds(orderID string) ([]models.Refund, error) {
+	var refunds []models.Refund
+	err := r.db.Preload("Items").Where("order_id = ?", orderID).Order("id").Find(&refunds).Error
+	return refunds, err
+}
+
+// FailRefund gives up on a refund the provider would not pay out, so that its
+// amount can be refunded again.
+func (r *orderCartRepo) FailRefund(msg *models.OutboxMessage, reason string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := markOutboxMessageFailed(tx, msg.ID, reason); err != nil {
+			return err
+		}
+		payload, err := DecodePaymentPayload(msg)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&models.Refund{}).
+			Where("refund_id = ? AND status = ?", payload.RefundID, payments.RefundPending).
+			Updates(map[string]interface{}{
+				"status":         payments.RefundFailed,
+				"failure_reason": reason,
+			}).Error
+	})
+}
+
+func newRefundID() string {
+	return fmt.Sprintf("refund_%s", uuid.New().String())
+}
+
+// refundItems allocates the requested quantities to the order's items of each
+// product, in order, and prices them at what was paid for them: their price
+// less their share of the order's discount, plus the tax charged on them.
+// Refunds of a line add up to at most what was paid for the whole line.
+func refundItems(tx *gorm.DB, order *models.Order, requested []RefundItemRequest) ([]models.RefundItem, money.Money, error) {
+	var rows []struct {
+		OrderItemID uint
+		Quantity    int32
+		AmountMinor int64
+	}
+	err := tx.Model(&models.RefundItem{}).
+		Select("refund_items.order_item_id, SUM(refund_items.quantity) AS quantity, SUM(refund_items.amount_minor) AS amount_minor").
+		Joins("JOIN refunds ON refunds.refund_id = refund_items.refund_id AND refunds.deleted_at IS NULL").
+		Where("refunds.order_id = ? AND refunds.status <> ?", order.OrderID, payments.RefundFailed).
+		Group("refund_items.order_item_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, money.Money{}, err
+	}
+	refunded := make(map[uint]int32, len(rows))
+	refundedAmount := make(map[uint]int64, len(rows))
+	for _, row := range rows {
+		refunded[row.OrderItemID] = row.Quantity
+		refundedAmount[row.OrderItemID] = row.AmountMinor
+	}
+
+	paid := pricing.PaidAmounts(order.OrderItems)
+	var items []models.RefundItem
+	total := money.Zero(money.DefaultCurrency)
+	for _, want := range requested {
+		left, found := want.Quantity, false
+		for i, item := range order.OrderItems {
+			if item.ProductID != want.ProductID {
+				continue
+			}
+			found = true
+			take := min(left, item.Quantity-refunded[item.ID])
+			if take <= 0 {
+				continue
+			}
+
+			// Refund the paid amount of every unit refunded so far, less what
+			// earlier refunds returned, so that rounding never adds up to
+			// more than the line's paid amount
+			amount := paid[i].MulDiv(int64(refunded[item.ID]+take), int64(item.Quantity))
+			amount.Minor = max(amount.Minor-refundedAmount[item.ID], 0)
+			items = append(items, models.RefundItem{
+				OrderItemID: item.ID,
+				ProductID:   item.ProductID,
+				Quantity:    take,
+				Amount:      amount,
+			})
+			total.Minor += amount.Minor
+			refunded[item.ID] += take
+			refundedAmount[item.ID] += amount.Minor
+			left -= take
+		}
+		if !found {
+			return nil, money.Money{}, apperr.NotFound("order item", want.ProductID)
+		}
+		if left > 0 {
+			return nil, money.Money{}, apperr.FailedPrecondition("REFUND_EXCEEDS_ORDERED",
+				fmt.Sprintf("only %d more of product %s can be refunded on order %s", want.Quantity-left, want.ProductID, order.OrderID))
+		}
+	}
+	return items, total, nil
+}
+
+// refundableAmount returns the part of a captured payment that has not been
+// refunded or is not being refunded yet.
+func refundableAmount(tx *gorm.DB, payment *models.Payment) (money.Money, error) {
+	refunded, err := sumRefunds(tx, payment.PaymentID, payments.RefundPending, payments.RefundCompleted)
+	if err != nil {
+		return money.Money{}, err
+	}
+	return money.New(payment.Amount.Minor-refunded, payment.Amount.Currency), nil
+}
+
+func sumRefunds(tx *gorm.DB, paymentID string, statuses ...string) (int64, error) {
+	var total int64
+	err := tx.Model(&models.Refund{}).
+		Select("COALESCE(SUM(amount_minor), 0)").
+		Where("payment_id = ? AND status IN ?", paymentID, statuses).
+		Scan(&total).Error
+	return total, err
+}
+
+func lockRefund(tx *gorm.DB, refundID string) (*models.Refund, error) {
+	var refund models.Refund
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("refund_id = ?", refundID).
+		First(&refund).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, apperr.NotFound("refund", refundID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &refund, nil
+}
+
+// startRefund saves a pending refund and pays it out: wallet refunds are
+// credited at once, other refunds are sent to the payment provider through
+// the outbox.
+func startRefund(tx *gorm.DB, order *models.Order, payment *models.Payment, refund *models.Refund) error {
+	if err := tx.Create(refund).Error; err != nil {
+		return err
+	}
+
+	if payment.Provider == payments.WalletProviderName {
+		wallet, err := lockWallet(tx, order.UserID)
+		if err != nil {
+			return err
+		}
+		if err := recordWalletEntry(tx, wallet, WalletCredit, refund.Amount, order.OrderID, "refund for order"); err != nil {
+			return err
+		}
+		return completeRefund(tx, order, payment, refund, "")
+	}
+
+	return enqueuePaymentMessage(tx, OutboxRefundPayment, PaymentPayload{
+		OrderID:     order.OrderID,
+		PaymentID:   payment.PaymentID,
+		Reference:   payment.ProviderReference,
+		RefundID:    refund.RefundID,
+		AmountMinor: refund.Amount.Minor,
+		Currency:    refund.Amount.Currency,
+	})
+}
+
+// completeRefund marks a refund as paid out and moves the payment and the
+// order to REFUNDED once all of the payment was refunded, or to
+// PARTIALLY_REFUNDED before that.
+func completeRefund(tx *gorm.DB, order *models.Order, payment *models.Payment, refund *models.Refund, reference string) error {
+	err := tx.Model(refund).Updates(map[string]interface{}{
+		"status":             payments.RefundCompleted,
+		"provider_reference": reference,
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	refunded, err := sumRefunds(tx, payment.PaymentID, payments.RefundCompleted)
+	if err != nil {
+		return err
+	}
+	paymentStatus, next := payments.StatusPartiallyRefunded, orderstate.PartiallyRefunded
+	if refunded >= payment.Amount.Minor {
+		paymentStatus, next = payments.StatusRefunded, orderstate.Refunded
+	}
+	if err := tx.Model(payment).Update("status", paymentStatus).Error; err != nil {
+		return err
+	}
+
+	from := orderstate.Status(order.OrderStatus)
+	if from == next || !orderstate.CanTransition(orderstate.ActorSystem, from, next) {
+		return nil
+	}
+	err = applyStatusEvent(tx, &models.OrderStatusEvent{
+		OrderID:    order.OrderID,
+		FromStatus: order.OrderStatus,
+		ToStatus:   string(next),
+		ActorType:  string(orderstate.ActorSystem),
+		Reason:     refund.Reason,
+	}, map[string]interface{}{"order_status": string(next)})
+	if err != nil {
+		return err
+	}
+	order.OrderStatus = string(next)
+	return nil
+}
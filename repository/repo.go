@@ -1,28 +1,110 @@
 package repository
 
 import (
+	"context"
 	"errors"
+	"time"
 
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/apperr"
 	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/models"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/money"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/orderstate"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// ErrCartItemNotFound is returned when a cart operation targets a product that
+// is not in the cart.
+var ErrCartItemNotFound = apperr.NotFound("cart item", "")
+
+// ErrOrderStatusConflict is returned when an order is missing or no longer in
+// the status a conditional update expected.
+var ErrOrderStatusConflict = apperr.Conflict("order not found or status changed")
+
 type OrderCartRepository interface {
+	// WithTx runs fn with a repository bound to a single database transaction,
+	// committing if fn returns nil and rolling back otherwise.
+	WithTx(ctx context.Context, fn func(repo OrderCartRepository) error) error
+
 	// Cart operations
 	AddToCart(item *models.CartItem) error
 	GetCartItems(userID, restaurantID string) ([]models.CartItem, error)
+	LockCartItems(userID, restaurantID string) ([]models.CartItem, error)
+	LockCartItem(userID, restaurantID, productID, lineKey string) (*models.CartItem, error)
 	GetAllUserCarts(userID string) (map[string][]models.CartItem, error)
-	UpdateCartItemQuantity(userID, restaurantID, productID string, quantity int32) error
+	UpdateCartItemQuantity(userID, restaurantID, productID, lineKey string, quantity int32) error
+	UpdateCartItemDetails(item *models.CartItem) error
 	RemoveFromCart(userID, restaurantID, productID string) error
+	RemoveCartLine(userID, restaurantID, productID, lineKey string) error
 	ClearCart(userID, restaurantID string) error
+	GetCartInstructions(userID, restaurantID string) (*models.CartInstructions, error)
+	SetCartInstructions(instructions *models.CartInstructions) error
+	RemoveCartInstructions(userID, restaurantID string) error
+	FindStaleCarts(cutoff time.Time, limit int) ([]CartKey, error)
+	SweepCart(key CartKey, cutoff time.Time, archive bool) (int64, error)
+	PurgeDeletedCartItems(cutoff time.Time, limit int) (int64, error)
+	GetAbandonedCarts(idleSince time.Time, minValueMinor int64, limit, offset int) ([]CartSummary, error)
 
 	// Order operations
-	CreateOrder(order *models.Order) error
+	CreateOrder(order *models.Order, outbox []models.OutboxMessage) error
 	GetAllOrders(userID string) ([]models.Order, error)
 	GetOrderByID(orderID string) (*models.Order, error)
-	UpdateOrderStatus(orderID, status string) error
+	UpdateOrderStatus(event *models.OrderStatusEvent) error
 	GetRestaurantOrders(restaurantID string, status string) ([]models.Order, error)
-	UpdateOrderCancellation(orderID, reason string) error
+	UpdateOrderCancellation(event *models.OrderStatusEvent) error
+	UpdateOrderRejection(event *models.OrderStatusEvent, code orderstate.RejectionCode) error
+	GetOrderStatusEvents(orderID string) ([]models.OrderStatusEvent, error)
+	FindDueScheduledOrders(due time.Time, skip []string, limit int) ([]string, error)
+	ReleaseScheduledOrder(orderID string) error
+	FindUnacceptedOrders(cutoff time.Time, overrides map[string]time.Time, skip []string, limit int) ([]string, error)
+	ExpireUnacceptedOrder(orderID, reason, message string) (bool, error)
+
+	// Payment operations
+	GetOrderPayment(orderID string) (*models.Payment, error)
+	AuthorizeOrderPayment(orderID, reference string) error
+	FailOrderPayment(orderID, paymentStatus, reason string) error
+	FindStalePendingPayments(cutoff time.Time, skip []string, limit int) ([]string, error)
+	ExpirePendingPayment(orderID, reason string) (bool, error)
+	CompletePaymentOperation(msg *models.OutboxMessage, reference string) error
+
+	// Refund operations
+	IssueRefund(req RefundRequest) (*models.Refund, error)
+	GetOrderRefunds(orderID string) ([]models.Refund, error)
+	FailRefund(msg *models.OutboxMessage, reason string) error
+
+	// Wallet operations
+	GetWallet(userID string) (*models.Wallet, error)
+	GetWalletTransactions(userID string, limit, offset int) ([]models.WalletTransaction, error)
+	CreditWallet(userID string, amount money.Money, description string) (*models.Wallet, error)
+	HoldWalletFunds(userID, orderID string, amount money.Money) error
+
+	// Product option operations
+	GetProductOptions(productID string) ([]models.ProductOption, error)
+	GetProductOptionsByID(optionIDs []string) (map[string]models.ProductOption, error)
+	ReplaceProductOptions(productID string, options []models.ProductOption) error
+
+	// Coupon operations
+	GetCoupon(code string) (*models.Coupon, error)
+	LockCoupon(code string) (*models.Coupon, error)
+	CountCouponRedemptions(code, userID string) (int64, error)
+	RedeemCoupon(redemption *models.CouponRedemption) error
+	GetCartCoupon(userID, restaurantID string) (*models.CartCoupon, error)
+	SetCartCoupon(userID, restaurantID, code string) error
+	RemoveCartCoupon(userID, restaurantID string) error
+
+	// Outbox operations
+	ClaimOutboxMessages(limit int, lease time.Duration) ([]models.OutboxMessage, error)
+	MarkOutboxMessageDone(id uint) error
+	RescheduleOutboxMessage(id uint, nextAttemptAt time.Time, lastErr string) error
+	MarkOutboxMessageFailed(id uint, lastErr string) error
+	CompleteStockReservation(msg *models.OutboxMessage) error
+	FailStockReservation(msg *models.OutboxMessage, reason string, outcomeUnknown bool) error
+
+	// Idempotency operations
+	BeginIdempotentRequest(req *models.IdempotentRequest, lease time.Duration) (*models.IdempotentRequest, bool, error)
+	CompleteIdempotentRequest(id uint, leaseID string, response []byte) error
+	RenewIdempotentRequest(id uint, leaseID string) error
+	ReleaseIdempotentRequest(id uint, leaseID string) error
 }
 
 type orderCartRepo struct {
@@ -33,18 +115,32 @@ func NewOrderCartRepository(db *gorm.DB) OrderCartRepository {
 	return &orderCartRepo{db: db}
 }
 
+func (r *orderCartRepo) WithTx(ctx context.Context, fn func(repo OrderCartRepository) error) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(&orderCartRepo{db: tx})
+	})
+}
+
 // Cart operations implementation
 func (r *orderCartRepo) AddToCart(item *models.CartItem) error {
-	var existingItem models.CartItem
-	result := r.db.Where("user_id = ? AND restaurant_id = ? AND product_id = ?", item.UserID, item.RestaurantID, item.ProductID).First(&existingItem)
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var existingItem models.CartItem
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND restaurant_id = ? AND product_id = ? AND line_key = ?", item.UserID, item.RestaurantID, item.ProductID, item.LineKey).
+			Limit(1).
+			Find(&existingItem)
+		if result.Error != nil {
+			return result.Error
+		}
 
-	if result.Error == nil {
-		// Update existing item quantity
-		existingItem.Quantity += item.Quantity
-		return r.db.Save(&existingItem).Error
-	}
+		if result.RowsAffected > 0 {
+			// Update existing item quantity
+			existingItem.Quantity += item.Quantity
+			return tx.Save(&existingItem).Error
+		}
 
-	return r.db.Create(item).Error
+		return tx.Create(item).Error
+	})
 }
 
 func (r *orderCartRepo) GetCartItems(userID, restaurantID string) ([]models.CartItem, error) {
@@ -53,6 +149,33 @@ func (r *orderCartRepo) GetCartItems(userID, restaurantID string) ([]models.Cart
 	return items, result.Error
 }
 
+// LockCartItems returns the items of a cart, locking them until the
+// surrounding transaction ends. It must be called through WithTx.
+func (r *orderCartRepo) LockCartItems(userID, restaurantID string) ([]models.CartItem, error) {
+	var items []models.CartItem
+	result := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ? AND restaurant_id = ?", userID, restaurantID).
+		Order("id").
+		Find(&items)
+	return items, result.Error
+}
+
+// LockCartItem returns a single cart line, locking it until the surrounding
+// transaction ends. It must be called through WithTx.
+func (r *orderCartRepo) LockCartItem(userID, restaurantID, productID, lineKey string) (*models.CartItem, error) {
+	var item models.CartItem
+	err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ? AND restaurant_id = ? AND product_id = ? AND line_key = ?", userID, restaurantID, productID, lineKey).
+		First(&item).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrCartItemNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
 func (r *orderCartRepo) GetAllUserCarts(userID string) (map[string][]models.CartItem, error) {
 	var items []models.CartItem
 	result := r.db.Where("user_id = ?", userID).Find(&items)
@@ -68,25 +191,54 @@ func (r *orderCartRepo) GetAllUserCarts(userID string) (map[string][]models.Cart
 	return cartsByRestaurant, nil
 }
 
-func (r *orderCartRepo) UpdateCartItemQuantity(userID, restaurantID, productID string, quantity int32) error {
+func (r *orderCartRepo) UpdateCartItemQuantity(userID, restaurantID, productID, lineKey string, quantity int32) error {
 	result := r.db.Model(&models.CartItem{}).
-		Where("user_id = ? AND restaurant_id = ? AND product_id = ?", userID, restaurantID, productID).
+		Where("user_id = ? AND restaurant_id = ? AND product_id = ? AND line_key = ?", userID, restaurantID, productID, lineKey).
 		Update("quantity", quantity)
 
+	if result.Error != nil {
+		return result.Error
+	}
 	if result.RowsAffected == 0 {
-		return errors.New("cart item not found")
+		return ErrCartItemNotFound
 	}
-	return result.Error
+	return nil
 }
 
+// RemoveFromCart removes every line of a product from a cart.
 func (r *orderCartRepo) RemoveFromCart(userID, restaurantID, productID string) error {
 	result := r.db.Where("user_id = ? AND restaurant_id = ? AND product_id = ?", userID, restaurantID, productID).
 		Delete(&models.CartItem{})
 
+	if result.Error != nil {
+		return result.Error
+	}
 	if result.RowsAffected == 0 {
-		return errors.New("cart item not found")
+		return ErrCartItemNotFound
 	}
-	return result.Error
+	return nil
+}
+
+// RemoveCartLine removes a single line of a product from a cart.
+func (r *orderCartRepo) RemoveCartLine(userID, restaurantID, productID, lineKey string) error {
+	result := r.db.Where("user_id = ? AND restaurant_id = ? AND product_id = ? AND line_key = ?", userID, restaurantID, productID, lineKey).
+		Delete(&models.CartItem{})
+
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrCartItemNotFound
+	}
+	return nil
+}
+
+// UpdateCartItemDetails saves the product details, price, options and
+// availability of a cart item.
+func (r *orderCartRepo) UpdateCartItemDetails(item *models.CartItem) error {
+	return r.db.Model(item).
+		Select("product_name", "description", "category", "price_minor", "price_currency", "options", "unavailable").
+		Updates(item).Error
 }
 
 func (r *orderCartRepo) ClearCart(userID, restaurantID string) error {
@@ -94,39 +246,68 @@ func (r *orderCartRepo) ClearCart(userID, restaurantID string) error {
 }
 
 // Order operations implementation
-func (r *orderCartRepo) CreateOrder(order *models.Order) error {
-	return r.db.Create(order).Error
+// CreateOrder saves the order together with its initial status event and the
+// outbox messages for its side effects on other services.
+func (r *orderCartRepo) CreateOrder(order *models.Order, outbox []models.OutboxMessage) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(order).Error; err != nil {
+			return err
+		}
+		err := tx.Create(&models.OrderStatusEvent{
+			OrderID:   order.OrderID,
+			ToStatus:  order.OrderStatus,
+			ActorType: string(orderstate.ActorUser),
+			ActorID:   order.UserID,
+		}).Error
+		if err != nil {
+			return err
+		}
+		if len(outbox) == 0 {
+			return nil
+		}
+		return tx.Create(&outbox).Error
+	})
 }
 
 func (r *orderCartRepo) GetAllOrders(userID string) ([]models.Order, error) {
 	var orders []models.Order
-	err := r.db.Preload("OrderItems").Where("user_id = ?", userID).Find(&orders).Error
+	err := r.db.Preload("OrderItems").Preload("OrderCharges").Where("user_id = ?", userID).Find(&orders).Error
 	return orders, err
 }
 
 func (r *orderCartRepo) GetOrderByID(orderID string) (*models.Order, error) {
 	var order models.Order
-	err := r.db.Preload("OrderItems").Where("order_id = ?", orderID).First(&order).Error
+	err := r.db.Preload("OrderItems").Preload("OrderCharges").Preload("Payment").Where("order_id = ?", orderID).First(&order).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, apperr.NotFound("order", orderID)
+	}
 	if err != nil {
 		return nil, err
 	}
 	return &order, nil
 }
 
-func (r *orderCartRepo) UpdateOrderStatus(orderID, status string) error {
-	result := r.db.Model(&models.Order{}).
-		Where("order_id = ?", orderID).
-		Update("order_status", status)
-
-	if result.RowsAffected == 0 {
-		return errors.New("order not found")
-	}
-	return result.Error
+// UpdateOrderStatus moves an order from event.FromStatus to event.ToStatus and
+// records the event in the same transaction. The update only applies if the
+// order is still in event.FromStatus, so concurrent updates cannot skip the
+// lifecycle checks.
+//
+// Confirming an order enqueues the capture of its payment.
+func (r *orderCartRepo) UpdateOrderStatus(event *models.OrderStatusEvent) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := applyStatusEvent(tx, event, map[string]interface{}{
+			"order_status": event.ToStatus,
+		})
+		if err != nil || event.ToStatus != string(orderstate.Confirmed) {
+			return err
+		}
+		return enqueuePaymentCapture(tx, event.OrderID)
+	})
 }
 
 func (r *orderCartRepo) GetRestaurantOrders(restaurantID string, status string) ([]models.Order, error) {
 	var orders []models.Order
-	query := r.db.Preload("OrderItems").Where("restaurant_id = ?", restaurantID)
+	query := r.db.Preload("OrderItems").Preload("OrderCharges").Where("restaurant_id = ?", restaurantID)
 	if status != "" {
 		query = query.Where("order_status = ?", status)
 	}
@@ -134,16 +315,72 @@ func (r *orderCartRepo) GetRestaurantOrders(restaurantID string, status string)
 	return orders, err
 }
 
-func (r *orderCartRepo) UpdateOrderCancellation(orderID, reason string) error {
-	result := r.db.Model(&models.Order{}).
-		Where("order_id = ?", orderID).
-		Updates(map[string]interface{}{
-			"order_status":  "CANCELLED",
-			"cancel_reason": reason,
+// UpdateOrderCancellation cancels an order, storing event.Reason as the
+// cancellation reason. The status event, the release of the order's coupon
+// redemption and the outbox messages that give its stock back to the
+// restaurant and release its payment are written in the same transaction.
+func (r *orderCartRepo) UpdateOrderCancellation(event *models.OrderStatusEvent) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return cancelOrder(tx, event, map[string]interface{}{
+			"order_status":  event.ToStatus,
+			"cancel_reason": event.Reason,
 		})
+	})
+}
 
+// UpdateOrderRejection cancels an order the restaurant rejected, like
+// UpdateOrderCancellation, and stores the restaurant's rejection code.
+func (r *orderCartRepo) UpdateOrderRejection(event *models.OrderStatusEvent, code orderstate.RejectionCode) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return cancelOrder(tx, event, map[string]interface{}{
+			"order_status":   event.ToStatus,
+			"cancel_reason":  event.Reason,
+			"rejection_code": string(code),
+		})
+	})
+}
+
+// cancelOrder applies a cancellation event with updates, then gives the
+// order's stock back, releases its payment and its coupon redemption.
+func cancelOrder(tx *gorm.DB, event *models.OrderStatusEvent, updates map[string]interface{}) error {
+	if err := applyStatusEvent(tx, event, updates); err != nil {
+		return err
+	}
+	if err := releaseCouponRedemption(tx, event.OrderID); err != nil {
+		return err
+	}
+
+	var order models.Order
+	if err := tx.Preload("OrderItems").Where("order_id = ?", event.OrderID).First(&order).Error; err != nil {
+		return err
+	}
+	if err := enqueueStockRelease(tx, &order); err != nil {
+		return err
+	}
+	return enqueuePaymentRelease(tx, &order)
+}
+
+func (r *orderCartRepo) GetOrderStatusEvents(orderID string) ([]models.OrderStatusEvent, error) {
+	var events []models.OrderStatusEvent
+	err := r.db.Where("order_id = ?", orderID).Order("created_at, id").Find(&events).Error
+	return events, err
+}
+
+// applyStatusEvent moves an order from event.FromStatus with updates and
+// records event, failing with ErrOrderStatusConflict if the order is no longer
+// in that status. Orders becoming pending have their pending_since set.
+func applyStatusEvent(tx *gorm.DB, event *models.OrderStatusEvent, updates map[string]interface{}) error {
+	if event.ToStatus == string(orderstate.Pending) {
+		updates["pending_since"] = time.Now()
+	}
+	result := tx.Model(&models.Order{}).
+		Where("order_id = ? AND order_status = ?", event.OrderID, event.FromStatus).
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
 	if result.RowsAffected == 0 {
-		return errors.New("order not found")
+		return ErrOrderStatusConflict
 	}
-	return result.Error
+	return tx.Create(event).Error
 }
@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/models"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/orderstate"
+)
+
+// FindDueScheduledOrders returns the IDs of up to limit scheduled orders whose
+// delivery slot is at or before due, earliest slot first, leaving out the
+// orders in skip.
+func (r *orderCartRepo) FindDueScheduledOrders(due time.Time, skip []string, limit int) ([]string, error) {
+	query := r.db.Model(&models.Order{}).
+		Where("order_status = ? AND scheduled_for <= ?", string(orderstate.Scheduled), due)
+	if len(skip) > 0 {
+		query = query.Where("order_id NOT IN ?", skip)
+	}
+	var orderIDs []string
+	err := query.
+		Order("scheduled_for, id").
+		Limit(limit).
+		Pluck("order_id", &orderIDs).Error
+	return orderIDs, err
+}
+
+// ReleaseScheduledOrder sends a scheduled order to the restaurant. Orders
+// whose stock was deferred start reserving it and become pending once it is
+// reserved; the others become pending at once. Orders that are no longer
+// scheduled, because they were cancelled or released by another replica, are
+// left alone.
+func (r *orderCartRepo) ReleaseScheduledOrder(orderID string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		order, err := lockOrder(tx, orderID)
+		if err != nil {
+			return err
+		}
+		if order.OrderStatus != string(orderstate.Scheduled) {
+			return nil
+		}
+
+		event := &models.OrderStatusEvent{
+			OrderID:    order.OrderID,
+			FromStatus: order.OrderStatus,
+			ToStatus:   string(orderstate.Pending),
+			ActorType:  string(orderstate.ActorSystem),
+			Reason:     "scheduled order released",
+		}
+		if order.StockDeferred {
+			if err := enqueueStockReservation(tx, order); err != nil {
+				return err
+			}
+			event.ToStatus = string(orderstate.Reserving)
+			event.Reason = "scheduled order released, reserving stock"
+		}
+
+		return applyStatusEvent(tx, event, map[string]interface{}{
+			"order_status": event.ToStatus,
+			"released_at":  time.Now(),
+		})
+	})
+}
@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/apperr"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/models"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/money"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/payments"
+)
+
+// Wallet transaction types
+const (
+	// WalletCredit adds money to the balance, e.g. a top-up or a refund.
+	WalletCredit = "CREDIT"
+	// WalletHold reserves part of the balance for an order.
+	WalletHold = "HOLD"
+	// WalletRelease gives held money back to the available balance.
+	WalletRelease = "RELEASE"
+	// WalletDebit takes held money out of the balance.
+	WalletDebit = "DEBIT"
+)
+
+// GetWallet returns a user's wallet. Users without one get an empty wallet.
+func (r *orderCartRepo) GetWallet(userID string) (*models.Wallet, error) {
+	var wallets []models.Wallet
+	if err := r.db.Where("user_id = ?", userID).Limit(1).Find(&wallets).Error; err != nil {
+		return nil, err
+	}
+	if len(wallets) == 0 {
+		return newWallet(userID), nil
+	}
+	return &wallets[0], nil
+}
+
+// GetWalletTransactions returns a page of a user's wallet ledger, newest
+// first.
+func (r *orderCartRepo) GetWalletTransactions(userID string, limit, offset int) ([]models.WalletTransaction, error) {
+	var transactions []models.WalletTransaction
+	err := r.db.Where("user_id = ?", userID).
+		Order("id DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&transactions).Error
+	return transactions, err
+}
+
+// CreditWallet adds amount to a user's wallet and returns the updated wallet.
+func (r *orderCartRepo) CreditWallet(userID string, amount money.Money, description string) (*models.Wallet, error) {
+	var wallet *models.Wallet
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		wallet, err = lockWallet(tx, userID)
+		if err != nil {
+			return err
+		}
+		return recordWalletEntry(tx, wallet, WalletCredit, amount, "", description)
+	})
+	return wallet, err
+}
+
+// HoldWalletFunds reserves amount of a user's wallet for an order. It fails
+// with an INSUFFICIENT_WALLET_BALANCE FailedPrecondition error if the wallet's
+// available balance is too low.
+func (r *orderCartRepo) HoldWalletFunds(userID, orderID string, amount money.Money) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		wallet, err := lockWallet(tx, userID)
+		if err != nil {
+			return err
+		}
+		available := wallet.Balance.Minor - wallet.Held.Minor
+		if available < amount.Minor {
+			return apperr.FailedPrecondition("INSUFFICIENT_WALLET_BALANCE",
+				fmt.Sprintf("wallet balance %s is less than the order total %s",
+					money.New(available, wallet.Balance.Currency), amount))
+		}
+		return recordWalletEntry(tx, wallet, WalletHold, amount, orderID, "held for order")
+	})
+}
+
+func newWallet(userID string) *models.Wallet {
+	return &models.Wallet{
+		UserID:  userID,
+		Balance: money.Zero(money.DefaultCurrency),
+		Held:    money.Zero(money.DefaultCurrency),
+	}
+}
+
+// lockWallet returns a user's wallet, creating it if needed, locked until the
+// surrounding transaction ends.
+func lockWallet(tx *gorm.DB, userID string) (*models.Wallet, error) {
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(newWallet(userID)).Error; err != nil {
+		return nil, err
+	}
+	var wallet models.Wallet
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ?", userID).
+		First(&wallet).Error
+	if err != nil {
+		return nil, err
+	}
+	return &wallet, nil
+}
+
+// recordWalletEntry applies an entry of txType to a locked wallet and appends
+// it to the wallet's ledger.
+func recordWalletEntry(tx *gorm.DB, wallet *models.Wallet, txType string, amount money.Money, orderID, description string) error {
+	switch txType {
+	case WalletCredit:
+		wallet.Balance.Minor += amount.Minor
+	case WalletHold:
+		wallet.Held.Minor += amount.Minor
+	case WalletRelease:
+		wallet.Held.Minor -= amount.Minor
+	case WalletDebit:
+		wallet.Balance.Minor -= amount.Minor
+		wallet.Held.Minor -= amount.Minor
+	default:
+		return fmt.Errorf("unknown wallet transaction type %q", txType)
+	}
+
+	err := tx.Model(wallet).Updates(map[string]interface{}{
+		"balance_minor": wallet.Balance.Minor,
+		"held_minor":    wallet.Held.Minor,
+	}).Error
+	if err != nil {
+		return err
+	}
+	return tx.Create(&models.WalletTransaction{
+		UserID:       wallet.UserID,
+		Type:         txType,
+		Amount:       amount,
+		OrderID:      orderID,
+		Description:  description,
+		BalanceAfter: wallet.Balance,
+		HeldAfter:    wallet.Held,
+	}).Error
+}
+
+// captureWalletPayment debits the funds held for an authorized wallet payment.
+func captureWalletPayment(tx *gorm.DB, userID string, payment *models.Payment) error {
+	wallet, err := lockWallet(tx, userID)
+	if err != nil {
+		return err
+	}
+	if err := recordWalletEntry(tx, wallet, WalletDebit, payment.Amount, payment.OrderID, "paid for order"); err != nil {
+		return err
+	}
+	return tx.Model(payment).Updates(map[string]interface{}{
+		"status":      payments.StatusCaptured,
+		"captured_at": time.Now(),
+	}).Error
+}
+
+// voidWalletPayment releases the funds held for an authorized wallet payment.
+func voidWalletPayment(tx *gorm.DB, userID string, payment *models.Payment) error {
+	wallet, err := lockWallet(tx, userID)
+	if err != nil {
+		return err
+	}
+	if err := recordWalletEntry(tx, wallet, WalletRelease, payment.Amount, payment.OrderID, "released for cancelled order"); err != nil {
+		return err
+	}
+	return tx.Model(payment).Update("status", payments.StatusVoided).Error
+}
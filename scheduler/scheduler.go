@@ -0,0 +1,113 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/apperr"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/repository"
+)
+
+const defaultBatchSize = 100
+
+// Policy decides which delivery slots may be booked and how the stock of a
+// scheduled order is handled.
+type Policy struct {
+	// LeadTime is how long before its slot a scheduled order is released to
+	// the restaurant. Slots must be further away than that.
+	LeadTime time.Duration
+	// MaxAdvance is how far in the future a slot may be booked.
+	MaxAdvance time.Duration
+	// DeferStock reserves the stock of a scheduled order when it is released
+	// rather than when it is placed.
+	DeferStock bool
+}
+
+// CheckSlot returns an InvalidArgument error if slot cannot be booked at now.
+func (p Policy) CheckSlot(field string, slot, now time.Time) error {
+	var description string
+	switch {
+	case !slot.After(now.Add(p.LeadTime)):
+		description = fmt.Sprintf("must be more than %s in the future", p.LeadTime)
+	case slot.After(now.Add(p.MaxAdvance)):
+		description = fmt.Sprintf("must be at most %s in the future", p.MaxAdvance)
+	default:
+		return nil
+	}
+	return apperr.InvalidArgument("invalid "+field+": "+description, apperr.FieldViolation{
+		Field:       field,
+		Description: description,
+	})
+}
+
+// Scheduler releases scheduled orders to the restaurant a lead time before
+// their delivery slot.
+type Scheduler struct {
+	repo      repository.OrderCartRepository
+	leadTime  time.Duration
+	interval  time.Duration
+	batchSize int
+}
+
+func NewScheduler(repo repository.OrderCartRepository, leadTime, interval time.Duration) *Scheduler {
+	return &Scheduler{
+		repo:      repo,
+		leadTime:  leadTime,
+		interval:  interval,
+		batchSize: defaultBatchSize,
+	}
+}
+
+// Run releases due orders every interval until ctx is cancelled.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.ReleaseDue(ctx); err != nil {
+			log.Printf("Scheduled order release failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ReleaseDue releases every scheduled order whose slot is within the lead
+// time, a batch at a time, stopping early if ctx is cancelled. An order that
+// fails to be released is skipped so that it does not hold up the others, and
+// tried again on the next run.
+func (s *Scheduler) ReleaseDue(ctx context.Context) error {
+	due := time.Now().Add(s.leadTime)
+	var released int
+	var failed []string
+	for ctx.Err() == nil {
+		orderIDs, err := s.repo.FindDueScheduledOrders(due, failed, s.batchSize)
+		if err != nil {
+			return fmt.Errorf("failed to find due scheduled orders: %w", err)
+		}
+
+		for _, orderID := range orderIDs {
+			if err := s.repo.ReleaseScheduledOrder(orderID); err != nil {
+				log.Printf("Failed to release scheduled order %s: %v", orderID, err)
+				failed = append(failed, orderID)
+				continue
+			}
+			released++
+		}
+
+		if len(orderIDs) < s.batchSize {
+			break
+		}
+	}
+
+	if released > 0 || len(failed) > 0 {
+		log.Printf("Released %d scheduled orders, %d failed", released, len(failed))
+	}
+	return nil
+}
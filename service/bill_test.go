@@ -0,0 +1,106 @@
+package service
+
+import (
+	"testing"
+
+	orderCartPb "github.com/liju-github/CentralisedFoodbuddyMicroserviceProto/OrderCart"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/auth"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/models"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/money"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/pricing"
+)
+
+func testPricer(t *testing.T) *pricing.Engine {
+	t.Helper()
+	rules, err := pricing.ParseRules("default:5", "", "30", "")
+	if err != nil {
+		t.Fatalf("ParseRules: %v", err)
+	}
+	return pricing.NewEngine(rules)
+}
+
+// TestCartTotals checks that the cart RPCs report the same grand total as the
+// cart's bill: items, tax and the default delivery fee.
+func TestCartTotals(t *testing.T) {
+	repo := &fakeRepo{cart: []models.CartItem{
+		{UserID: "user1", RestaurantID: "rest1", ProductID: "p1", Price: money.FromMajor(100, money.DefaultCurrency), Quantity: 2},
+	}}
+	conn := dial(t, &OrderCartService{repo: repo, pricer: testPricer(t)})
+	client := orderCartPb.NewOrderCartServiceClient(conn)
+	ctx := as(t, auth.RoleUser, "user1")
+	const want = 200 + 10 + 30
+
+	var bill GetCartBillResponse
+	err := invokeExtension(ctx, conn, "GetCartBill", &GetCartBillRequest{UserId: "user1", RestaurantId: "rest1"}, &bill)
+	if err != nil {
+		t.Fatalf("GetCartBill: %v", err)
+	}
+	if bill.Bill.TotalAmount != want {
+		t.Errorf("GetCartBill total = %v, want %v", bill.Bill.TotalAmount, want)
+	}
+
+	items, err := client.GetCartItems(ctx, &orderCartPb.GetCartItemsRequest{UserId: "user1", RestaurantId: "rest1"})
+	if err != nil {
+		t.Fatalf("GetCartItems: %v", err)
+	}
+	if items.TotalAmount != want {
+		t.Errorf("GetCartItems total = %v, want %v", items.TotalAmount, want)
+	}
+
+	cart, err := client.GetCartByRestaurant(ctx, &orderCartPb.GetCartByRestaurantRequest{UserId: "user1", RestaurantId: "rest1"})
+	if err != nil {
+		t.Fatalf("GetCartByRestaurant: %v", err)
+	}
+	if cart.TotalAmount != want {
+		t.Errorf("GetCartByRestaurant total = %v, want %v", cart.TotalAmount, want)
+	}
+
+	var lines GetCartLinesResponse
+	err = invokeExtension(ctx, conn, "GetCartLines", &GetCartLinesRequest{UserId: "user1", RestaurantId: "rest1"}, &lines)
+	if err != nil {
+		t.Fatalf("GetCartLines: %v", err)
+	}
+	if lines.TotalAmount != want {
+		t.Errorf("GetCartLines total = %v, want %v", lines.TotalAmount, want)
+	}
+
+	carts, err := client.GetAllCarts(ctx, &orderCartPb.GetAllCartsRequest{UserId: "user1"})
+	if err != nil {
+		t.Fatalf("GetAllCarts: %v", err)
+	}
+	if len(carts.Carts) != 1 || carts.Carts[0].TotalAmount != want {
+		t.Errorf("GetAllCarts = %v, want one cart totalling %v", carts.Carts, want)
+	}
+}
+
+func TestGetOrderBillOverGRPC(t *testing.T) {
+	const orderID = "order_0b8f6a3e-7c1d-4e2f-9a5b-1c2d3e4f5a6b"
+	inr := func(major float64) money.Money { return money.FromMajor(major, money.DefaultCurrency) }
+	repo := &fakeRepo{orders: map[string]*models.Order{
+		orderID: {
+			OrderID:      orderID,
+			UserID:       "user1",
+			RestaurantID: "rest1",
+			OrderItems:   []models.OrderItem{{ProductID: "p1", ProductName: "Dosa", Price: inr(100), Quantity: 2}},
+			OrderCharges: []models.OrderCharge{
+				{Type: pricing.ChargeTax, Label: "Tax 5%", Rate: 500, Amount: inr(10)},
+				{Type: pricing.ChargeDelivery, Label: "Delivery", Amount: inr(30)},
+			},
+			Total: inr(240),
+		},
+	}}
+	conn := dial(t, &OrderCartService{repo: repo})
+
+	var resp GetOrderBillResponse
+	err := invokeExtension(as(t, auth.RoleRestaurant, "rest1"), conn, "GetOrderBill", &GetOrderBillRequest{OrderId: orderID}, &resp)
+	if err != nil {
+		t.Fatalf("GetOrderBill: %v", err)
+	}
+	bill := resp.Bill
+	if resp.OrderId != orderID || bill.Subtotal != 200 || bill.TotalAmount != 240 || len(bill.Items) != 1 || len(bill.Charges) != 2 {
+		t.Fatalf("GetOrderBill = %+v", bill)
+	}
+	if c := bill.Charges[0]; c.Type != pricing.ChargeTax || c.RatePercent != 5 || c.Amount != 10 {
+		t.Errorf("tax charge = %+v", c)
+	}
+}
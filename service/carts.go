@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/auth"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/money"
+)
+
+const (
+	defaultAbandonedCartsLimit = 50
+	maxAbandonedCartsLimit     = 500
+)
+
+// GetAbandonedCarts reports carts that have not been touched for more than
+// IdleHours and are worth at least MinValue, most valuable first. It is only
+// available to admins.
+func (s *OrderCartService) GetAbandonedCarts(ctx context.Context, req *GetAbandonedCartsRequest) (*GetAbandonedCartsResponse, error) {
+	if err := auth.RequireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	limit := int(req.Limit)
+	if limit == 0 {
+		limit = defaultAbandonedCartsLimit
+	}
+	idleSince := time.Now().Add(-time.Duration(req.IdleHours) * time.Hour)
+	minValue := money.FromMajor(req.MinValue, money.DefaultCurrency)
+
+	summaries, err := s.repo.GetAbandonedCarts(idleSince, minValue.Minor, limit, int(req.Offset))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get abandoned carts: %w", err)
+	}
+
+	var carts []*AbandonedCart
+	for _, summary := range summaries {
+		carts = append(carts, &AbandonedCart{
+			UserId:         summary.UserID,
+			RestaurantId:   summary.RestaurantID,
+			Lines:          int32(summary.LineCount),
+			Quantity:       int32(summary.TotalQuantity),
+			TotalAmount:    money.New(summary.ValueMinor, summary.Currency).Major(),
+			Currency:       summary.Currency,
+			LastActivityAt: summary.LastActivityAt.Format(time.RFC3339),
+		})
+	}
+
+	return &GetAbandonedCartsResponse{
+		Carts:   carts,
+		Message: "Abandoned carts retrieved successfully",
+	}, nil
+}
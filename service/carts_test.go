@@ -0,0 +1,38 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/auth"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/repository"
+)
+
+func TestGetAbandonedCartsOverGRPC(t *testing.T) {
+	lastActivity := time.Now().Add(-48 * time.Hour).Truncate(time.Second).UTC()
+	repo := &fakeRepo{abandoned: []repository.CartSummary{
+		{UserID: "user1", RestaurantID: "rest1", LineCount: 2, TotalQuantity: 3, ValueMinor: 45000, Currency: "INR", LastActivityAt: lastActivity},
+		{UserID: "user2", RestaurantID: "rest1", LineCount: 1, TotalQuantity: 1, ValueMinor: 5000, Currency: "INR", LastActivityAt: lastActivity},
+	}}
+	conn := dial(t, &OrderCartService{repo: repo})
+	req := &GetAbandonedCartsRequest{IdleHours: 24, MinValue: 100}
+
+	var resp GetAbandonedCartsResponse
+	if err := invokeExtension(as(t, auth.RoleAdmin, "admin1"), conn, "GetAbandonedCarts", req, &resp); err != nil {
+		t.Fatalf("GetAbandonedCarts: %v", err)
+	}
+	if len(resp.Carts) != 1 {
+		t.Fatalf("got %d carts, want the one worth at least 100", len(resp.Carts))
+	}
+	if c := resp.Carts[0]; c.UserId != "user1" || c.Lines != 2 || c.Quantity != 3 || c.TotalAmount != 450 || c.LastActivityAt != lastActivity.Format(time.RFC3339) {
+		t.Errorf("abandoned cart = %+v", c)
+	}
+
+	err := invokeExtension(as(t, auth.RoleUser, "user1"), conn, "GetAbandonedCarts", req, &GetAbandonedCartsResponse{})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("GetAbandonedCarts as a user: error = %v, want PermissionDenied", err)
+	}
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"time"
+
+	orderCartPb "github.com/liju-github/CentralisedFoodbuddyMicroserviceProto/OrderCart"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/models"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/money"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/pricing"
+)
+
+// cartItemsToPb converts cart items to their protobuf form. Prices leave the
+// service as decimals in major units.
+func cartItemsToPb(items []models.CartItem) []*orderCartPb.CartItem {
+	var cartItems []*orderCartPb.CartItem
+	for _, item := range items {
+		cartItems = append(cartItems, &orderCartPb.CartItem{
+			ProductId:    item.ProductID,
+			RestaurantId: item.RestaurantID,
+			ProductName:  item.ProductName,
+			Description:  item.Description,
+			Category:     item.Category,
+			Price:        pricing.UnitPrice(item.Price, item.Options).Major(),
+			Quantity:     item.Quantity,
+		})
+	}
+	return cartItems
+}
+
+// orderToPb converts an order and its items to their protobuf form.
+func orderToPb(order *models.Order) *orderCartPb.Order {
+	var orderItems []*orderCartPb.OrderItem
+	for _, item := range order.OrderItems {
+		orderItems = append(orderItems, &orderCartPb.OrderItem{
+			ProductId:   item.ProductID,
+			ProductName: item.ProductName,
+			Description: item.Description,
+			Category:    item.Category,
+			Price:       pricing.UnitPrice(item.Price, item.Options).Major(),
+			Quantity:    item.Quantity,
+		})
+	}
+
+	return &orderCartPb.Order{
+		OrderId:      order.OrderID,
+		UserId:       order.UserID,
+		RestaurantId: order.RestaurantID,
+		Items:        orderItems,
+		TotalAmount:  order.Total.Major(),
+		OrderStatus:  order.OrderStatus,
+		CreatedAt:    order.CreatedAt.Format(time.RFC3339),
+		DeliveryAddress: &orderCartPb.Address{
+			StreetName: order.StreetName,
+			Locality:   order.Locality,
+			State:      order.State,
+			Pincode:    order.Pincode,
+		},
+		CancelReason: order.CancelReason,
+	}
+}
+
+// billToPb converts priced lines and the charges on top of them to a bill.
+func billToPb(lines []pricing.Line, subtotal money.Money, charges []models.OrderCharge, total money.Money) *Bill {
+	bill := &Bill{
+		Currency:    total.Currency,
+		Subtotal:    subtotal.Major(),
+		TotalAmount: total.Major(),
+	}
+	for _, line := range lines {
+		bill.Items = append(bill.Items, &BillItem{
+			ProductId:   line.ProductID,
+			ProductName: line.ProductName,
+			UnitPrice:   line.UnitPrice.Major(),
+			Quantity:    line.Quantity,
+			Amount:      line.Amount().Major(),
+		})
+	}
+	for _, charge := range charges {
+		bill.Charges = append(bill.Charges, &BillCharge{
+			Type:        charge.Type,
+			Label:       charge.Label,
+			RatePercent: float64(charge.Rate) / 100,
+			Amount:      charge.Amount.Major(),
+		})
+	}
+	return bill
+}
+
+// cartLinesToPb converts cart items to cart lines with their options.
+func cartLinesToPb(items []models.CartItem) []*CartLine {
+	var lines []*CartLine
+	for _, item := range items {
+		unitPrice := pricing.UnitPrice(item.Price, item.Options)
+		line := &CartLine{
+			ProductId:           item.ProductID,
+			RestaurantId:        item.RestaurantID,
+			ProductName:         item.ProductName,
+			Category:            item.Category,
+			LineKey:             item.LineKey,
+			SpecialInstructions: item.SpecialInstructions,
+			UnitPrice:           unitPrice.Major(),
+			Quantity:            item.Quantity,
+			Amount:              unitPrice.Times(int64(item.Quantity)).Major(),
+			Unavailable:         item.Unavailable,
+		}
+		for _, option := range item.Options {
+			line.Options = append(line.Options, &CartLineOption{
+				OptionId:   option.OptionID,
+				GroupName:  option.GroupName,
+				Name:       option.Name,
+				PriceDelta: option.PriceDelta.Major(),
+			})
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// productOptionToPb converts a product option to its protobuf form.
+func productOptionToPb(option models.ProductOption) *ProductOption {
+	return &ProductOption{
+		OptionId:   option.OptionID,
+		GroupName:  option.GroupName,
+		GroupType:  option.GroupType,
+		Name:       option.Name,
+		PriceDelta: option.PriceDelta.Major(),
+		Active:     option.Active,
+	}
+}
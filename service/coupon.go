@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/apperr"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/auth"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/coupon"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/money"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/pricing"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/repository"
+)
+
+// ApplyCoupon applies a coupon to the user's cart at a restaurant, replacing
+// any coupon applied before, and returns the discounted bill.
+//
+// The method returns a NotFound error for an unknown coupon and a
+// FailedPrecondition error if the coupon cannot be used on the cart.
+func (s *OrderCartService) ApplyCoupon(ctx context.Context, req *ApplyCouponRequest) (*ApplyCouponResponse, error) {
+	if err := auth.RequireUser(ctx, req.UserId); err != nil {
+		return nil, err
+	}
+
+	items, err := s.repo.GetCartItems(req.UserId, req.RestaurantId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cart items: %w", err)
+	}
+	if len(items) == 0 {
+		return nil, apperr.FailedPrecondition("CART_EMPTY", fmt.Sprintf("cart is empty for restaurant %s", req.RestaurantId))
+	}
+
+	lines := pricing.CartLines(items)
+	subtotal, err := pricing.Total(lines)
+	if err != nil {
+		return nil, fmt.Errorf("failed to price cart: %w", err)
+	}
+
+	discount, err := couponDiscount(s.repo, coupon.Normalize(req.CouponCode), req.UserId, req.RestaurantId, subtotal, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.SetCartCoupon(req.UserId, req.RestaurantId, discount.Code); err != nil {
+		return nil, fmt.Errorf("failed to apply coupon: %w", err)
+	}
+
+	bill, err := s.pricer.Quote(lines, pricing.Options{Discounts: []pricing.Discount{discount}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to price cart: %w", err)
+	}
+
+	return &ApplyCouponResponse{
+		CouponCode: discount.Code,
+		Discount:   bill.Discount.Major(),
+		Bill:       billToPb(lines, bill.Subtotal, bill.Charges(""), bill.GrandTotal),
+		Message:    "Coupon applied successfully",
+	}, nil
+}
+
+// RemoveCoupon removes the coupon applied to the user's cart at a restaurant.
+// Removing a coupon from a cart without one succeeds.
+func (s *OrderCartService) RemoveCoupon(ctx context.Context, req *RemoveCouponRequest) (*RemoveCouponResponse, error) {
+	if err := auth.RequireUser(ctx, req.UserId); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.RemoveCartCoupon(req.UserId, req.RestaurantId); err != nil {
+		return nil, fmt.Errorf("failed to remove coupon: %w", err)
+	}
+
+	return &RemoveCouponResponse{
+		Success: true,
+		Message: "Coupon removed successfully",
+	}, nil
+}
+
+// couponDiscount returns the discount coupon code gives the user's cart at
+// restaurantID with the given item subtotal. With lock set the coupon is
+// locked until the surrounding transaction ends.
+func couponDiscount(repo repository.OrderCartRepository, code, userID, restaurantID string, subtotal money.Money, lock bool) (pricing.Discount, error) {
+	getCoupon := repo.GetCoupon
+	if lock {
+		getCoupon = repo.LockCoupon
+	}
+	c, err := getCoupon(code)
+	if err != nil {
+		return pricing.Discount{}, fmt.Errorf("failed to get coupon: %w", err)
+	}
+
+	redemptions, err := repo.CountCouponRedemptions(c.Code, userID)
+	if err != nil {
+		return pricing.Discount{}, fmt.Errorf("failed to count coupon redemptions: %w", err)
+	}
+
+	amount, err := coupon.Discount(c, restaurantID, subtotal, redemptions, time.Now())
+	if err != nil {
+		return pricing.Discount{}, err
+	}
+	return pricing.Discount{Code: c.Code, Amount: amount}, nil
+}
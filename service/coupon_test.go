@@ -0,0 +1,120 @@
+package service
+
+import (
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	orderCartPb "github.com/liju-github/CentralisedFoodbuddyMicroserviceProto/OrderCart"
+	restaurantPb "github.com/liju-github/CentralisedFoodbuddyMicroserviceProto/Restaurant"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/auth"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/coupon"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/models"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/money"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/payments"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/scheduler"
+)
+
+func TestCouponsOverGRPC(t *testing.T) {
+	inr := func(major float64) money.Money { return money.FromMajor(major, money.DefaultCurrency) }
+	repo := &fakeRepo{
+		cart: []models.CartItem{
+			{UserID: "user1", RestaurantID: "rest1", ProductID: "p1", Price: inr(100), Quantity: 2},
+		},
+		coupons: map[string]*models.Coupon{
+			"SAVE50": {Code: "SAVE50", Type: coupon.TypeFlat, FlatOff: inr(50), MinOrder: inr(150), PerUserLimit: 1, Active: true},
+		},
+	}
+	conn := dial(t, &OrderCartService{repo: repo, pricer: testPricer(t)})
+	ctx := as(t, auth.RoleUser, "user1")
+
+	var applied ApplyCouponResponse
+	err := invokeExtension(ctx, conn, "ApplyCoupon", &ApplyCouponRequest{UserId: "user1", RestaurantId: "rest1", CouponCode: "save50"}, &applied)
+	if err != nil {
+		t.Fatalf("ApplyCoupon: %v", err)
+	}
+	// 200 less 50 off, 5% tax on the remaining 150 and the 30 delivery fee
+	const discounted = 150 + 7.5 + 30
+	if applied.CouponCode != "SAVE50" || applied.Discount != 50 || applied.Bill.TotalAmount != discounted {
+		t.Errorf("ApplyCoupon = %+v, bill %+v", applied, applied.Bill)
+	}
+
+	var bill GetCartBillResponse
+	if err := invokeExtension(ctx, conn, "GetCartBill", &GetCartBillRequest{UserId: "user1", RestaurantId: "rest1"}, &bill); err != nil {
+		t.Fatalf("GetCartBill: %v", err)
+	}
+	if bill.Bill.TotalAmount != discounted {
+		t.Errorf("GetCartBill total with coupon = %v, want %v", bill.Bill.TotalAmount, discounted)
+	}
+
+	if err := invokeExtension(ctx, conn, "RemoveCoupon", &RemoveCouponRequest{UserId: "user1", RestaurantId: "rest1"}, &RemoveCouponResponse{}); err != nil {
+		t.Fatalf("RemoveCoupon: %v", err)
+	}
+	if err := invokeExtension(ctx, conn, "GetCartBill", &GetCartBillRequest{UserId: "user1", RestaurantId: "rest1"}, &bill); err != nil {
+		t.Fatalf("GetCartBill: %v", err)
+	}
+	if bill.Bill.TotalAmount != 200+10+30 {
+		t.Errorf("GetCartBill total after RemoveCoupon = %v, want 240", bill.Bill.TotalAmount)
+	}
+
+	tests := []struct {
+		name string
+		code string
+		want codes.Code
+	}{
+		{"unknown coupon", "NOPE", codes.NotFound},
+		{"user limit reached", "SAVE50", codes.FailedPrecondition},
+	}
+	repo.redemptions = []models.CouponRedemption{{CouponCode: "SAVE50", UserID: "user1", OrderID: "order1"}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := invokeExtension(ctx, conn, "ApplyCoupon", &ApplyCouponRequest{UserId: "user1", RestaurantId: "rest1", CouponCode: tt.code}, &ApplyCouponResponse{})
+			if status.Code(err) != tt.want {
+				t.Errorf("ApplyCoupon(%s) error = %v, want %s", tt.code, err, tt.want)
+			}
+		})
+	}
+}
+
+// TestCouponRedeemedByOrder checks that placing an order redeems its cart's
+// coupon, so that its per-user limit holds while the order is live. Releasing
+// the redemption when the order is cancelled is the repository's job, which
+// the fake does not do.
+func TestCouponRedeemedByOrder(t *testing.T) {
+	inr := func(major float64) money.Money { return money.FromMajor(major, money.DefaultCurrency) }
+	repo := &fakeRepo{
+		cart: []models.CartItem{
+			{UserID: "user1", RestaurantID: "rest1", ProductID: "p1", ProductName: "Dosa", Price: inr(100), Quantity: 2},
+		},
+		coupons: map[string]*models.Coupon{
+			"SAVE50": {Code: "SAVE50", Type: coupon.TypeFlat, FlatOff: inr(50), MinOrder: inr(150), PerUserLimit: 1, UsageLimit: 1, Active: true},
+		},
+	}
+	restaurant := &fakeRestaurant{products: map[string]*restaurantPb.Product{
+		"p1": {ProductId: "p1", RestaurantId: "rest1", Name: "Dosa", Price: 100, Stock: 10},
+	}}
+	conn := dial(t, NewOrderCartService(repo, restaurant, fakeUser{}, testPricer(t), scheduler.Policy{}, payments.NewFake(payments.OutcomeSucceed)))
+	client := orderCartPb.NewOrderCartServiceClient(conn)
+	ctx := as(t, auth.RoleUser, "user1")
+	apply := &ApplyCouponRequest{UserId: "user1", RestaurantId: "rest1", CouponCode: "SAVE50"}
+
+	if err := invokeExtension(ctx, conn, "ApplyCoupon", apply, &ApplyCouponResponse{}); err != nil {
+		t.Fatalf("ApplyCoupon: %v", err)
+	}
+	_, err := client.PlaceOrderByRestID(ctx, &orderCartPb.PlaceOrderByRestIDRequest{UserId: "user1", RestaurantId: "rest1", DeliveryAddressId: "addr1"})
+	if err != nil {
+		t.Fatalf("PlaceOrderByRestID: %v", err)
+	}
+	if used := repo.coupons["SAVE50"].UsedCount; used != 1 {
+		t.Fatalf("coupon used %d times after the order, want 1", used)
+	}
+
+	repo.cart = []models.CartItem{
+		{UserID: "user1", RestaurantID: "rest1", ProductID: "p1", ProductName: "Dosa", Price: inr(100), Quantity: 2},
+	}
+	err = invokeExtension(ctx, conn, "ApplyCoupon", apply, &ApplyCouponResponse{})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("ApplyCoupon while the order is live: error = %v, want FailedPrecondition", err)
+	}
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+
+	orderCartPb "github.com/liju-github/CentralisedFoodbuddyMicroserviceProto/OrderCart"
+)
+
+// ExtensionServiceName is the gRPC service serving the RPCs that are not yet
+// part of the shared OrderCart proto.
+const ExtensionServiceName = "ordercart.OrderCartExtensionService"
+
+// ExtensionServer is the server API of the extension service.
+type ExtensionServer interface {
+	GetOrderTimeline(context.Context, *GetOrderTimelineRequest) (*GetOrderTimelineResponse, error)
+	GetCartBill(context.Context, *GetCartBillRequest) (*GetCartBillResponse, error)
+	GetOrderBill(context.Context, *GetOrderBillRequest) (*GetOrderBillResponse, error)
+	ApplyCoupon(context.Context, *ApplyCouponRequest) (*ApplyCouponResponse, error)
+	RemoveCoupon(context.Context, *RemoveCouponRequest) (*RemoveCouponResponse, error)
+	RefreshCart(context.Context, *RefreshCartRequest) (*RefreshCartResponse, error)
+	GetAbandonedCarts(context.Context, *GetAbandonedCartsRequest) (*GetAbandonedCartsResponse, error)
+	SetProductOptions(context.Context, *SetProductOptionsRequest) (*SetProductOptionsResponse, error)
+	GetProductOptions(context.Context, *GetProductOptionsRequest) (*GetProductOptionsResponse, error)
+	AddCustomizedProductToCart(context.Context, *AddCustomizedProductToCartRequest) (*AddCustomizedProductToCartResponse, error)
+	UpdateCartLine(context.Context, *UpdateCartLineRequest) (*UpdateCartLineResponse, error)
+	GetCartLines(context.Context, *GetCartLinesRequest) (*GetCartLinesResponse, error)
+	SetCartInstructions(context.Context, *SetCartInstructionsRequest) (*SetCartInstructionsResponse, error)
+	GetRestaurantKitchenOrders(context.Context, *orderCartPb.GetRestaurantOrdersRequest) (*GetRestaurantKitchenOrdersResponse, error)
+	GetOrderPayment(context.Context, *GetOrderPaymentRequest) (*GetOrderPaymentResponse, error)
+	GetWalletBalance(context.Context, *GetWalletBalanceRequest) (*GetWalletBalanceResponse, error)
+	GetWalletTransactions(context.Context, *GetWalletTransactionsRequest) (*GetWalletTransactionsResponse, error)
+	CreditWallet(context.Context, *CreditWalletRequest) (*CreditWalletResponse, error)
+	IssueRefund(context.Context, *IssueRefundRequest) (*IssueRefundResponse, error)
+	GetOrderRefunds(context.Context, *GetOrderRefundsRequest) (*GetOrderRefundsResponse, error)
+	RejectOrder(context.Context, *RejectOrderRequest) (*RejectOrderResponse, error)
+}
+
+// ExtensionServiceDesc describes the extension service for
+// grpc.Server.RegisterService. Its messages are the types in messages.go, and
+// the OrderCart messages some of them reuse, encoded with the JSON codec.
+// Calls pass through the server's interceptors like any OrderCartService
+// call, so they are authenticated and validated.
+var ExtensionServiceDesc = grpc.ServiceDesc{
+	ServiceName: ExtensionServiceName,
+	HandlerType: (*ExtensionServer)(nil),
+	Methods: []grpc.MethodDesc{
+		extensionMethod("GetOrderTimeline", ExtensionServer.GetOrderTimeline),
+		extensionMethod("GetCartBill", ExtensionServer.GetCartBill),
+		extensionMethod("GetOrderBill", ExtensionServer.GetOrderBill),
+		extensionMethod("ApplyCoupon", ExtensionServer.ApplyCoupon),
+		extensionMethod("RemoveCoupon", ExtensionServer.RemoveCoupon),
+		extensionMethod("RefreshCart", ExtensionServer.RefreshCart),
+		extensionMethod("GetAbandonedCarts", ExtensionServer.GetAbandonedCarts),
+		extensionMethod("SetProductOptions", ExtensionServer.SetProductOptions),
+		extensionMethod("GetProductOptions", ExtensionServer.GetProductOptions),
+		extensionMethod("AddCustomizedProductToCart", ExtensionServer.AddCustomizedProductToCart),
+		extensionMethod("UpdateCartLine", ExtensionServer.UpdateCartLine),
+		extensionMethod("GetCartLines", ExtensionServer.GetCartLines),
+		extensionMethod("SetCartInstructions", ExtensionServer.SetCartInstructions),
+		extensionMethod("GetRestaurantKitchenOrders", ExtensionServer.GetRestaurantKitchenOrders),
+		extensionMethod("GetOrderPayment", ExtensionServer.GetOrderPayment),
+		extensionMethod("GetWalletBalance", ExtensionServer.GetWalletBalance),
+		extensionMethod("GetWalletTransactions", ExtensionServer.GetWalletTransactions),
+		extensionMethod("CreditWallet", ExtensionServer.CreditWallet),
+		extensionMethod("IssueRefund", ExtensionServer.IssueRefund),
+		extensionMethod("GetOrderRefunds", ExtensionServer.GetOrderRefunds),
+		extensionMethod("RejectOrder", ExtensionServer.RejectOrder),
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "service/messages.go",
+}
+
+// extensionMethod returns the descriptor of the extension service method name,
+// which decodes its request into a Req and answers it with call.
+func extensionMethod[Req, Resp any](name string, call func(ExtensionServer, context.Context, *Req) (*Resp, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			in := new(Req)
+			if err := dec(in); err != nil {
+				return nil, err
+			}
+			if interceptor == nil {
+				return call(srv.(ExtensionServer), ctx, in)
+			}
+			info := &grpc.UnaryServerInfo{
+				Server:     srv,
+				FullMethod: "/" + ExtensionServiceName + "/" + name,
+			}
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				return call(srv.(ExtensionServer), ctx, req.(*Req))
+			}
+			return interceptor(ctx, in, info, handler)
+		},
+	}
+}
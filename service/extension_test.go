@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"gorm.io/gorm"
+
+	orderCartPb "github.com/liju-github/CentralisedFoodbuddyMicroserviceProto/OrderCart"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/apperr"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/auth"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/models"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/validation"
+)
+
+var testSecret = []byte("test-secret")
+
+// dial serves svc over an in-memory listener with the production interceptor
+// chain and returns a client connection to it.
+func dial(t *testing.T, svc *OrderCartService) *grpc.ClientConn {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(
+			apperr.UnaryServerInterceptor(),
+			auth.UnaryServerInterceptor(testSecret),
+			validation.UnaryServerInterceptor(),
+		),
+	)
+	orderCartPb.RegisterOrderCartServiceServer(server, svc)
+	server.RegisterService(&ExtensionServiceDesc, svc)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("failed to dial test server: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// as returns a context carrying a bearer token for subject in role.
+func as(t *testing.T, role auth.Role, subject string) context.Context {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.Claims{
+		Role: string(role),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   subject,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}).SignedString(testSecret)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+// invokeExtension calls method of the extension service.
+func invokeExtension(ctx context.Context, conn *grpc.ClientConn, method string, req, resp interface{}) error {
+	return conn.Invoke(ctx, "/"+ExtensionServiceName+"/"+method, req, resp, grpc.CallContentSubtype(JSONCodecName))
+}
+
+func TestGetOrderTimelineOverGRPC(t *testing.T) {
+	const orderID = "order_0b8f6a3e-7c1d-4e2f-9a5b-1c2d3e4f5a6b"
+	created := time.Date(2024, 11, 21, 10, 0, 0, 0, time.UTC)
+	repo := &fakeRepo{
+		orders: map[string]*models.Order{
+			orderID: {OrderID: orderID, UserID: "user1", RestaurantID: "rest1", OrderStatus: "CONFIRMED"},
+		},
+		events: map[string][]models.OrderStatusEvent{
+			orderID: {
+				{Model: gorm.Model{CreatedAt: created}, OrderID: orderID, ToStatus: "PENDING", ActorType: "user", ActorID: "user1"},
+				{Model: gorm.Model{CreatedAt: created.Add(time.Minute)}, OrderID: orderID, FromStatus: "PENDING", ToStatus: "CONFIRMED", ActorType: "restaurant", ActorID: "rest1"},
+			},
+		},
+	}
+	conn := dial(t, &OrderCartService{repo: repo})
+
+	var resp GetOrderTimelineResponse
+	err := invokeExtension(as(t, auth.RoleUser, "user1"), conn, "GetOrderTimeline", &GetOrderTimelineRequest{OrderId: orderID}, &resp)
+	if err != nil {
+		t.Fatalf("GetOrderTimeline: %v", err)
+	}
+	if resp.OrderId != orderID || resp.CurrentStatus != "CONFIRMED" || len(resp.Events) != 2 {
+		t.Fatalf("GetOrderTimeline = %+v", resp)
+	}
+	if e := resp.Events[1]; e.FromStatus != "PENDING" || e.ToStatus != "CONFIRMED" || e.ActorId != "rest1" || e.CreatedAt != "2024-11-21T10:01:00Z" {
+		t.Errorf("second event = %+v", e)
+	}
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		orderID string
+		want    codes.Code
+	}{
+		{"invalid order ID is rejected by validation", as(t, auth.RoleUser, "user1"), "42", codes.InvalidArgument},
+		{"missing token", context.Background(), orderID, codes.Unauthenticated},
+		{"other user", as(t, auth.RoleUser, "user2"), orderID, codes.PermissionDenied},
+		{"unknown order", as(t, auth.RoleAdmin, "admin1"), "order_00000000-0000-0000-0000-000000000000", codes.NotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := invokeExtension(tt.ctx, conn, "GetOrderTimeline", &GetOrderTimelineRequest{OrderId: tt.orderID}, &GetOrderTimelineResponse{})
+			if status.Code(err) != tt.want {
+				t.Errorf("GetOrderTimeline error = %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
+
+// TestExtensionMethodsValidate checks that every extension method is routed
+// through the validation interceptor by calling it with an empty request.
+func TestExtensionMethodsValidate(t *testing.T) {
+	conn := dial(t, &OrderCartService{repo: &fakeRepo{}})
+	ctx := as(t, auth.RoleAdmin, "admin1")
+
+	for _, method := range ExtensionServiceDesc.Methods {
+		t.Run(method.MethodName, func(t *testing.T) {
+			err := invokeExtension(ctx, conn, method.MethodName, struct{}{}, &struct{}{})
+			if status.Code(err) != codes.InvalidArgument {
+				t.Errorf("%s with an empty request: error = %v, want InvalidArgument", method.MethodName, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,366 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+
+	restaurantPb "github.com/liju-github/CentralisedFoodbuddyMicroserviceProto/Restaurant"
+	userPb "github.com/liju-github/CentralisedFoodbuddyMicroserviceProto/User"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/apperr"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/clients"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/models"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/money"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/orderstate"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/payments"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/repository"
+)
+
+// fakeRepo stubs the repository methods the tests use; calling any other
+// method panics.
+type fakeRepo struct {
+	repository.OrderCartRepository
+	orders map[string]*models.Order
+	events map[string][]models.OrderStatusEvent
+	cart   []models.CartItem
+
+	coupons     map[string]*models.Coupon
+	cartCoupons map[string]string
+	redemptions []models.CouponRedemption
+
+	abandoned []repository.CartSummary
+
+	options []models.ProductOption
+
+	instructions *models.CartInstructions
+	payments     map[string]*models.Payment
+	wallets      map[string]*models.Wallet
+	refunds      map[string][]models.Refund
+}
+
+func (r *fakeRepo) GetOrderByID(orderID string) (*models.Order, error) {
+	order, ok := r.orders[orderID]
+	if !ok {
+		return nil, apperr.NotFound("order", orderID)
+	}
+	return order, nil
+}
+
+func (r *fakeRepo) GetOrderStatusEvents(orderID string) ([]models.OrderStatusEvent, error) {
+	return r.events[orderID], nil
+}
+
+func (r *fakeRepo) GetCartItems(userID, restaurantID string) ([]models.CartItem, error) {
+	var items []models.CartItem
+	for _, item := range r.cart {
+		if item.UserID == userID && (restaurantID == "" || item.RestaurantID == restaurantID) {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func (r *fakeRepo) GetAllUserCarts(userID string) (map[string][]models.CartItem, error) {
+	carts := make(map[string][]models.CartItem)
+	for _, item := range r.cart {
+		if item.UserID == userID {
+			carts[item.RestaurantID] = append(carts[item.RestaurantID], item)
+		}
+	}
+	return carts, nil
+}
+
+func (r *fakeRepo) GetCoupon(code string) (*models.Coupon, error) {
+	c, ok := r.coupons[code]
+	if !ok {
+		return nil, apperr.NotFound("coupon", code)
+	}
+	return c, nil
+}
+
+func (r *fakeRepo) LockCoupon(code string) (*models.Coupon, error) {
+	return r.GetCoupon(code)
+}
+
+func (r *fakeRepo) RedeemCoupon(redemption *models.CouponRedemption) error {
+	r.coupons[redemption.CouponCode].UsedCount++
+	r.redemptions = append(r.redemptions, *redemption)
+	return nil
+}
+
+func (r *fakeRepo) CountCouponRedemptions(code, userID string) (int64, error) {
+	var n int64
+	for _, redemption := range r.redemptions {
+		if redemption.CouponCode == code && redemption.UserID == userID {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (r *fakeRepo) GetCartCoupon(userID, restaurantID string) (*models.CartCoupon, error) {
+	code, ok := r.cartCoupons[userID+"/"+restaurantID]
+	if !ok {
+		return nil, nil
+	}
+	return &models.CartCoupon{UserID: userID, RestaurantID: restaurantID, CouponCode: code}, nil
+}
+
+func (r *fakeRepo) SetCartCoupon(userID, restaurantID, code string) error {
+	if r.cartCoupons == nil {
+		r.cartCoupons = make(map[string]string)
+	}
+	r.cartCoupons[userID+"/"+restaurantID] = code
+	return nil
+}
+
+func (r *fakeRepo) RemoveCartCoupon(userID, restaurantID string) error {
+	delete(r.cartCoupons, userID+"/"+restaurantID)
+	return nil
+}
+
+func (r *fakeRepo) WithTx(ctx context.Context, fn func(repo repository.OrderCartRepository) error) error {
+	return fn(r)
+}
+
+func (r *fakeRepo) LockCartItems(userID, restaurantID string) ([]models.CartItem, error) {
+	return r.GetCartItems(userID, restaurantID)
+}
+
+func (r *fakeRepo) UpdateCartItemDetails(item *models.CartItem) error {
+	for i := range r.cart {
+		if r.cart[i].ID == item.ID {
+			r.cart[i] = *item
+		}
+	}
+	return nil
+}
+
+func (r *fakeRepo) ClearCart(userID, restaurantID string) error {
+	var kept []models.CartItem
+	for _, item := range r.cart {
+		if item.UserID != userID || item.RestaurantID != restaurantID {
+			kept = append(kept, item)
+		}
+	}
+	r.cart = kept
+	return nil
+}
+
+func (r *fakeRepo) CreateOrder(order *models.Order, outbox []models.OutboxMessage) error {
+	if r.orders == nil {
+		r.orders = make(map[string]*models.Order)
+	}
+	r.orders[order.OrderID] = order
+	return nil
+}
+
+func (r *fakeRepo) GetProductOptions(productID string) ([]models.ProductOption, error) {
+	var options []models.ProductOption
+	for _, option := range r.options {
+		if option.ProductID == productID {
+			options = append(options, option)
+		}
+	}
+	return options, nil
+}
+
+func (r *fakeRepo) GetProductOptionsByID(optionIDs []string) (map[string]models.ProductOption, error) {
+	options := make(map[string]models.ProductOption)
+	for _, option := range r.options {
+		for _, id := range optionIDs {
+			if option.OptionID == id {
+				options[id] = option
+			}
+		}
+	}
+	return options, nil
+}
+
+func (r *fakeRepo) ReplaceProductOptions(productID string, options []models.ProductOption) error {
+	kept := options
+	for _, option := range r.options {
+		if option.ProductID != productID {
+			kept = append(kept, option)
+		}
+	}
+	r.options = kept
+	return nil
+}
+
+// fakeRestaurant serves a single restaurant's catalogue. If noCatalogue is
+// set the batch lookup fails and every product is looked up individually.
+type fakeRestaurant struct {
+	clients.RestaurantClient
+	products    map[string]*restaurantPb.Product
+	noCatalogue bool
+}
+
+func (c *fakeRestaurant) GetRestaurantByID(ctx context.Context, in *restaurantPb.GetRestaurantByIDRequest, opts ...grpc.CallOption) (*restaurantPb.GetRestaurantByIDResponse, error) {
+	return &restaurantPb.GetRestaurantByIDResponse{RestaurantId: in.RestaurantId, RestaurantName: "Test Kitchen"}, nil
+}
+
+func (c *fakeRestaurant) CheckRestaurantBanStatus(ctx context.Context, in *restaurantPb.CheckRestaurantBanStatusRequest, opts ...grpc.CallOption) (*restaurantPb.CheckRestaurantBanStatusResponse, error) {
+	return &restaurantPb.CheckRestaurantBanStatusResponse{}, nil
+}
+
+func (c *fakeRestaurant) GetProductByID(ctx context.Context, in *restaurantPb.GetProductByIDRequest, opts ...grpc.CallOption) (*restaurantPb.GetProductByIDResponse, error) {
+	return &restaurantPb.GetProductByIDResponse{Product: c.products[in.ProductId]}, nil
+}
+
+func (c *fakeRestaurant) GetRestaurantProductsByID(ctx context.Context, in *restaurantPb.GetRestaurantProductsByIDRequest, opts ...grpc.CallOption) (*restaurantPb.GetRestaurantProductsByIDResponse, error) {
+	if c.noCatalogue {
+		return nil, apperr.NotFound("restaurant", in.RestaurantId)
+	}
+	resp := &restaurantPb.GetRestaurantProductsByIDResponse{}
+	for _, product := range c.products {
+		resp.Products = append(resp.Products, product)
+	}
+	return resp, nil
+}
+
+// fakeUser accepts every delivery address.
+type fakeUser struct{}
+
+func (fakeUser) ValidateUserAddress(ctx context.Context, in *userPb.ValidateUserAddressRequest, opts ...grpc.CallOption) (*userPb.ValidateUserAddressResponse, error) {
+	return &userPb.ValidateUserAddressResponse{
+		IsValid: true,
+		Address: &userPb.Address{AddressId: in.AddressId, StreetName: "1 MG Road", Locality: "Indiranagar", State: "KA"},
+	}, nil
+}
+
+// GetAbandonedCarts returns the abandoned carts idle since before idleSince
+// and worth at least minValueMinor.
+func (r *fakeRepo) GetAbandonedCarts(idleSince time.Time, minValueMinor int64, limit, offset int) ([]repository.CartSummary, error) {
+	var carts []repository.CartSummary
+	for _, cart := range r.abandoned {
+		if cart.LastActivityAt.Before(idleSince) && cart.ValueMinor >= minValueMinor {
+			carts = append(carts, cart)
+		}
+	}
+	return carts, nil
+}
+
+func (r *fakeRepo) GetRestaurantOrders(restaurantID string, status string) ([]models.Order, error) {
+	var orders []models.Order
+	for _, order := range r.orders {
+		if order.RestaurantID == restaurantID && (status == "" || order.OrderStatus == status) {
+			orders = append(orders, *order)
+		}
+	}
+	return orders, nil
+}
+
+func (r *fakeRepo) SetCartInstructions(instructions *models.CartInstructions) error {
+	r.instructions = instructions
+	return nil
+}
+
+func (r *fakeRepo) GetCartInstructions(userID, restaurantID string) (*models.CartInstructions, error) {
+	return r.instructions, nil
+}
+
+func (r *fakeRepo) GetOrderPayment(orderID string) (*models.Payment, error) {
+	payment, ok := r.payments[orderID]
+	if !ok {
+		return nil, apperr.NotFound("payment", orderID)
+	}
+	return payment, nil
+}
+
+func (r *fakeRepo) AuthorizeOrderPayment(orderID, reference string) error {
+	order := r.orders[orderID]
+	order.Payment.Status = payments.StatusAuthorized
+	order.Payment.ProviderReference = reference
+	order.OrderStatus = string(orderstate.Reserving)
+	return nil
+}
+
+// FailOrderPayment only records the failure; restoring the cart and releasing
+// the coupon are left to the repository.
+func (r *fakeRepo) FailOrderPayment(orderID, paymentStatus, reason string) error {
+	order := r.orders[orderID]
+	order.Payment.Status = paymentStatus
+	order.Payment.FailureReason = reason
+	order.OrderStatus = string(orderstate.Failed)
+	return nil
+}
+
+func (r *fakeRepo) GetWallet(userID string) (*models.Wallet, error) {
+	wallet, ok := r.wallets[userID]
+	if !ok {
+		return &models.Wallet{UserID: userID, Balance: money.New(0, money.DefaultCurrency), Held: money.New(0, money.DefaultCurrency)}, nil
+	}
+	return wallet, nil
+}
+
+func (r *fakeRepo) CreditWallet(userID string, amount money.Money, description string) (*models.Wallet, error) {
+	wallet, _ := r.GetWallet(userID)
+	wallet.Balance.Minor += amount.Minor
+	if r.wallets == nil {
+		r.wallets = map[string]*models.Wallet{}
+	}
+	r.wallets[userID] = wallet
+	return wallet, nil
+}
+
+// IssueRefund refunds the order total, or 100.00 per listed unit.
+func (r *fakeRepo) IssueRefund(req repository.RefundRequest) (*models.Refund, error) {
+	order, err := r.GetOrderByID(req.OrderID)
+	if err != nil {
+		return nil, err
+	}
+	refund := models.Refund{
+		RefundID:  fmt.Sprintf("refund%d", len(r.refunds[req.OrderID])+1),
+		OrderID:   req.OrderID,
+		Amount:    order.Total,
+		Reason:    req.Reason,
+		Status:    "SUCCEEDED",
+		ActorType: req.ActorType,
+		ActorID:   req.ActorID,
+	}
+	if !req.Full {
+		refund.Amount = money.New(0, money.DefaultCurrency)
+		for _, item := range req.Items {
+			amount := money.New(int64(item.Quantity)*10000, money.DefaultCurrency)
+			refund.Amount.Minor += amount.Minor
+			refund.Items = append(refund.Items, models.RefundItem{ProductID: item.ProductID, Quantity: item.Quantity, Amount: amount})
+		}
+	}
+	if r.refunds == nil {
+		r.refunds = map[string][]models.Refund{}
+	}
+	r.refunds[req.OrderID] = append(r.refunds[req.OrderID], refund)
+	return &refund, nil
+}
+
+func (r *fakeRepo) GetOrderRefunds(orderID string) ([]models.Refund, error) {
+	return r.refunds[orderID], nil
+}
+
+func (r *fakeRepo) UpdateOrderRejection(event *models.OrderStatusEvent, code orderstate.RejectionCode) error {
+	order, err := r.GetOrderByID(event.OrderID)
+	if err != nil {
+		return err
+	}
+	order.OrderStatus = event.ToStatus
+	order.CancelReason = event.Reason
+	order.RejectionCode = string(code)
+	return r.UpdateOrderCancellation(event)
+}
+
+func (r *fakeRepo) UpdateOrderCancellation(event *models.OrderStatusEvent) error {
+	order, err := r.GetOrderByID(event.OrderID)
+	if err != nil {
+		return err
+	}
+	order.OrderStatus = event.ToStatus
+	order.CancelReason = event.Reason
+	if r.events == nil {
+		r.events = map[string][]models.OrderStatusEvent{}
+	}
+	r.events[event.OrderID] = append(r.events[event.OrderID], *event)
+	return nil
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/proto"
+
+	orderCartPb "github.com/liju-github/CentralisedFoodbuddyMicroserviceProto/OrderCart"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/apperr"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/models"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/repository"
+)
+
+const (
+	idempotencyKeyHeader = "idempotency-key"
+	maxIdempotencyKeyLen = 255
+
+	// idempotencyTTL is how long a completed response is replayed for.
+	idempotencyTTL = 24 * time.Hour
+	// idempotencyLease is how long an in-progress request may hold its key
+	// without renewing it before it is considered abandoned. Requests renew
+	// their lease every idempotencyRenewal while they are being processed.
+	idempotencyLease   = time.Minute
+	idempotencyRenewal = idempotencyLease / 3
+	// idempotencyWait is how long a duplicate waits for the original request
+	// to finish before it is rejected.
+	idempotencyWait     = 5 * time.Second
+	idempotencyPollRate = 200 * time.Millisecond
+)
+
+// placeOrderIdempotent places the order at most once per user and key. A
+// duplicate of a completed request gets the stored response, and a duplicate
+// of a request still in progress waits for it, failing with Aborted if it does
+// not finish in time.
+func (s *OrderCartService) placeOrderIdempotent(ctx context.Context, req *orderCartPb.PlaceOrderByRestIDRequest, key string) (*orderCartPb.PlaceOrderByRestIDResponse, error) {
+	if len(key) > maxIdempotencyKeyLen {
+		return nil, apperr.InvalidArgument("idempotency key is too long", apperr.FieldViolation{
+			Field:       idempotencyKeyHeader,
+			Description: fmt.Sprintf("must be at most %d characters", maxIdempotencyKeyLen),
+		})
+	}
+
+	hash := placeOrderHash(ctx, req)
+	deadline := time.Now().Add(idempotencyWait)
+
+	for {
+		record, acquired, err := s.repo.BeginIdempotentRequest(&models.IdempotentRequest{
+			UserID:         req.UserId,
+			IdempotencyKey: key,
+			RequestHash:    hash,
+			LeaseID:        uuid.New().String(),
+			ExpiresAt:      time.Now().Add(idempotencyTTL),
+		}, idempotencyLease)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check idempotency key: %w", err)
+		}
+
+		if record.RequestHash != hash {
+			return nil, apperr.InvalidArgument("idempotency key was already used for a different order request", apperr.FieldViolation{
+				Field:       idempotencyKeyHeader,
+				Description: "reused with different request parameters",
+			})
+		}
+
+		if acquired {
+			return s.placeOrderWithKey(ctx, req, record)
+		}
+
+		if record.Status == repository.IdempotencyCompleted {
+			resp := &orderCartPb.PlaceOrderByRestIDResponse{}
+			if err := proto.Unmarshal(record.Response, resp); err != nil {
+				return nil, fmt.Errorf("failed to decode stored response: %w", err)
+			}
+			return resp, nil
+		}
+
+		if time.Now().After(deadline) {
+			return nil, apperr.Conflict("an order request with this idempotency key is already in progress")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(idempotencyPollRate):
+		}
+	}
+}
+
+// placeOrderWithKey places the order for a claimed idempotency record, which
+// placeOrder completes in the transaction that saves the order, or releases
+// the key if placement fails so the client can retry. The lease on the key is
+// renewed until placement ends.
+func (s *OrderCartService) placeOrderWithKey(ctx context.Context, req *orderCartPb.PlaceOrderByRestIDRequest, record *models.IdempotentRequest) (*orderCartPb.PlaceOrderByRestIDResponse, error) {
+	renewCtx, stopRenewal := context.WithCancel(ctx)
+	defer stopRenewal()
+	go s.renewIdempotencyLease(renewCtx, record)
+
+	resp, err := s.placeOrder(ctx, req, record)
+	if err != nil {
+		if releaseErr := s.repo.ReleaseIdempotentRequest(record.ID, record.LeaseID); releaseErr != nil {
+			log.Printf("Failed to release idempotency key %s for user %s: %v", record.IdempotencyKey, record.UserID, releaseErr)
+		}
+		return nil, err
+	}
+	return resp, nil
+}
+
+// renewIdempotencyLease renews the lease on record's key every
+// idempotencyRenewal until ctx is cancelled or the lease is lost.
+func (s *OrderCartService) renewIdempotencyLease(ctx context.Context, record *models.IdempotentRequest) {
+	ticker := time.NewTicker(idempotencyRenewal)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := s.repo.RenewIdempotentRequest(record.ID, record.LeaseID); err != nil {
+			log.Printf("Failed to renew idempotency key %s of user %s: %v", record.IdempotencyKey, record.UserID, err)
+			return
+		}
+	}
+}
+
+// completeIdempotentRequest stores resp as the response replayed for
+// record's key.
+func completeIdempotentRequest(repo repository.OrderCartRepository, record *models.IdempotentRequest, resp *orderCartPb.PlaceOrderByRestIDResponse) error {
+	data, err := proto.Marshal(resp)
+	if err != nil {
+		return fmt.Errorf("failed to encode response: %w", err)
+	}
+	if err := repo.CompleteIdempotentRequest(record.ID, record.LeaseID, data); err != nil {
+		return fmt.Errorf("failed to store response for idempotency key: %w", err)
+	}
+	return nil
+}
+
+// placeOrderHash fingerprints the fields of req and the metadata entries that
+// decide which order is placed, so a key reused for a different order can be
+// detected.
+func placeOrderHash(ctx context.Context, req *orderCartPb.PlaceOrderByRestIDRequest) string {
+	fields := []string{
+		req.UserId,
+		req.RestaurantId,
+		req.DeliveryAddressId,
+		metadataValue(ctx, expectedTotalHeader),
+		metadataValue(ctx, scheduledForHeader),
+		metadataValue(ctx, paymentMethodHeader),
+	}
+	sum := sha256.Sum256([]byte(strings.Join(fields, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,38 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+
+	orderCartPb "github.com/liju-github/CentralisedFoodbuddyMicroserviceProto/OrderCart"
+)
+
+// TestPlaceOrderHash checks that every input deciding which order is placed
+// changes the idempotency fingerprint.
+func TestPlaceOrderHash(t *testing.T) {
+	req := &orderCartPb.PlaceOrderByRestIDRequest{UserId: "user1", RestaurantId: "rest1", DeliveryAddressId: "addr1"}
+	base := placeOrderHash(context.Background(), req)
+
+	if got := placeOrderHash(context.Background(), req); got != base {
+		t.Errorf("hash of the same request changed: %s != %s", got, base)
+	}
+
+	headers := []string{
+		expectedTotalHeader,
+		scheduledForHeader,
+		paymentMethodHeader,
+	}
+	for _, header := range headers {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(header, "1"))
+		if placeOrderHash(ctx, req) == base {
+			t.Errorf("%s does not change the hash", header)
+		}
+	}
+
+	other := &orderCartPb.PlaceOrderByRestIDRequest{UserId: "user1", RestaurantId: "rest1", DeliveryAddressId: "addr2"}
+	if placeOrderHash(context.Background(), other) == base {
+		t.Error("delivery address does not change the hash")
+	}
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	orderCartPb "github.com/liju-github/CentralisedFoodbuddyMicroserviceProto/OrderCart"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/auth"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/models"
+)
+
+// SetCartInstructions saves the delivery instructions and kitchen note for
+// the user's cart at a restaurant. They are copied to the order when it is
+// placed. Setting both to empty removes them.
+func (s *OrderCartService) SetCartInstructions(ctx context.Context, req *SetCartInstructionsRequest) (*SetCartInstructionsResponse, error) {
+	if err := auth.RequireUser(ctx, req.UserId); err != nil {
+		return nil, err
+	}
+
+	deliveryInstructions := strings.TrimSpace(req.DeliveryInstructions)
+	kitchenNote := strings.TrimSpace(req.KitchenNote)
+
+	var err error
+	if deliveryInstructions == "" && kitchenNote == "" {
+		err = s.repo.RemoveCartInstructions(req.UserId, req.RestaurantId)
+	} else {
+		err = s.repo.SetCartInstructions(&models.CartInstructions{
+			UserID:               req.UserId,
+			RestaurantID:         req.RestaurantId,
+			DeliveryInstructions: deliveryInstructions,
+			KitchenNote:          kitchenNote,
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to save cart instructions: %w", err)
+	}
+
+	return &SetCartInstructionsResponse{
+		Success: true,
+		Message: "Cart instructions saved successfully",
+	}, nil
+}
+
+// GetRestaurantKitchenOrders returns the orders of a restaurant like
+// GetRestaurantOrders, together with the delivery instructions, kitchen
+// notes, options and item instructions the kitchen needs to prepare them.
+//
+// The method returns an error if the operation fails.
+func (s *OrderCartService) GetRestaurantKitchenOrders(ctx context.Context, req *orderCartPb.GetRestaurantOrdersRequest) (*GetRestaurantKitchenOrdersResponse, error) {
+	if err := auth.RequireRestaurant(ctx, req.RestaurantId); err != nil {
+		return nil, err
+	}
+
+	orders, err := s.repo.GetRestaurantOrders(req.RestaurantId, req.Status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get restaurant orders: %w", err)
+	}
+
+	var kitchenOrders []*KitchenOrder
+	for i := range orders {
+		order := &orders[i]
+		kitchenOrder := &KitchenOrder{
+			Order:                orderToPb(order),
+			DeliveryInstructions: order.DeliveryInstructions,
+			KitchenNote:          order.KitchenNote,
+		}
+		if order.ScheduledFor != nil {
+			kitchenOrder.ScheduledFor = order.ScheduledFor.Format(time.RFC3339)
+		}
+		for _, item := range order.OrderItems {
+			kitchenItem := &KitchenOrderItem{
+				ProductId:           item.ProductID,
+				ProductName:         item.ProductName,
+				Quantity:            item.Quantity,
+				SpecialInstructions: item.SpecialInstructions,
+			}
+			for _, option := range item.Options {
+				kitchenItem.Options = append(kitchenItem.Options, &CartLineOption{
+					OptionId:   option.OptionID,
+					GroupName:  option.GroupName,
+					Name:       option.Name,
+					PriceDelta: option.PriceDelta.Major(),
+				})
+			}
+			kitchenOrder.Items = append(kitchenOrder.Items, kitchenItem)
+		}
+		kitchenOrders = append(kitchenOrders, kitchenOrder)
+	}
+
+	return &GetRestaurantKitchenOrdersResponse{
+		Orders:  kitchenOrders,
+		Message: "Orders retrieved successfully",
+	}, nil
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	orderCartPb "github.com/liju-github/CentralisedFoodbuddyMicroserviceProto/OrderCart"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/auth"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/models"
+)
+
+func TestSetCartInstructionsValidates(t *testing.T) {
+	tooLong := strings.Repeat("x", 501)
+	tests := []struct {
+		name string
+		req  *SetCartInstructionsRequest
+	}{
+		{"kitchen note too long", &SetCartInstructionsRequest{UserId: "user1", RestaurantId: "rest1", KitchenNote: tooLong}},
+		{"delivery instructions too long", &SetCartInstructionsRequest{UserId: "user1", RestaurantId: "rest1", DeliveryInstructions: tooLong}},
+		{"control characters", &SetCartInstructionsRequest{UserId: "user1", RestaurantId: "rest1", KitchenNote: "no\x07bell"}},
+	}
+
+	repo := &fakeRepo{}
+	conn := dial(t, &OrderCartService{repo: repo})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := invokeExtension(as(t, auth.RoleUser, "user1"), conn, "SetCartInstructions", tt.req, &SetCartInstructionsResponse{})
+			if status.Code(err) != codes.InvalidArgument {
+				t.Errorf("error = %v, want InvalidArgument", err)
+			}
+			if repo.instructions != nil {
+				t.Errorf("invalid instructions were saved: %+v", repo.instructions)
+			}
+		})
+	}
+}
+
+func TestGetRestaurantKitchenOrdersOverGRPC(t *testing.T) {
+	const orderID = "order_0b8f6a3e-7c1d-4e2f-9a5b-1c2d3e4f5a6b"
+	repo := &fakeRepo{orders: map[string]*models.Order{
+		orderID: {
+			OrderID:              orderID,
+			UserID:               "user1",
+			RestaurantID:         "rest1",
+			OrderStatus:          "PENDING",
+			DeliveryInstructions: "Leave at the door",
+			KitchenNote:          "No onions",
+			OrderItems:           []models.OrderItem{{ProductID: "p1", ProductName: "Dosa", Quantity: 2, SpecialInstructions: "Extra crispy"}},
+		},
+	}}
+	conn := dial(t, &OrderCartService{repo: repo})
+
+	var resp GetRestaurantKitchenOrdersResponse
+	err := invokeExtension(as(t, auth.RoleRestaurant, "rest1"), conn, "GetRestaurantKitchenOrders",
+		&orderCartPb.GetRestaurantOrdersRequest{RestaurantId: "rest1"}, &resp)
+	if err != nil {
+		t.Fatalf("GetRestaurantKitchenOrders: %v", err)
+	}
+	if len(resp.Orders) != 1 {
+		t.Fatalf("got %d orders, want 1", len(resp.Orders))
+	}
+	order := resp.Orders[0]
+	if order.Order.GetOrderId() != orderID || order.KitchenNote != "No onions" || order.DeliveryInstructions != "Leave at the door" {
+		t.Errorf("kitchen order = %+v", order)
+	}
+	if len(order.Items) != 1 || order.Items[0].SpecialInstructions != "Extra crispy" {
+		t.Errorf("kitchen order items = %+v", order.Items)
+	}
+
+	err = invokeExtension(as(t, auth.RoleRestaurant, "rest2"), conn, "GetRestaurantKitchenOrders",
+		&orderCartPb.GetRestaurantOrdersRequest{RestaurantId: "rest1"}, &resp)
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("another restaurant: error = %v, want PermissionDenied", err)
+	}
+}
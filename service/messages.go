@@ -0,0 +1,611 @@
+package service
+
+import (
+	"fmt"
+
+	orderCartPb "github.com/liju-github/CentralisedFoodbuddyMicroserviceProto/OrderCart"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/money"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/orderstate"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/validation"
+)
+
+// The types in this file back RPCs that are not yet part of the shared
+// OrderCart proto. They are served as JSON by ExtensionServiceDesc. Field names
+// follow the generated code so the handlers can switch to the orderCartPb types
+// once the proto is regenerated.
+
+type GetOrderTimelineRequest struct {
+	OrderId string
+}
+
+func (r *GetOrderTimelineRequest) Validate() error {
+	var v validation.Violations
+	v.RequireOrderID("orderId", r.OrderId)
+	return v.Err()
+}
+
+type OrderStatusEvent struct {
+	FromStatus string
+	ToStatus   string
+	ActorType  string
+	ActorId    string
+	Reason     string
+	CreatedAt  string
+}
+
+type GetOrderTimelineResponse struct {
+	OrderId       string
+	CurrentStatus string
+	Events        []*OrderStatusEvent
+	Message       string
+}
+
+type GetCartBillRequest struct {
+	UserId            string
+	RestaurantId      string
+	DeliveryAddressId string
+}
+
+func (r *GetCartBillRequest) Validate() error {
+	var v validation.Violations
+	v.RequireID("userId", r.UserId)
+	v.RequireID("restaurantId", r.RestaurantId)
+	v.OptionalID("deliveryAddressId", r.DeliveryAddressId)
+	return v.Err()
+}
+
+type BillItem struct {
+	ProductId   string
+	ProductName string
+	UnitPrice   float64
+	Quantity    int32
+	Amount      float64
+}
+
+type BillCharge struct {
+	Type        string
+	Label       string
+	RatePercent float64
+	Amount      float64
+}
+
+type Bill struct {
+	Currency    string
+	Items       []*BillItem
+	Subtotal    float64
+	Charges     []*BillCharge
+	TotalAmount float64
+}
+
+type GetCartBillResponse struct {
+	Bill    *Bill
+	Message string
+}
+
+type GetOrderBillRequest struct {
+	OrderId string
+}
+
+func (r *GetOrderBillRequest) Validate() error {
+	var v validation.Violations
+	v.RequireOrderID("orderId", r.OrderId)
+	return v.Err()
+}
+
+type GetOrderBillResponse struct {
+	OrderId string
+	Bill    *Bill
+	Message string
+}
+
+type ApplyCouponRequest struct {
+	UserId       string
+	RestaurantId string
+	CouponCode   string
+}
+
+func (r *ApplyCouponRequest) Validate() error {
+	var v validation.Violations
+	v.RequireID("userId", r.UserId)
+	v.RequireID("restaurantId", r.RestaurantId)
+	v.RequireCouponCode("couponCode", r.CouponCode)
+	return v.Err()
+}
+
+type ApplyCouponResponse struct {
+	CouponCode string
+	Discount   float64
+	Bill       *Bill
+	Message    string
+}
+
+type RemoveCouponRequest struct {
+	UserId       string
+	RestaurantId string
+}
+
+func (r *RemoveCouponRequest) Validate() error {
+	var v validation.Violations
+	v.RequireID("userId", r.UserId)
+	v.RequireID("restaurantId", r.RestaurantId)
+	return v.Err()
+}
+
+type RemoveCouponResponse struct {
+	Success bool
+	Message string
+}
+
+type RefreshCartRequest struct {
+	UserId       string
+	RestaurantId string
+}
+
+func (r *RefreshCartRequest) Validate() error {
+	var v validation.Violations
+	v.RequireID("userId", r.UserId)
+	v.RequireID("restaurantId", r.RestaurantId)
+	return v.Err()
+}
+
+type CartItemChange struct {
+	ProductId      string
+	LineKey        string
+	ProductName    string
+	OldPrice       float64
+	NewPrice       float64
+	Available      bool
+	AvailableStock int32
+}
+
+type RefreshCartResponse struct {
+	Items       []*orderCartPb.CartItem
+	TotalAmount float64
+	Changes     []*CartItemChange
+	Message     string
+}
+
+type GetAbandonedCartsRequest struct {
+	IdleHours int32
+	MinValue  float64
+	Limit     int32
+	Offset    int32
+}
+
+func (r *GetAbandonedCartsRequest) Validate() error {
+	var v validation.Violations
+	if r.IdleHours < 1 {
+		v.Add("idleHours", "must be at least 1")
+	}
+	if r.MinValue < 0 {
+		v.Add("minValue", "must not be negative")
+	}
+	if r.Limit < 0 || r.Limit > maxAbandonedCartsLimit {
+		v.Add("limit", fmt.Sprintf("must be between 0 and %d", maxAbandonedCartsLimit))
+	}
+	if r.Offset < 0 {
+		v.Add("offset", "must not be negative")
+	}
+	return v.Err()
+}
+
+type AbandonedCart struct {
+	UserId         string
+	RestaurantId   string
+	Lines          int32
+	Quantity       int32
+	TotalAmount    float64
+	Currency       string
+	LastActivityAt string
+}
+
+type GetAbandonedCartsResponse struct {
+	Carts   []*AbandonedCart
+	Message string
+}
+
+type ProductOption struct {
+	OptionId   string
+	GroupName  string
+	GroupType  string
+	Name       string
+	PriceDelta float64
+	Active     bool
+}
+
+type SetProductOptionsRequest struct {
+	RestaurantId string
+	ProductId    string
+	Options      []*ProductOption
+}
+
+func (r *SetProductOptionsRequest) Validate() error {
+	var v validation.Violations
+	v.RequireID("restaurantId", r.RestaurantId)
+	v.RequireID("productId", r.ProductId)
+	for i, option := range r.Options {
+		field := fmt.Sprintf("options[%d]", i)
+		if option == nil {
+			v.Add(field, "is required")
+			continue
+		}
+		v.OptionalID(field+".optionId", option.OptionId)
+		if option.GroupName == "" {
+			v.Add(field+".groupName", "is required")
+		}
+		v.MaxLength(field+".groupName", option.GroupName, 100)
+		if option.GroupType != optionGroupSingle && option.GroupType != optionGroupMulti {
+			v.Add(field+".groupType", fmt.Sprintf("must be %s or %s", optionGroupSingle, optionGroupMulti))
+		}
+		if option.Name == "" {
+			v.Add(field+".name", "is required")
+		}
+		v.MaxLength(field+".name", option.Name, 255)
+		if option.PriceDelta < 0 {
+			v.Add(field+".priceDelta", "must not be negative")
+		}
+	}
+	return v.Err()
+}
+
+type SetProductOptionsResponse struct {
+	Options []*ProductOption
+	Message string
+}
+
+type GetProductOptionsRequest struct {
+	ProductId string
+}
+
+func (r *GetProductOptionsRequest) Validate() error {
+	var v validation.Violations
+	v.RequireID("productId", r.ProductId)
+	return v.Err()
+}
+
+type GetProductOptionsResponse struct {
+	ProductId string
+	Options   []*ProductOption
+	Message   string
+}
+
+type CartLineOption struct {
+	OptionId   string
+	GroupName  string
+	Name       string
+	PriceDelta float64
+}
+
+type CartLine struct {
+	ProductId           string
+	RestaurantId        string
+	ProductName         string
+	Category            string
+	LineKey             string
+	Options             []*CartLineOption
+	SpecialInstructions string
+	UnitPrice           float64
+	Quantity            int32
+	Amount              float64
+	Unavailable         bool
+}
+
+type AddCustomizedProductToCartRequest struct {
+	UserId              string
+	ProductId           string
+	Quantity            int32
+	OptionIds           []string
+	SpecialInstructions string
+}
+
+func (r *AddCustomizedProductToCartRequest) Validate() error {
+	var v validation.Violations
+	v.RequireID("userId", r.UserId)
+	v.RequireID("productId", r.ProductId)
+	v.Quantity("quantity", r.Quantity)
+	if len(r.OptionIds) > validation.MaxOptionsPerLine {
+		v.Add("optionIds", fmt.Sprintf("must have at most %d options", validation.MaxOptionsPerLine))
+	}
+	for i, id := range r.OptionIds {
+		v.RequireID(fmt.Sprintf("optionIds[%d]", i), id)
+	}
+	v.Note("specialInstructions", r.SpecialInstructions, validation.MaxInstructionsLength)
+	return v.Err()
+}
+
+type AddCustomizedProductToCartResponse struct {
+	Line    *CartLine
+	Message string
+}
+
+type UpdateCartLineRequest struct {
+	UserId       string
+	RestaurantId string
+	ProductId    string
+	LineKey      string
+	Quantity     int32
+}
+
+func (r *UpdateCartLineRequest) Validate() error {
+	var v validation.Violations
+	v.RequireID("userId", r.UserId)
+	v.RequireID("restaurantId", r.RestaurantId)
+	v.RequireID("productId", r.ProductId)
+	v.OptionalID("lineKey", r.LineKey)
+	if r.Quantity != 0 {
+		v.Quantity("quantity", r.Quantity)
+	}
+	return v.Err()
+}
+
+type UpdateCartLineResponse struct {
+	Success bool
+	Message string
+}
+
+type GetCartLinesRequest struct {
+	UserId       string
+	RestaurantId string
+}
+
+func (r *GetCartLinesRequest) Validate() error {
+	var v validation.Violations
+	v.RequireID("userId", r.UserId)
+	v.RequireID("restaurantId", r.RestaurantId)
+	return v.Err()
+}
+
+type GetCartLinesResponse struct {
+	Lines                []*CartLine
+	TotalAmount          float64
+	DeliveryInstructions string
+	KitchenNote          string
+	Message              string
+}
+
+type SetCartInstructionsRequest struct {
+	UserId               string
+	RestaurantId         string
+	DeliveryInstructions string
+	KitchenNote          string
+}
+
+func (r *SetCartInstructionsRequest) Validate() error {
+	var v validation.Violations
+	v.RequireID("userId", r.UserId)
+	v.RequireID("restaurantId", r.RestaurantId)
+	v.Note("deliveryInstructions", r.DeliveryInstructions, validation.MaxOrderNoteLength)
+	v.Note("kitchenNote", r.KitchenNote, validation.MaxOrderNoteLength)
+	return v.Err()
+}
+
+type SetCartInstructionsResponse struct {
+	Success bool
+	Message string
+}
+
+type KitchenOrderItem struct {
+	ProductId           string
+	ProductName         string
+	Quantity            int32
+	Options             []*CartLineOption
+	SpecialInstructions string
+}
+
+type KitchenOrder struct {
+	Order                *orderCartPb.Order
+	Items                []*KitchenOrderItem
+	DeliveryInstructions string
+	KitchenNote          string
+	// ScheduledFor is the RFC 3339 delivery slot of a scheduled order
+	ScheduledFor string
+}
+
+type GetRestaurantKitchenOrdersResponse struct {
+	Orders  []*KitchenOrder
+	Message string
+}
+
+type GetOrderPaymentRequest struct {
+	OrderId string
+}
+
+func (r *GetOrderPaymentRequest) Validate() error {
+	var v validation.Violations
+	v.RequireOrderID("orderId", r.OrderId)
+	return v.Err()
+}
+
+type OrderPayment struct {
+	PaymentId     string
+	Provider      string
+	Status        string
+	Amount        float64
+	Currency      string
+	FailureReason string
+	AuthorizedAt  string
+	CapturedAt    string
+}
+
+type GetOrderPaymentResponse struct {
+	OrderId string
+	Payment *OrderPayment
+	Message string
+}
+
+type Wallet struct {
+	UserId    string
+	Balance   float64
+	Held      float64
+	Available float64
+	Currency  string
+}
+
+type GetWalletBalanceRequest struct {
+	UserId string
+}
+
+func (r *GetWalletBalanceRequest) Validate() error {
+	var v validation.Violations
+	v.RequireID("userId", r.UserId)
+	return v.Err()
+}
+
+type GetWalletBalanceResponse struct {
+	Wallet  *Wallet
+	Message string
+}
+
+type GetWalletTransactionsRequest struct {
+	UserId string
+	Limit  int32
+	Offset int32
+}
+
+func (r *GetWalletTransactionsRequest) Validate() error {
+	var v validation.Violations
+	v.RequireID("userId", r.UserId)
+	if r.Limit < 0 || r.Limit > maxWalletTransactionsLimit {
+		v.Add("limit", fmt.Sprintf("must be between 0 and %d", maxWalletTransactionsLimit))
+	}
+	if r.Offset < 0 {
+		v.Add("offset", "must not be negative")
+	}
+	return v.Err()
+}
+
+type WalletTransaction struct {
+	Type         string
+	Amount       float64
+	Currency     string
+	OrderId      string
+	Description  string
+	BalanceAfter float64
+	HeldAfter    float64
+	CreatedAt    string
+}
+
+type GetWalletTransactionsResponse struct {
+	Transactions []*WalletTransaction
+	Message      string
+}
+
+type CreditWalletRequest struct {
+	UserId      string
+	Amount      float64
+	Description string
+}
+
+func (r *CreditWalletRequest) Validate() error {
+	var v validation.Violations
+	v.RequireID("userId", r.UserId)
+	if money.FromMajor(r.Amount, money.DefaultCurrency).Minor <= 0 {
+		v.Add("amount", "must be positive")
+	}
+	v.Note("description", r.Description, maxWalletDescriptionLength)
+	return v.Err()
+}
+
+type CreditWalletResponse struct {
+	Wallet  *Wallet
+	Message string
+}
+
+// RefundItem is a quantity of a product to refund. Amount is only set in
+// responses.
+type RefundItem struct {
+	ProductId string
+	Quantity  int32
+	Amount    float64
+}
+
+type IssueRefundRequest struct {
+	OrderId string
+	// Full refunds all that is left of the payment; otherwise Items lists
+	// what to refund.
+	Full   bool
+	Items  []*RefundItem
+	Reason string
+}
+
+func (r *IssueRefundRequest) Validate() error {
+	var v validation.Violations
+	v.RequireOrderID("orderId", r.OrderId)
+	if r.Full && len(r.Items) > 0 {
+		v.Add("items", "must be empty for a full refund")
+	}
+	if !r.Full && len(r.Items) == 0 {
+		v.Add("items", "is required unless full is set")
+	}
+	for i, item := range r.Items {
+		v.RequireID(fmt.Sprintf("items[%d].productId", i), item.ProductId)
+		v.Quantity(fmt.Sprintf("items[%d].quantity", i), item.Quantity)
+	}
+	if r.Reason == "" {
+		v.Add("reason", "is required")
+	}
+	v.Note("reason", r.Reason, maxRefundReasonLength)
+	return v.Err()
+}
+
+type OrderRefund struct {
+	RefundId      string
+	Amount        float64
+	Currency      string
+	Reason        string
+	Status        string
+	ActorType     string
+	ActorId       string
+	FailureReason string
+	Items         []*RefundItem
+	CreatedAt     string
+}
+
+type IssueRefundResponse struct {
+	Refund  *OrderRefund
+	Message string
+}
+
+type GetOrderRefundsRequest struct {
+	OrderId string
+}
+
+func (r *GetOrderRefundsRequest) Validate() error {
+	var v validation.Violations
+	v.RequireOrderID("orderId", r.OrderId)
+	return v.Err()
+}
+
+type GetOrderRefundsResponse struct {
+	OrderId     string
+	OrderStatus string
+	Refunds     []*OrderRefund
+	Message     string
+}
+
+type RejectOrderRequest struct {
+	OrderId      string
+	RestaurantId string
+	// ReasonCode is one of OUT_OF_STOCK, CLOSING_SOON or TOO_BUSY.
+	ReasonCode string
+	Note       string
+}
+
+func (r *RejectOrderRequest) Validate() error {
+	var v validation.Violations
+	v.RequireOrderID("orderId", r.OrderId)
+	v.RequireID("restaurantId", r.RestaurantId)
+	if _, err := orderstate.ParseRejectionCode(r.ReasonCode); err != nil {
+		v.Add("reasonCode", "must be one of OUT_OF_STOCK, CLOSING_SOON or TOO_BUSY")
+	}
+	v.Note("note", r.Note, maxRejectionNoteLength)
+	return v.Err()
+}
+
+type RejectOrderResponse struct {
+	Success      bool
+	Message      string
+	OrderStatus  string
+	ReasonCode   string
+	CancelReason string
+}
@@ -0,0 +1,301 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+
+	restaurantPb "github.com/liju-github/CentralisedFoodbuddyMicroserviceProto/Restaurant"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/apperr"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/auth"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/models"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/money"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/repository"
+)
+
+// Product option group types
+const (
+	optionGroupSingle = "SINGLE"
+	optionGroupMulti  = "MULTI"
+)
+
+// SetProductOptions replaces the variants and add-ons a restaurant offers for
+// one of its products. Options are matched by OptionId; options without one
+// are created, and existing options missing from the request are deactivated.
+//
+// The method returns a NotFound error if the product does not belong to the restaurant.
+func (s *OrderCartService) SetProductOptions(ctx context.Context, req *SetProductOptionsRequest) (*SetProductOptionsResponse, error) {
+	if err := auth.RequireRestaurant(ctx, req.RestaurantId); err != nil {
+		return nil, err
+	}
+
+	productResp, err := s.restaurantClient.GetProductByID(ctx, &restaurantPb.GetProductByIDRequest{
+		ProductId: req.ProductId,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get product details: %w", err)
+	}
+	if productResp.Product == nil || productResp.Product.RestaurantId != req.RestaurantId {
+		return nil, apperr.NotFound("product", req.ProductId)
+	}
+
+	// Options already saved for another product cannot be moved to this one
+	var existingIDs []string
+	for _, option := range req.Options {
+		if option.OptionId != "" {
+			existingIDs = append(existingIDs, option.OptionId)
+		}
+	}
+	existing, err := s.repo.GetProductOptionsByID(existingIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get product options: %w", err)
+	}
+
+	options := make([]models.ProductOption, len(req.Options))
+	for i, option := range req.Options {
+		optionID := option.OptionId
+		if optionID == "" {
+			optionID = fmt.Sprintf("opt_%s", uuid.New().String())
+		} else if current, ok := existing[optionID]; ok && current.ProductID != req.ProductId {
+			return nil, apperr.InvalidArgument("option belongs to another product", apperr.FieldViolation{
+				Field:       fmt.Sprintf("options[%d].optionId", i),
+				Description: fmt.Sprintf("option %s belongs to another product", optionID),
+			})
+		}
+		options[i] = models.ProductOption{
+			OptionID:     optionID,
+			RestaurantID: req.RestaurantId,
+			ProductID:    req.ProductId,
+			GroupName:    option.GroupName,
+			GroupType:    option.GroupType,
+			Name:         option.Name,
+			PriceDelta:   money.FromMajor(option.PriceDelta, money.DefaultCurrency),
+			Active:       option.Active,
+		}
+	}
+
+	if err := s.repo.ReplaceProductOptions(req.ProductId, options); err != nil {
+		return nil, fmt.Errorf("failed to save product options: %w", err)
+	}
+
+	var optionsPb []*ProductOption
+	for _, option := range options {
+		optionsPb = append(optionsPb, productOptionToPb(option))
+	}
+	return &SetProductOptionsResponse{
+		Options: optionsPb,
+		Message: "Product options saved successfully",
+	}, nil
+}
+
+// GetProductOptions returns the active variants and add-ons of a product.
+func (s *OrderCartService) GetProductOptions(ctx context.Context, req *GetProductOptionsRequest) (*GetProductOptionsResponse, error) {
+	options, err := s.repo.GetProductOptions(req.ProductId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get product options: %w", err)
+	}
+
+	var optionsPb []*ProductOption
+	for _, option := range options {
+		if option.Active {
+			optionsPb = append(optionsPb, productOptionToPb(option))
+		}
+	}
+	return &GetProductOptionsResponse{
+		ProductId: req.ProductId,
+		Options:   optionsPb,
+		Message:   "Product options retrieved successfully",
+	}, nil
+}
+
+// AddCustomizedProductToCart adds a product with selected options and
+// special instructions to the user's cart. Each combination of options and
+// instructions is a separate cart line.
+//
+// The method returns an InvalidArgument error if an option is unknown,
+// inactive, belongs to another product or conflicts with another option.
+func (s *OrderCartService) AddCustomizedProductToCart(ctx context.Context, req *AddCustomizedProductToCartRequest) (*AddCustomizedProductToCartResponse, error) {
+	if err := auth.RequireUser(ctx, req.UserId); err != nil {
+		return nil, err
+	}
+
+	item, err := s.addToCart(ctx, req.UserId, req.ProductId, req.Quantity, req.OptionIds, strings.TrimSpace(req.SpecialInstructions))
+	if err != nil {
+		return nil, err
+	}
+
+	return &AddCustomizedProductToCartResponse{
+		Line:    cartLinesToPb([]models.CartItem{*item})[0],
+		Message: "Product added to cart successfully",
+	}, nil
+}
+
+// UpdateCartLine sets the quantity of one line of the user's cart, removing
+// the line if the quantity is zero.
+//
+// The method returns a NotFound error if the line is not in the cart.
+func (s *OrderCartService) UpdateCartLine(ctx context.Context, req *UpdateCartLineRequest) (*UpdateCartLineResponse, error) {
+	if err := auth.RequireUser(ctx, req.UserId); err != nil {
+		return nil, err
+	}
+
+	err := s.repo.WithTx(ctx, func(repo repository.OrderCartRepository) error {
+		if _, err := repo.LockCartItem(req.UserId, req.RestaurantId, req.ProductId, req.LineKey); err != nil {
+			return err
+		}
+		if req.Quantity == 0 {
+			return repo.RemoveCartLine(req.UserId, req.RestaurantId, req.ProductId, req.LineKey)
+		}
+		return repo.UpdateCartItemQuantity(req.UserId, req.RestaurantId, req.ProductId, req.LineKey, req.Quantity)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update cart line: %w", err)
+	}
+
+	return &UpdateCartLineResponse{
+		Success: true,
+		Message: "Cart line updated successfully",
+	}, nil
+}
+
+// GetCartLines returns the lines of the user's cart at a restaurant with
+// their options, instructions and prices, the instructions left on the cart
+// itself and the grand total of the cart's bill with the default delivery fee.
+func (s *OrderCartService) GetCartLines(ctx context.Context, req *GetCartLinesRequest) (*GetCartLinesResponse, error) {
+	if err := auth.RequireUser(ctx, req.UserId); err != nil {
+		return nil, err
+	}
+
+	items, err := s.repo.GetCartItems(req.UserId, req.RestaurantId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cart items: %w", err)
+	}
+
+	bill, _, err := s.quoteCart(req.UserId, req.RestaurantId, items, "")
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &GetCartLinesResponse{
+		Lines:       cartLinesToPb(items),
+		TotalAmount: bill.GrandTotal.Major(),
+		Message:     "Cart lines retrieved successfully",
+	}
+
+	instructions, err := s.repo.GetCartInstructions(req.UserId, req.RestaurantId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cart instructions: %w", err)
+	}
+	if instructions != nil {
+		resp.DeliveryInstructions = instructions.DeliveryInstructions
+		resp.KitchenNote = instructions.KitchenNote
+	}
+	return resp, nil
+}
+
+// resolveOptions returns the current details of the options selected for a
+// product, rejecting unknown, inactive or conflicting options.
+func (s *OrderCartService) resolveOptions(productID string, optionIDs []string) (models.LineOptions, error) {
+	if len(optionIDs) == 0 {
+		return nil, nil
+	}
+
+	current, err := s.repo.GetProductOptionsByID(optionIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get product options: %w", err)
+	}
+
+	var options models.LineOptions
+	seen := make(map[string]bool, len(optionIDs))
+	singleGroups := make(map[string]string)
+	for i, id := range optionIDs {
+		field := fmt.Sprintf("optionIds[%d]", i)
+		option, ok := current[id]
+		switch {
+		case seen[id]:
+			return nil, optionError(field, fmt.Sprintf("option %s is selected more than once", id))
+		case !ok || option.ProductID != productID:
+			return nil, optionError(field, fmt.Sprintf("option %s is not an option of product %s", id, productID))
+		case !option.Active:
+			return nil, optionError(field, fmt.Sprintf("option %s is not available", id))
+		}
+		if option.GroupType == optionGroupSingle {
+			if other, ok := singleGroups[option.GroupName]; ok {
+				return nil, optionError(field, fmt.Sprintf("options %s and %s are both from %s", other, id, option.GroupName))
+			}
+			singleGroups[option.GroupName] = id
+		}
+		seen[id] = true
+
+		options = append(options, models.LineOption{
+			OptionID:   option.OptionID,
+			GroupName:  option.GroupName,
+			Name:       option.Name,
+			PriceDelta: option.PriceDelta,
+		})
+	}
+	return options, nil
+}
+
+func optionError(field, description string) error {
+	return apperr.InvalidArgument("invalid product option", apperr.FieldViolation{
+		Field:       field,
+		Description: description,
+	})
+}
+
+// currentOptions returns the options of every cart item with their current
+// price deltas, and whether each item has an option that is no longer
+// offered.
+func (s *OrderCartService) currentOptions(items []models.CartItem) ([]models.LineOptions, []bool, error) {
+	var ids []string
+	for _, item := range items {
+		for _, option := range item.Options {
+			ids = append(ids, option.OptionID)
+		}
+	}
+	current, err := s.repo.GetProductOptionsByID(ids)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get product options: %w", err)
+	}
+
+	options := make([]models.LineOptions, len(items))
+	unavailable := make([]bool, len(items))
+	for i, item := range items {
+		for _, selected := range item.Options {
+			option, ok := current[selected.OptionID]
+			if !ok || !option.Active {
+				unavailable[i] = true
+				options[i] = append(options[i], selected)
+				continue
+			}
+			options[i] = append(options[i], models.LineOption{
+				OptionID:   option.OptionID,
+				GroupName:  option.GroupName,
+				Name:       option.Name,
+				PriceDelta: option.PriceDelta,
+			})
+		}
+	}
+	return options, unavailable, nil
+}
+
+// cartLineKey identifies a cart line of a product by its options and special
+// instructions. A line without either has an empty key.
+func cartLineKey(options models.LineOptions, instructions string) string {
+	if len(options) == 0 && instructions == "" {
+		return ""
+	}
+	ids := make([]string, len(options))
+	for i, option := range options {
+		ids[i] = option.OptionID
+	}
+	sort.Strings(ids)
+	sum := sha256.Sum256([]byte(strings.Join(ids, "\x00") + "\x01" + instructions))
+	return hex.EncodeToString(sum[:16])
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"testing"
+
+	restaurantPb "github.com/liju-github/CentralisedFoodbuddyMicroserviceProto/Restaurant"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/auth"
+)
+
+func TestProductOptionsOverGRPC(t *testing.T) {
+	restaurant := &fakeRestaurant{products: map[string]*restaurantPb.Product{
+		"p1": {ProductId: "p1", RestaurantId: "rest1", Name: "Pizza", Price: 200, Stock: 10},
+	}}
+	conn := dial(t, &OrderCartService{repo: &fakeRepo{}, restaurantClient: restaurant})
+	req := &SetProductOptionsRequest{RestaurantId: "rest1", ProductId: "p1", Options: []*ProductOption{
+		{GroupName: "Size", GroupType: optionGroupSingle, Name: "Large", PriceDelta: 40, Active: true},
+		{GroupName: "Toppings", GroupType: optionGroupMulti, Name: "Olives", PriceDelta: 20},
+	}}
+
+	var set SetProductOptionsResponse
+	if err := invokeExtension(as(t, auth.RoleRestaurant, "rest1"), conn, "SetProductOptions", req, &set); err != nil {
+		t.Fatalf("SetProductOptions: %v", err)
+	}
+	if len(set.Options) != 2 || set.Options[0].OptionId == "" {
+		t.Fatalf("saved options = %+v", set.Options)
+	}
+
+	var got GetProductOptionsResponse
+	err := invokeExtension(as(t, auth.RoleUser, "user1"), conn, "GetProductOptions", &GetProductOptionsRequest{ProductId: "p1"}, &got)
+	if err != nil {
+		t.Fatalf("GetProductOptions: %v", err)
+	}
+	if len(got.Options) != 1 || got.Options[0].Name != "Large" || got.Options[0].PriceDelta != 40 {
+		t.Errorf("active options = %+v, want only Large", got.Options)
+	}
+
+	err = invokeExtension(as(t, auth.RoleRestaurant, "rest2"), conn, "SetProductOptions", req, &SetProductOptionsResponse{})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("SetProductOptions for another restaurant: error = %v, want PermissionDenied", err)
+	}
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/apperr"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/auth"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/models"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/payments"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/repository"
+)
+
+// authorizePayment authorizes the pending payment of a newly placed order with
+// the payment provider and records the outcome, reloading order afterwards.
+// A declined or failed authorization fails the order and puts its items back
+// into the cart. An authorization with an unknown outcome leaves the order
+// waiting for its payment.
+func (s *OrderCartService) authorizePayment(ctx context.Context, order *models.Order) error {
+	payment := order.Payment
+	reference, err := s.paymentProvider.Authorize(ctx, payments.AuthorizeRequest{
+		PaymentID: payment.PaymentID,
+		OrderID:   order.OrderID,
+		UserID:    order.UserID,
+		Amount:    payment.Amount,
+	})
+	if err == nil {
+		err := s.repo.AuthorizeOrderPayment(order.OrderID, reference)
+		if errors.Is(err, repository.ErrPaymentStatusConflict) {
+			// The payment sweeper gave up on the order while the provider
+			// was answering and queued the void of this authorization
+			return apperr.FailedPrecondition("PAYMENT_FAILED",
+				fmt.Sprintf("payment for order %s was not authorized in time", order.OrderID))
+		}
+		if err != nil {
+			return fmt.Errorf("failed to record payment authorization: %w", err)
+		}
+		updated, err := s.repo.GetOrderByID(order.OrderID)
+		if err != nil {
+			return fmt.Errorf("failed to get order: %w", err)
+		}
+		*order = *updated
+		return nil
+	}
+
+	if payments.IsOutcomeUnknown(err) {
+		// The provider may have authorized the payment all the same, so the
+		// order stays pending; the payment sweeper fails it later and voids
+		// whatever was authorized under its payment ID
+		log.Printf("Authorization of payment %s for order %s has an unknown outcome: %v", payment.PaymentID, order.OrderID, err)
+		return nil
+	}
+
+	paymentStatus, reason := payments.StatusFailed, err.Error()
+	var decline *payments.DeclineError
+	if errors.As(err, &decline) {
+		paymentStatus, reason = payments.StatusDeclined, decline.Reason
+	}
+	err = s.repo.FailOrderPayment(order.OrderID, paymentStatus, reason)
+	if err != nil && !errors.Is(err, repository.ErrPaymentStatusConflict) {
+		return fmt.Errorf("failed to record payment failure: %w", err)
+	}
+
+	if paymentStatus == payments.StatusDeclined {
+		return apperr.FailedPrecondition("PAYMENT_DECLINED",
+			fmt.Sprintf("payment for order %s was declined: %s", order.OrderID, reason))
+	}
+	return apperr.FailedPrecondition("PAYMENT_FAILED",
+		fmt.Sprintf("payment for order %s could not be authorized: %s", order.OrderID, reason))
+}
+
+// GetOrderPayment returns the payment taken for an order.
+//
+// The method returns a NotFound error if the order does not exist or was
+// placed before payments were taken.
+func (s *OrderCartService) GetOrderPayment(ctx context.Context, req *GetOrderPaymentRequest) (*GetOrderPaymentResponse, error) {
+	order, err := s.repo.GetOrderByID(req.OrderId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order: %w", err)
+	}
+
+	if err := auth.RequireOrderParty(ctx, order.UserID, order.RestaurantID); err != nil {
+		return nil, err
+	}
+
+	payment, err := s.repo.GetOrderPayment(order.OrderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payment: %w", err)
+	}
+
+	return &GetOrderPaymentResponse{
+		OrderId: order.OrderID,
+		Payment: paymentToPb(payment),
+		Message: "Order payment retrieved successfully",
+	}, nil
+}
+
+func paymentToPb(payment *models.Payment) *OrderPayment {
+	pb := &OrderPayment{
+		PaymentId:     payment.PaymentID,
+		Provider:      payment.Provider,
+		Status:        payment.Status,
+		Amount:        payment.Amount.Major(),
+		Currency:      payment.Amount.Currency,
+		FailureReason: payment.FailureReason,
+	}
+	if payment.AuthorizedAt != nil {
+		pb.AuthorizedAt = payment.AuthorizedAt.Format(time.RFC3339)
+	}
+	if payment.CapturedAt != nil {
+		pb.CapturedAt = payment.CapturedAt.Format(time.RFC3339)
+	}
+	return pb
+}
+
+// paymentMethodHeader is the metadata entry in which clients choose how an
+// order is paid. Orders are paid cash on delivery by default, as they were
+// before online and wallet payments, so clients that do not send the entry
+// are never charged without knowing it.
+const paymentMethodHeader = "payment-method"
+
+// requestedPaymentMethod returns the payment method the client chose.
+func requestedPaymentMethod(ctx context.Context) (string, error) {
+	value := metadataValue(ctx, paymentMethodHeader)
+	if value == "" {
+		return payments.MethodCOD, nil
+	}
+	method, err := payments.ParseMethod(value)
+	if err != nil {
+		return "", apperr.InvalidArgument("invalid "+paymentMethodHeader, apperr.FieldViolation{
+			Field:       paymentMethodHeader,
+			Description: fmt.Sprintf("must be one of %s, %s or %s", payments.MethodOnline, payments.MethodCOD, payments.MethodWallet),
+		})
+	}
+	return method, nil
+}
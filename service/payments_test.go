@@ -0,0 +1,210 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	orderCartPb "github.com/liju-github/CentralisedFoodbuddyMicroserviceProto/OrderCart"
+	restaurantPb "github.com/liju-github/CentralisedFoodbuddyMicroserviceProto/Restaurant"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/auth"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/models"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/money"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/orderstate"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/payments"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/scheduler"
+)
+
+func TestGetOrderPaymentOverGRPC(t *testing.T) {
+	const orderID = "order_0b8f6a3e-7c1d-4e2f-9a5b-1c2d3e4f5a6b"
+	authorized := time.Date(2024, 11, 21, 10, 0, 0, 0, time.UTC)
+	repo := &fakeRepo{
+		orders: map[string]*models.Order{
+			orderID: {OrderID: orderID, UserID: "user1", RestaurantID: "rest1", OrderStatus: "PENDING"},
+		},
+		payments: map[string]*models.Payment{
+			orderID: {PaymentID: "pay1", OrderID: orderID, Provider: "fake", Status: "AUTHORIZED", Amount: money.New(45000, "INR"), AuthorizedAt: &authorized},
+		},
+	}
+	conn := dial(t, &OrderCartService{repo: repo})
+
+	var resp GetOrderPaymentResponse
+	err := invokeExtension(as(t, auth.RoleRestaurant, "rest1"), conn, "GetOrderPayment", &GetOrderPaymentRequest{OrderId: orderID}, &resp)
+	if err != nil {
+		t.Fatalf("GetOrderPayment: %v", err)
+	}
+	if p := resp.Payment; resp.OrderId != orderID || p.PaymentId != "pay1" || p.Amount != 450 || p.Status != "AUTHORIZED" || p.AuthorizedAt != "2024-11-21T10:00:00Z" {
+		t.Errorf("GetOrderPayment = %+v, payment %+v", resp, resp.Payment)
+	}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want codes.Code
+	}{
+		{"other user", as(t, auth.RoleUser, "user2"), codes.PermissionDenied},
+		{"other restaurant", as(t, auth.RoleRestaurant, "rest2"), codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := invokeExtension(tt.ctx, conn, "GetOrderPayment", &GetOrderPaymentRequest{OrderId: orderID}, &GetOrderPaymentResponse{})
+			if status.Code(err) != tt.want {
+				t.Errorf("GetOrderPayment error = %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
+
+// TestDeclinedPaymentFailsOrder checks that a declined authorization is
+// recorded as such and reported to the client. What the repository does with
+// the failed order, such as giving the cart back, is not exercised by the fake.
+func TestDeclinedPaymentFailsOrder(t *testing.T) {
+	repo := &fakeRepo{
+		cart: []models.CartItem{
+			{UserID: "user1", RestaurantID: "rest1", ProductID: "p1", ProductName: "Dosa", Price: money.FromMajor(100, money.DefaultCurrency), Quantity: 2},
+		},
+	}
+	restaurant := &fakeRestaurant{products: map[string]*restaurantPb.Product{
+		"p1": {ProductId: "p1", RestaurantId: "rest1", Name: "Dosa", Price: 100, Stock: 10},
+	}}
+	conn := dial(t, NewOrderCartService(repo, restaurant, fakeUser{}, testPricer(t), scheduler.Policy{}, payments.NewFake(payments.OutcomeDecline)))
+	ctx := metadata.AppendToOutgoingContext(as(t, auth.RoleUser, "user1"), paymentMethodHeader, payments.MethodOnline)
+
+	_, err := orderCartPb.NewOrderCartServiceClient(conn).PlaceOrderByRestID(ctx,
+		&orderCartPb.PlaceOrderByRestIDRequest{UserId: "user1", RestaurantId: "rest1", DeliveryAddressId: "addr1"})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("PlaceOrderByRestID with a declined payment: error = %v, want FailedPrecondition", err)
+	}
+	if len(repo.orders) != 1 {
+		t.Fatalf("placed %d orders, want 1", len(repo.orders))
+	}
+	for _, order := range repo.orders {
+		if order.OrderStatus != string(orderstate.Failed) || order.Payment.Status != payments.StatusDeclined || order.Payment.FailureReason == "" {
+			t.Errorf("order after the declined payment = %s, payment %s %q; want failed and declined with a reason",
+				order.OrderStatus, order.Payment.Status, order.Payment.FailureReason)
+		}
+	}
+}
+
+// TestUnknownPaymentOutcomeKeepsOrderPending checks that an authorization the
+// provider never answered neither fails the order nor gives its cart back.
+func TestUnknownPaymentOutcomeKeepsOrderPending(t *testing.T) {
+	repo := &fakeRepo{
+		cart: []models.CartItem{
+			{UserID: "user1", RestaurantID: "rest1", ProductID: "p1", ProductName: "Dosa", Price: money.FromMajor(100, money.DefaultCurrency), Quantity: 2},
+		},
+	}
+	restaurant := &fakeRestaurant{products: map[string]*restaurantPb.Product{
+		"p1": {ProductId: "p1", RestaurantId: "rest1", Name: "Dosa", Price: 100, Stock: 10},
+	}}
+	provider := payments.WithTimeout(payments.NewFake(payments.OutcomeTimeout), 10*time.Millisecond)
+	conn := dial(t, NewOrderCartService(repo, restaurant, fakeUser{}, testPricer(t), scheduler.Policy{}, provider))
+	ctx := metadata.AppendToOutgoingContext(as(t, auth.RoleUser, "user1"), paymentMethodHeader, payments.MethodOnline)
+
+	placed, err := orderCartPb.NewOrderCartServiceClient(conn).PlaceOrderByRestID(ctx,
+		&orderCartPb.PlaceOrderByRestIDRequest{UserId: "user1", RestaurantId: "rest1", DeliveryAddressId: "addr1"})
+	if err != nil {
+		t.Fatalf("PlaceOrderByRestID with a timed out payment: %v", err)
+	}
+	order := repo.orders[placed.OrderId]
+	if order.OrderStatus != string(orderstate.PaymentPending) || order.Payment.Status != payments.StatusPending {
+		t.Errorf("order after a timed out payment = %s, payment %s; want both pending", order.OrderStatus, order.Payment.Status)
+	}
+	if len(repo.cart) != 0 {
+		t.Errorf("cart after a timed out payment = %+v, want it still cleared", repo.cart)
+	}
+}
+
+func TestRequestedPaymentMethod(t *testing.T) {
+	tests := []struct {
+		header  string
+		want    string
+		wantErr bool
+	}{
+		{header: "", want: payments.MethodCOD},
+		{header: "online", want: payments.MethodOnline},
+		{header: "WALLET", want: payments.MethodWallet},
+		{header: "card", wantErr: true},
+	}
+	for _, tt := range tests {
+		ctx := context.Background()
+		if tt.header != "" {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(paymentMethodHeader, tt.header))
+		}
+		got, err := requestedPaymentMethod(ctx)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("requestedPaymentMethod(%q) = %q, %v; want %q", tt.header, got, err, tt.want)
+		}
+	}
+}
+
+func TestWalletOverGRPC(t *testing.T) {
+	repo := &fakeRepo{}
+	conn := dial(t, &OrderCartService{repo: repo})
+
+	err := invokeExtension(as(t, auth.RoleUser, "user1"), conn, "CreditWallet",
+		&CreditWalletRequest{UserId: "user1", Amount: 100}, &CreditWalletResponse{})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("CreditWallet as the user: error = %v, want PermissionDenied", err)
+	}
+
+	var credit CreditWalletResponse
+	err = invokeExtension(as(t, auth.RoleAdmin, "admin1"), conn, "CreditWallet",
+		&CreditWalletRequest{UserId: "user1", Amount: 250.5, Description: "Goodwill credit"}, &credit)
+	if err != nil {
+		t.Fatalf("CreditWallet: %v", err)
+	}
+
+	var balance GetWalletBalanceResponse
+	err = invokeExtension(as(t, auth.RoleUser, "user1"), conn, "GetWalletBalance", &GetWalletBalanceRequest{UserId: "user1"}, &balance)
+	if err != nil {
+		t.Fatalf("GetWalletBalance: %v", err)
+	}
+	if w := balance.Wallet; w.Balance != 250.5 || w.Available != 250.5 || w.Held != 0 {
+		t.Errorf("wallet = %+v, want a balance of 250.5 all available", w)
+	}
+
+	err = invokeExtension(as(t, auth.RoleUser, "user2"), conn, "GetWalletBalance", &GetWalletBalanceRequest{UserId: "user1"}, &GetWalletBalanceResponse{})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("GetWalletBalance of another user: error = %v, want PermissionDenied", err)
+	}
+}
+
+func TestRefundsOverGRPC(t *testing.T) {
+	const orderID = "order_0b8f6a3e-7c1d-4e2f-9a5b-1c2d3e4f5a6b"
+	repo := &fakeRepo{orders: map[string]*models.Order{
+		orderID: {OrderID: orderID, UserID: "user1", RestaurantID: "rest1", OrderStatus: "DELIVERED", Total: money.New(45000, "INR")},
+	}}
+	conn := dial(t, &OrderCartService{repo: repo})
+
+	req := &IssueRefundRequest{
+		OrderId: orderID,
+		Items:   []*RefundItem{{ProductId: "p1", Quantity: 2}},
+		Reason:  "Items missing from delivery",
+	}
+	err := invokeExtension(as(t, auth.RoleUser, "user1"), conn, "IssueRefund", req, &IssueRefundResponse{})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("IssueRefund as the user: error = %v, want PermissionDenied", err)
+	}
+
+	var issued IssueRefundResponse
+	if err := invokeExtension(as(t, auth.RoleAdmin, "admin1"), conn, "IssueRefund", req, &issued); err != nil {
+		t.Fatalf("IssueRefund: %v", err)
+	}
+	if r := issued.Refund; r.Amount != 200 || r.ActorType != string(orderstate.ActorAdmin) || r.ActorId != "admin1" || len(r.Items) != 1 {
+		t.Errorf("refund = %+v", r)
+	}
+
+	var refunds GetOrderRefundsResponse
+	err = invokeExtension(as(t, auth.RoleUser, "user1"), conn, "GetOrderRefunds", &GetOrderRefundsRequest{OrderId: orderID}, &refunds)
+	if err != nil {
+		t.Fatalf("GetOrderRefunds: %v", err)
+	}
+	if len(refunds.Refunds) != 1 || refunds.Refunds[0].RefundId != issued.Refund.RefundId {
+		t.Errorf("GetOrderRefunds = %+v", refunds)
+	}
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/apperr"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/auth"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/models"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/money"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/pricing"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/repository"
+)
+
+// expectedTotalHeader is the metadata entry in which clients echo the order
+// total they showed the user, in major units such as "344.72".
+const expectedTotalHeader = "expected-total"
+
+// expectedTotal returns the total the client expects the order to cost, or
+// nil if it did not send one.
+func expectedTotal(ctx context.Context) (*money.Money, error) {
+	value := metadataValue(ctx, expectedTotalHeader)
+	if value == "" {
+		return nil, nil
+	}
+	amount, err := strconv.ParseFloat(value, 64)
+	if err != nil || amount < 0 {
+		return nil, apperr.InvalidArgument("invalid "+expectedTotalHeader, apperr.FieldViolation{
+			Field:       expectedTotalHeader,
+			Description: "must be a non-negative decimal amount",
+		})
+	}
+	total := money.FromMajor(amount, money.DefaultCurrency)
+	return &total, nil
+}
+
+// priceChanges returns the cart items whose unit price, options included,
+// differs from the unit price of the order item created from them, in cart
+// order.
+func priceChanges(items []models.CartItem, orderItems []models.OrderItem) []apperr.PriceChange {
+	var changes []apperr.PriceChange
+	for i, item := range items {
+		oldPrice := pricing.UnitPrice(item.Price, item.Options)
+		newPrice := pricing.UnitPrice(orderItems[i].Price, orderItems[i].Options)
+		if oldPrice.Minor != newPrice.Minor {
+			changes = append(changes, apperr.PriceChange{
+				ProductID:   item.ProductID,
+				ProductName: item.ProductName,
+				OldPrice:    oldPrice,
+				NewPrice:    newPrice,
+			})
+		}
+	}
+	return changes
+}
+
+// RefreshCart re-syncs the names, prices and availability of the items in the
+// user's cart at a restaurant with the restaurant's catalogue and the
+// product options, and reports what changed. Lines whose product no longer
+// exists or is out of stock, or with an option that is no longer offered,
+// stay in the cart marked unavailable. The reported total is the grand total
+// of the refreshed cart's bill with the default delivery fee.
+func (s *OrderCartService) RefreshCart(ctx context.Context, req *RefreshCartRequest) (*RefreshCartResponse, error) {
+	if err := auth.RequireUser(ctx, req.UserId); err != nil {
+		return nil, err
+	}
+
+	items, err := s.repo.GetCartItems(req.UserId, req.RestaurantId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cart items: %w", err)
+	}
+
+	products, errs := s.fetchProducts(ctx, req.RestaurantId, items)
+	for _, err := range errs {
+		if err != nil && !apperr.IsKind(err, apperr.KindNotFound) {
+			return nil, err
+		}
+	}
+
+	options, optionUnavailable, err := s.currentOptions(items)
+	if err != nil {
+		return nil, err
+	}
+
+	// Work out the up to date details of every line
+	refreshed := make(map[uint]models.CartItem, len(items))
+	var changes []*CartItemChange
+	for i, item := range items {
+		updated := item
+		var stock int32
+		if product := products[i]; product != nil {
+			updated.ProductName = product.Name
+			updated.Description = product.Description
+			updated.Category = product.Category
+			updated.Price = money.FromMajor(product.Price, item.Price.Currency)
+			stock = product.Stock
+		}
+		updated.Options = options[i]
+		updated.Unavailable = products[i] == nil || stock <= 0 || optionUnavailable[i]
+		refreshed[item.ID] = updated
+
+		oldPrice := pricing.UnitPrice(item.Price, item.Options)
+		newPrice := pricing.UnitPrice(updated.Price, updated.Options)
+		if newPrice != oldPrice || updated.Unavailable != item.Unavailable || updated.ProductName != item.ProductName {
+			changes = append(changes, &CartItemChange{
+				ProductId:      item.ProductID,
+				LineKey:        item.LineKey,
+				ProductName:    updated.ProductName,
+				OldPrice:       oldPrice.Major(),
+				NewPrice:       newPrice.Major(),
+				Available:      !updated.Unavailable,
+				AvailableStock: stock,
+			})
+		}
+	}
+
+	// Save them to the lines that are still in the cart
+	var cart []models.CartItem
+	err = s.repo.WithTx(ctx, func(repo repository.OrderCartRepository) error {
+		lines, err := repo.LockCartItems(req.UserId, req.RestaurantId)
+		if err != nil {
+			return fmt.Errorf("failed to lock cart: %w", err)
+		}
+		for _, line := range lines {
+			if updated, ok := refreshed[line.ID]; ok {
+				updated.Quantity = line.Quantity
+				if err := repo.UpdateCartItemDetails(&updated); err != nil {
+					return fmt.Errorf("failed to update cart item: %w", err)
+				}
+				line = updated
+			}
+			cart = append(cart, line)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	bill, _, err := s.quoteCart(req.UserId, req.RestaurantId, cart, "")
+	if err != nil {
+		return nil, err
+	}
+
+	message := "Cart is up to date"
+	if len(changes) > 0 {
+		message = fmt.Sprintf("%d cart items changed", len(changes))
+	}
+	return &RefreshCartResponse{
+		Items:       cartItemsToPb(cart),
+		TotalAmount: bill.GrandTotal.Major(),
+		Changes:     changes,
+		Message:     message,
+	}, nil
+}
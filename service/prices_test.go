@@ -0,0 +1,83 @@
+package service
+
+import (
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+
+	orderCartPb "github.com/liju-github/CentralisedFoodbuddyMicroserviceProto/OrderCart"
+	restaurantPb "github.com/liju-github/CentralisedFoodbuddyMicroserviceProto/Restaurant"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/auth"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/models"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/money"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/payments"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/scheduler"
+)
+
+// TestRefreshThenPlaceOrder checks that an order for a cart whose prices
+// changed is refused until the cart is refreshed, and is then placed at the
+// refreshed total.
+func TestRefreshThenPlaceOrder(t *testing.T) {
+	repo := &fakeRepo{cart: []models.CartItem{{
+		Model:        gorm.Model{ID: 1},
+		UserID:       "user1",
+		RestaurantID: "rest1",
+		ProductID:    "p1",
+		ProductName:  "Dosa",
+		Price:        money.FromMajor(80, money.DefaultCurrency),
+		Quantity:     2,
+	}}}
+	restaurant := &fakeRestaurant{products: map[string]*restaurantPb.Product{
+		"p1": {ProductId: "p1", RestaurantId: "rest1", Name: "Masala Dosa", Price: 90, Stock: 10},
+	}}
+	svc := NewOrderCartService(repo, restaurant, fakeUser{}, testPricer(t), scheduler.Policy{}, payments.NewFake(payments.OutcomeSucceed))
+	conn := dial(t, svc)
+	client := orderCartPb.NewOrderCartServiceClient(conn)
+	ctx := as(t, auth.RoleUser, "user1")
+	place := &orderCartPb.PlaceOrderByRestIDRequest{UserId: "user1", RestaurantId: "rest1", DeliveryAddressId: "addr1"}
+
+	_, err := client.PlaceOrderByRestID(ctx, place)
+	if reason := errorReason(err); status.Code(err) != codes.FailedPrecondition || reason != "PRICE_CHANGED" {
+		t.Fatalf("PlaceOrderByRestID before refresh: error = %v (%s), want PRICE_CHANGED", err, reason)
+	}
+
+	var refreshed RefreshCartResponse
+	err = invokeExtension(ctx, conn, "RefreshCart", &RefreshCartRequest{UserId: "user1", RestaurantId: "rest1"}, &refreshed)
+	if err != nil {
+		t.Fatalf("RefreshCart: %v", err)
+	}
+	if len(refreshed.Changes) != 1 || refreshed.Changes[0].OldPrice != 80 || refreshed.Changes[0].NewPrice != 90 {
+		t.Fatalf("RefreshCart changes = %+v, want p1 from 80 to 90", refreshed.Changes)
+	}
+	const wantTotal = 180 + 9 + 30
+	if refreshed.TotalAmount != wantTotal {
+		t.Errorf("RefreshCart total = %v, want %v", refreshed.TotalAmount, wantTotal)
+	}
+
+	placed, err := client.PlaceOrderByRestID(ctx, place)
+	if err != nil {
+		t.Fatalf("PlaceOrderByRestID after refresh: %v", err)
+	}
+	order := repo.orders[placed.OrderId]
+	if order == nil || order.Total != money.FromMajor(wantTotal, money.DefaultCurrency) {
+		t.Errorf("placed order = %+v, want total %v", order, wantTotal)
+	}
+	if order != nil && order.OrderItems[0].ProductName != "Masala Dosa" {
+		t.Errorf("order item name = %q, want the refreshed name", order.OrderItems[0].ProductName)
+	}
+	if len(repo.cart) != 0 {
+		t.Errorf("cart still holds %d items after the order was placed", len(repo.cart))
+	}
+}
+
+// errorReason returns the ErrorInfo reason attached to err.
+func errorReason(err error) string {
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(interface{ GetReason() string }); ok {
+			return info.GetReason()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	restaurantPb "github.com/liju-github/CentralisedFoodbuddyMicroserviceProto/Restaurant"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/apperr"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/models"
+)
+
+// maxConcurrentProductLookups bounds the GetProductByID calls in flight for a
+// single order.
+const maxConcurrentProductLookups = 8
+
+// fetchProducts returns the latest details of the product of every cart item,
+// in cart order, along with the lookup error of each item. The restaurant's
+// catalogue is fetched in one call and any product missing from it, or every
+// product if the batch call fails, is looked up individually and
+// concurrently. Callers walk the items in cart order and check each item's
+// error before using its product, so the first failing item is reported
+// exactly as a sequential lookup would.
+func (s *OrderCartService) fetchProducts(ctx context.Context, restaurantID string, items []models.CartItem) ([]*restaurantPb.Product, []error) {
+	products := make([]*restaurantPb.Product, len(items))
+
+	catalogue, err := s.restaurantClient.GetRestaurantProductsByID(ctx, &restaurantPb.GetRestaurantProductsByIDRequest{
+		RestaurantId: restaurantID,
+	})
+	if err != nil {
+		log.Printf("Batch product lookup for restaurant %s failed, falling back to per-product lookups: %v", restaurantID, err)
+	} else {
+		byID := make(map[string]*restaurantPb.Product, len(catalogue.Products))
+		for _, product := range catalogue.Products {
+			byID[product.ProductId] = product
+		}
+		for i, item := range items {
+			products[i] = byID[item.ProductID]
+		}
+	}
+
+	errs := make([]error, len(items))
+	sem := make(chan struct{}, maxConcurrentProductLookups)
+	var wg sync.WaitGroup
+
+	for i, item := range items {
+		if products[i] != nil {
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, productID string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			productResp, err := s.restaurantClient.GetProductByID(ctx, &restaurantPb.GetProductByIDRequest{
+				ProductId: productID,
+			})
+			if err != nil {
+				errs[i] = fmt.Errorf("failed to get product details for %s: %w", productID, err)
+				return
+			}
+			if productResp.Product == nil {
+				errs[i] = apperr.NotFound("product", productID)
+				return
+			}
+			products[i] = productResp.Product
+		}(i, item.ProductID)
+	}
+	wg.Wait()
+
+	return products, errs
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	orderCartPb "github.com/liju-github/CentralisedFoodbuddyMicroserviceProto/OrderCart"
+	restaurantPb "github.com/liju-github/CentralisedFoodbuddyMicroserviceProto/Restaurant"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/apperr"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/models"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/money"
+)
+
+// TestPlaceOrderFirstFailingItem checks that placing an order reports the
+// first item in cart order that cannot be ordered, whether its product could
+// not be found or is out of stock.
+func TestPlaceOrderFirstFailingItem(t *testing.T) {
+	inStock := &restaurantPb.Product{ProductId: "p1", RestaurantId: "rest1", Name: "Dosa", Price: 80, Stock: 10}
+	lowStock := &restaurantPb.Product{ProductId: "p2", RestaurantId: "rest1", Name: "Idli", Price: 40, Stock: 1}
+
+	tests := []struct {
+		name     string
+		products []*restaurantPb.Product
+		cart     []string
+		want     apperr.Kind
+	}{
+		{"out of stock before missing", []*restaurantPb.Product{inStock, lowStock}, []string{"p1", "p2", "gone"}, apperr.KindInsufficientStock},
+		{"missing before out of stock", []*restaurantPb.Product{inStock, lowStock}, []string{"p1", "gone", "p2"}, apperr.KindNotFound},
+	}
+
+	for _, tt := range tests {
+		for _, noCatalogue := range []bool{false, true} {
+			restaurant := &fakeRestaurant{products: map[string]*restaurantPb.Product{}, noCatalogue: noCatalogue}
+			for _, product := range tt.products {
+				restaurant.products[product.ProductId] = product
+			}
+			repo := &fakeRepo{}
+			for i, productID := range tt.cart {
+				repo.cart = append(repo.cart, models.CartItem{
+					UserID:       "user1",
+					RestaurantID: "rest1",
+					ProductID:    productID,
+					ProductName:  productID,
+					Price:        money.FromMajor(10, money.DefaultCurrency),
+					Quantity:     int32(2 + i%2),
+				})
+			}
+			svc := &OrderCartService{repo: repo, restaurantClient: restaurant}
+
+			_, err := svc.placeOrder(context.Background(), &orderCartPb.PlaceOrderByRestIDRequest{UserId: "user1", RestaurantId: "rest1"}, nil)
+			if !apperr.IsKind(err, tt.want) {
+				t.Errorf("%s (batch lookup failing: %v): error = %v, want %s", tt.name, noCatalogue, err, tt.want)
+			}
+		}
+	}
+}
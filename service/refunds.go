@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/auth"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/models"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/orderstate"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/repository"
+)
+
+// maxRefundReasonLength is the longest reason a refund may carry.
+const maxRefundReasonLength = 255
+
+// IssueRefund refunds all that is left of an order's payment, or the listed
+// quantities of its products, e.g. items missing from a delivery. Only
+// delivered, cancelled and partially refunded orders paid online or from a
+// wallet can be refunded. It is only available to admins.
+//
+// The refund fails with a FailedPrecondition error if it would exceed the
+// amount paid less earlier refunds (REFUND_EXCEEDS_PAID) or the quantity
+// ordered less the quantity already refunded (REFUND_EXCEEDS_ORDERED). The
+// order becomes "PARTIALLY_REFUNDED" or "REFUNDED" once the refund is paid
+// out.
+func (s *OrderCartService) IssueRefund(ctx context.Context, req *IssueRefundRequest) (*IssueRefundResponse, error) {
+	if err := auth.RequireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	identity, _ := auth.FromContext(ctx)
+
+	refundReq := repository.RefundRequest{
+		OrderID:   req.OrderId,
+		Full:      req.Full,
+		Reason:    req.Reason,
+		ActorType: string(orderstate.ActorAdmin),
+		ActorID:   identity.Subject,
+	}
+	for _, item := range req.Items {
+		refundReq.Items = append(refundReq.Items, repository.RefundItemRequest{
+			ProductID: item.ProductId,
+			Quantity:  item.Quantity,
+		})
+	}
+
+	refund, err := s.repo.IssueRefund(refundReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue refund: %w", err)
+	}
+
+	return &IssueRefundResponse{
+		Refund:  refundToPb(refund),
+		Message: fmt.Sprintf("Refund of %s issued successfully", refund.Amount),
+	}, nil
+}
+
+// GetOrderRefunds returns the refunds issued for an order, oldest first.
+func (s *OrderCartService) GetOrderRefunds(ctx context.Context, req *GetOrderRefundsRequest) (*GetOrderRefundsResponse, error) {
+	order, err := s.repo.GetOrderByID(req.OrderId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order: %w", err)
+	}
+
+	if err := auth.RequireOrderParty(ctx, order.UserID, order.RestaurantID); err != nil {
+		return nil, err
+	}
+
+	refunds, err := s.repo.GetOrderRefunds(order.OrderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get refunds: %w", err)
+	}
+
+	var pbRefunds []*OrderRefund
+	for i := range refunds {
+		pbRefunds = append(pbRefunds, refundToPb(&refunds[i]))
+	}
+
+	return &GetOrderRefundsResponse{
+		OrderId:     order.OrderID,
+		OrderStatus: order.OrderStatus,
+		Refunds:     pbRefunds,
+		Message:     "Order refunds retrieved successfully",
+	}, nil
+}
+
+func refundToPb(refund *models.Refund) *OrderRefund {
+	pb := &OrderRefund{
+		RefundId:      refund.RefundID,
+		Amount:        refund.Amount.Major(),
+		Currency:      refund.Amount.Currency,
+		Reason:        refund.Reason,
+		Status:        refund.Status,
+		ActorType:     refund.ActorType,
+		ActorId:       refund.ActorID,
+		FailureReason: refund.FailureReason,
+		CreatedAt:     refund.CreatedAt.Format(time.RFC3339),
+	}
+	for _, item := range refund.Items {
+		pb.Items = append(pb.Items, &RefundItem{
+			ProductId: item.ProductID,
+			Quantity:  item.Quantity,
+			Amount:    item.Amount.Major(),
+		})
+	}
+	return pb
+}
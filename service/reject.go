@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/apperr"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/auth"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/models"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/orderstate"
+)
+
+// maxRejectionNoteLength is the longest note a restaurant may add to a
+// rejection, short enough for the note and the reason code's description to
+// fit in the order's cancellation reason.
+const maxRejectionNoteLength = 200
+
+// RejectOrder lets a restaurant reject an order it cannot fulfil, giving one
+// of the orderstate rejection codes and an optional note. The order is
+// cancelled, its stock is given back and its payment is voided or refunded.
+// The user sees the reason as the order's cancel reason in
+// GetOrderDetailsByID.
+//
+// The method returns an error if the order is not found or does not belong to
+// the restaurant. A FailedPrecondition error is returned if the restaurant can
+// no longer cancel the order.
+func (s *OrderCartService) RejectOrder(ctx context.Context, req *RejectOrderRequest) (*RejectOrderResponse, error) {
+	if err := auth.RequireRestaurant(ctx, req.RestaurantId); err != nil {
+		return nil, err
+	}
+
+	code, err := orderstate.ParseRejectionCode(req.ReasonCode)
+	if err != nil {
+		return nil, apperr.InvalidArgument(err.Error(), apperr.FieldViolation{Field: "reasonCode", Description: err.Error()})
+	}
+
+	order, err := s.repo.GetOrderByID(req.OrderId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order: %w", err)
+	}
+
+	if order.RestaurantID != req.RestaurantId {
+		return nil, apperr.Unauthorized("order does not belong to this restaurant")
+	}
+
+	next, err := checkTransition(orderstate.ActorRestaurant, order.OrderStatus, string(orderstate.Cancelled))
+	if err != nil {
+		return nil, err
+	}
+
+	reason := "rejected by restaurant: " + code.Description()
+	if req.Note != "" {
+		reason += ": " + req.Note
+	}
+	event := &models.OrderStatusEvent{
+		OrderID:    order.OrderID,
+		FromStatus: order.OrderStatus,
+		ToStatus:   string(next),
+		ActorType:  string(orderstate.ActorRestaurant),
+		ActorID:    req.RestaurantId,
+		Reason:     reason,
+	}
+	if err := s.repo.UpdateOrderRejection(event, code); err != nil {
+		return nil, statusUpdateError(order.OrderID, err)
+	}
+
+	return &RejectOrderResponse{
+		Success:      true,
+		Message:      "Order rejected successfully",
+		OrderStatus:  string(next),
+		ReasonCode:   string(code),
+		CancelReason: reason,
+	}, nil
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/auth"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/models"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/orderstate"
+)
+
+// TestRejectOrderOverGRPC checks who may reject an order, the reason codes
+// accepted and the cancellation handed to the repository. Giving back the
+// order's stock and payment is the repository's job, which the fake does not
+// do.
+func TestRejectOrderOverGRPC(t *testing.T) {
+	const orderID = "order_0b8f6a3e-7c1d-4e2f-9a5b-1c2d3e4f5a6b"
+	repo := &fakeRepo{orders: map[string]*models.Order{
+		orderID: {OrderID: orderID, UserID: "user1", RestaurantID: "rest1", OrderStatus: string(orderstate.Pending)},
+	}}
+	conn := dial(t, &OrderCartService{repo: repo})
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		req  *RejectOrderRequest
+		want codes.Code
+	}{
+		{"unknown reason code", as(t, auth.RoleRestaurant, "rest1"), &RejectOrderRequest{OrderId: orderID, RestaurantId: "rest1", ReasonCode: "BORED"}, codes.InvalidArgument},
+		{"the user", as(t, auth.RoleUser, "user1"), &RejectOrderRequest{OrderId: orderID, RestaurantId: "rest1", ReasonCode: "TOO_BUSY"}, codes.PermissionDenied},
+		{"another restaurant", as(t, auth.RoleRestaurant, "rest2"), &RejectOrderRequest{OrderId: orderID, RestaurantId: "rest2", ReasonCode: "TOO_BUSY"}, codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := invokeExtension(tt.ctx, conn, "RejectOrder", tt.req, &RejectOrderResponse{})
+			if status.Code(err) != tt.want {
+				t.Errorf("RejectOrder error = %v, want %s", err, tt.want)
+			}
+		})
+	}
+
+	var resp RejectOrderResponse
+	err := invokeExtension(as(t, auth.RoleRestaurant, "rest1"), conn, "RejectOrder",
+		&RejectOrderRequest{OrderId: orderID, RestaurantId: "rest1", ReasonCode: "OUT_OF_STOCK", Note: "No paneer left"}, &resp)
+	if err != nil {
+		t.Fatalf("RejectOrder: %v", err)
+	}
+	const wantReason = "rejected by restaurant: some items are out of stock: No paneer left"
+	if resp.OrderStatus != string(orderstate.Cancelled) || resp.ReasonCode != "OUT_OF_STOCK" || resp.CancelReason != wantReason {
+		t.Errorf("RejectOrder = %+v", resp)
+	}
+	if order := repo.orders[orderID]; order.OrderStatus != string(orderstate.Cancelled) || order.RejectionCode != "OUT_OF_STOCK" {
+		t.Errorf("order after rejection = %+v", order)
+	}
+}
@@ -0,0 +1,33 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/apperr"
+)
+
+// scheduledForHeader is the metadata entry in which clients request a future
+// delivery slot, as an RFC 3339 timestamp.
+const scheduledForHeader = "scheduled-for"
+
+// scheduledFor returns the delivery slot the client booked, or nil if the
+// order is for delivery now. The slot must be allowed by the schedule policy.
+func (s *OrderCartService) scheduledFor(ctx context.Context) (*time.Time, error) {
+	value := metadataValue(ctx, scheduledForHeader)
+	if value == "" {
+		return nil, nil
+	}
+	slot, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, apperr.InvalidArgument("invalid "+scheduledForHeader, apperr.FieldViolation{
+			Field:       scheduledForHeader,
+			Description: "must be an RFC 3339 timestamp",
+		})
+	}
+	if err := s.schedule.CheckSlot(scheduledForHeader, slot, time.Now()); err != nil {
+		return nil, err
+	}
+	slot = slot.UTC()
+	return &slot, nil
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"time"
@@ -11,140 +12,192 @@ import (
 	orderCartPb "github.com/liju-github/CentralisedFoodbuddyMicroserviceProto/OrderCart"
 	restaurantPb "github.com/liju-github/CentralisedFoodbuddyMicroserviceProto/Restaurant"
 	userPb "github.com/liju-github/CentralisedFoodbuddyMicroserviceProto/User"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/apperr"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/auth"
 	clients "github.com/liju-github/FoodBuddyMicroserviceOrderCart/clients"
 	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/models"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/money"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/orderstate"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/payments"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/pricing"
 	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/repository"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/scheduler"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/validation"
 )
 
 type OrderCartService struct {
 	orderCartPb.UnimplementedOrderCartServiceServer
-	repo repository.OrderCartRepository
+	repo             repository.OrderCartRepository
+	restaurantClient clients.RestaurantClient
+	userClient       clients.UserClient
+	pricer           *pricing.Engine
+	schedule         scheduler.Policy
+	paymentProvider  payments.Provider
 }
 
-func NewOrderCartService(repo repository.OrderCartRepository) *OrderCartService {
-	return &OrderCartService{repo: repo}
+func NewOrderCartService(repo repository.OrderCartRepository, restaurantClient clients.RestaurantClient, userClient clients.UserClient, pricer *pricing.Engine, schedule scheduler.Policy, paymentProvider payments.Provider) *OrderCartService {
+	return &OrderCartService{
+		repo:             repo,
+		restaurantClient: restaurantClient,
+		userClient:       userClient,
+		pricer:           pricer,
+		schedule:         schedule,
+		paymentProvider:  paymentProvider,
+	}
 }
 
 // Cart Operations
 // AddProductToCart adds a product to the user's cart, but only if the
 // restaurant has sufficient stock.
+//
+// The method returns a NotFound error if the product does not exist and a
+// RestaurantBanned error if its restaurant cannot take orders.
 func (s *OrderCartService) AddProductToCart(ctx context.Context, req *orderCartPb.AddProductToCartRequest) (*orderCartPb.AddProductToCartResponse, error) {
-	restaurantClient, err := clients.NewRestaurantClient()
-	if err != nil {
+	if err := auth.RequireUser(ctx, req.UserId); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.addToCart(ctx, req.UserId, req.ProductId, req.Quantity, nil, ""); err != nil {
 		return nil, err
 	}
 
+	return &orderCartPb.AddProductToCartResponse{
+		Success: true,
+		Message: "Product added to cart successfully",
+	}, nil
+}
+
+// addToCart adds quantity units of a product with the given options and
+// special instructions to the user's cart. Units are added to the existing
+// line of the product with the same options and instructions, if any.
+func (s *OrderCartService) addToCart(ctx context.Context, userID, productID string, quantity int32, optionIDs []string, instructions string) (*models.CartItem, error) {
 	// Get product details
 	productReq := &restaurantPb.GetProductByIDRequest{
-		ProductId: req.ProductId,
+		ProductId: productID,
 	}
-	productResp, err := restaurantClient.GetProductByID(ctx, productReq)
+	productResp, err := s.restaurantClient.GetProductByID(ctx, productReq)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get product details: %w", err)
 	}
 
 	if productResp.Product == nil {
-		return &orderCartPb.AddProductToCartResponse{
-			Message: "Product not found",
-		}, nil
+		return nil, apperr.NotFound("product", productID)
 	}
 
 	// Check if restaurant is banned
 	banStatusReq := &restaurantPb.CheckRestaurantBanStatusRequest{
 		RestaurantId: productResp.Product.RestaurantId,
 	}
-	banStatus, err := restaurantClient.CheckRestaurantBanStatus(ctx, banStatusReq)
+	banStatus, err := s.restaurantClient.CheckRestaurantBanStatus(ctx, banStatusReq)
 	if err != nil {
 		return nil, fmt.Errorf("failed to check restaurant status: %w", err)
 	}
 	if banStatus.IsBanned {
-		return &orderCartPb.AddProductToCartResponse{
-			Message: fmt.Sprintf("Restaurant is currently unavailable. Reason: %s", banStatus.Reason),
-		}, nil
+		return nil, apperr.RestaurantBanned(productResp.Product.RestaurantId, banStatus.Reason)
+	}
+
+	// Resolve the selected options against the product's current options
+	options, err := s.resolveOptions(productID, optionIDs)
+	if err != nil {
+		return nil, err
 	}
 
 	// Create cart item with additional details
 	cartItem := &models.CartItem{
-		UserID:       req.UserId,
-		ProductID:    req.ProductId,
-		RestaurantID: productResp.Product.RestaurantId,
-		ProductName:  productResp.Product.Name,
-		Description:  productResp.Product.Description,
-		Category:     productResp.Product.Category,
-		Price:        productResp.Product.Price,
-		Quantity:     req.Quantity,
+		UserID:              userID,
+		ProductID:           productID,
+		RestaurantID:        productResp.Product.RestaurantId,
+		ProductName:         productResp.Product.Name,
+		Description:         productResp.Product.Description,
+		Category:            productResp.Product.Category,
+		Price:               money.FromMajor(productResp.Product.Price, money.DefaultCurrency),
+		Quantity:            quantity,
+		LineKey:             cartLineKey(options, instructions),
+		Options:             options,
+		SpecialInstructions: instructions,
 	}
 
-	err = s.repo.AddToCart(cartItem)
+	// Enforce the cart size limits while the cart is locked
+	err = s.repo.WithTx(ctx, func(repo repository.OrderCartRepository) error {
+		lines, err := repo.LockCartItems(userID, cartItem.RestaurantID)
+		if err != nil {
+			return err
+		}
+		for _, line := range lines {
+			if line.ProductID == cartItem.ProductID && line.LineKey == cartItem.LineKey {
+				if err := checkLineQuantity(line.Quantity + cartItem.Quantity); err != nil {
+					return err
+				}
+				return repo.AddToCart(cartItem)
+			}
+		}
+		if len(lines) >= validation.MaxCartLines {
+			return apperr.FailedPrecondition("CART_FULL",
+				fmt.Sprintf("cart cannot hold more than %d lines", validation.MaxCartLines))
+		}
+		return repo.AddToCart(cartItem)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to add to cart: %w", err)
 	}
-
-	return &orderCartPb.AddProductToCartResponse{
-		Message: "Product added to cart successfully",
-	}, nil
+	return cartItem, nil
 }
 
-// GetCartItems returns the items in the user's cart, as well as the total cost of all items in the cart.
+// GetCartItems returns the items in the user's cart, as well as the grand
+// total of the cart's bill with the default delivery fee. GetCartBill prices
+// delivery to an address.
 func (s *OrderCartService) GetCartItems(ctx context.Context, req *orderCartPb.GetCartItemsRequest) (*orderCartPb.GetCartItemsResponse, error) {
+	if err := auth.RequireUser(ctx, req.UserId); err != nil {
+		return nil, err
+	}
+
 	items, err := s.repo.GetCartItems(req.UserId, req.RestaurantId)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get cart items: %w", err)
 	}
 
-	var cartItems []*orderCartPb.CartItem
-	var totalAmount float64
-
-	for _, item := range items {
-		cartItems = append(cartItems, &orderCartPb.CartItem{
-			ProductId:    item.ProductID,
-			RestaurantId: item.RestaurantID,
-			ProductName:  item.ProductName,
-			Description:  item.Description,
-			Category:     item.Category,
-			Price:        item.Price,
-			Quantity:     item.Quantity,
-		})
-		totalAmount += item.Price * float64(item.Quantity)
+	bill, _, err := s.quoteCart(req.UserId, req.RestaurantId, items, "")
+	if err != nil {
+		return nil, err
 	}
 
 	return &orderCartPb.GetCartItemsResponse{
-		Items:       cartItems,
-		TotalAmount: totalAmount,
+		Items:       cartItemsToPb(items),
+		TotalAmount: bill.GrandTotal.Major(),
 		Message:     "Cart items retrieved successfully",
 	}, nil
 }
 
-// GetCartByRestaurant returns items in the user's cart for a specific restaurant
+// GetCartByRestaurant returns items in the user's cart for a specific
+// restaurant and the grand total of their bill with the default delivery fee.
 func (s *OrderCartService) GetCartByRestaurant(ctx context.Context, req *orderCartPb.GetCartByRestaurantRequest) (*orderCartPb.GetCartByRestaurantResponse, error) {
+	if err := auth.RequireUser(ctx, req.UserId); err != nil {
+		return nil, err
+	}
+
 	items, err := s.repo.GetCartItems(req.UserId, req.RestaurantId)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get cart items: %w", err)
 	}
 
-	var totalAmount float64
-	var cartItems []*orderCartPb.CartItem
-
-	for _, item := range items {
-		cartItems = append(cartItems, &orderCartPb.CartItem{
-			ProductId:   item.ProductID,
-			ProductName: item.ProductName,
-			Description: item.Description,
-			Category:    item.Category,
-			Price:       item.Price,
-			Quantity:    item.Quantity,
-		})
-		totalAmount += item.Price * float64(item.Quantity)
+	bill, _, err := s.quoteCart(req.UserId, req.RestaurantId, items, "")
+	if err != nil {
+		return nil, err
 	}
 
 	return &orderCartPb.GetCartByRestaurantResponse{
-		Items:       cartItems,
-		TotalAmount: totalAmount,
+		Items:       cartItemsToPb(items),
+		TotalAmount: bill.GrandTotal.Major(),
 	}, nil
 }
 
-// GetAllCarts returns all cart items for a user, grouped by restaurant
+// GetAllCarts returns all cart items for a user, grouped by restaurant, with
+// the grand total of each cart's bill with the default delivery fee.
 func (s *OrderCartService) GetAllCarts(ctx context.Context, req *orderCartPb.GetAllCartsRequest) (*orderCartPb.GetAllCartsResponse, error) {
+	if err := auth.RequireUser(ctx, req.UserId); err != nil {
+		return nil, err
+	}
+
 	cartsByRestaurant, err := s.repo.GetAllUserCarts(req.UserId)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user carts: %w", err)
@@ -152,25 +205,15 @@ func (s *OrderCartService) GetAllCarts(ctx context.Context, req *orderCartPb.Get
 
 	var response []*orderCartPb.RestaurantCart
 	for restaurantID, items := range cartsByRestaurant {
-		var cartItems []*orderCartPb.CartItem
-		var totalAmount float64
-
-		for _, item := range items {
-			cartItems = append(cartItems, &orderCartPb.CartItem{
-				ProductId:   item.ProductID,
-				ProductName: item.ProductName,
-				Description: item.Description,
-				Category:    item.Category,
-				Price:       item.Price,
-				Quantity:    item.Quantity,
-			})
-			totalAmount += item.Price * float64(item.Quantity)
+		bill, _, err := s.quoteCart(req.UserId, restaurantID, items, "")
+		if err != nil {
+			return nil, err
 		}
 
 		response = append(response, &orderCartPb.RestaurantCart{
 			RestaurantId: restaurantID,
-			Items:        cartItems,
-			TotalAmount:  totalAmount,
+			Items:        cartItemsToPb(items),
+			TotalAmount:  bill.GrandTotal.Major(),
 		})
 	}
 
@@ -179,79 +222,175 @@ func (s *OrderCartService) GetAllCarts(ctx context.Context, req *orderCartPb.Get
 	}, nil
 }
 
-// IncrementProductQuantity increments the quantity of the product in the user's cart. If the product is not found in the cart, the method does nothing.
+// GetCartBill returns the itemized bill for the user's cart at a restaurant:
+// the item subtotal, taxes, packaging, the delivery fee for the given
+// delivery address and the grand total the order would be placed for.
 //
-// The method returns an error if the operation fails.
-func (s *OrderCartService) IncrementProductQuantity(ctx context.Context, req *orderCartPb.IncrementProductQuantityRequest) (*orderCartPb.IncrementProductQuantityResponse, error) {
+// The method returns an InvalidAddress error if the delivery address cannot be used.
+func (s *OrderCartService) GetCartBill(ctx context.Context, req *GetCartBillRequest) (*GetCartBillResponse, error) {
+	if err := auth.RequireUser(ctx, req.UserId); err != nil {
+		return nil, err
+	}
+
 	items, err := s.repo.GetCartItems(req.UserId, req.RestaurantId)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get cart items: %w", err)
 	}
 
-	for _, item := range items {
-		if item.ProductID == req.ProductId {
-			err := s.repo.UpdateCartItemQuantity(req.UserId, req.RestaurantId, req.ProductId, item.Quantity+1)
-			if err != nil {
-				return nil, fmt.Errorf("failed to increment quantity: %w", err)
-			}
-			break
+	// The delivery fee depends on the address; without one the default fee applies
+	var pincode string
+	if req.DeliveryAddressId != "" {
+		validateAddressResp, err := s.userClient.ValidateUserAddress(ctx, &userPb.ValidateUserAddressRequest{
+			UserId:    req.UserId,
+			AddressId: req.DeliveryAddressId,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to validate delivery address: %w", err)
+		}
+		if !validateAddressResp.IsValid {
+			return nil, apperr.InvalidAddress(req.DeliveryAddressId, validateAddressResp.Message)
+		}
+		pincode = validateAddressResp.Address.Pincode
+	}
+
+	bill, couponErr, err := s.quoteCart(req.UserId, req.RestaurantId, items, pincode)
+	if err != nil {
+		return nil, err
+	}
+
+	message := "Cart bill calculated successfully"
+	if couponErr != nil {
+		message = fmt.Sprintf("Cart bill calculated without coupon: %v", couponErr)
+	}
+	return &GetCartBillResponse{
+		Bill:    billToPb(pricing.CartLines(items), bill.Subtotal, bill.Charges(""), bill.GrandTotal),
+		Message: message,
+	}, nil
+}
+
+// quoteCart prices the items of a cart with its coupon for delivery to
+// pincode, or with the default delivery fee if pincode is empty. If the
+// cart's coupon no longer applies the cart is priced without it and the
+// reason is returned as couponErr.
+func (s *OrderCartService) quoteCart(userID, restaurantID string, items []models.CartItem, pincode string) (bill *pricing.Bill, couponErr error, err error) {
+	lines := pricing.CartLines(items)
+	subtotal, err := pricing.Total(lines)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to price cart: %w", err)
+	}
+
+	opts := pricing.Options{Pincode: pincode}
+	cartCoupon, err := s.repo.GetCartCoupon(userID, restaurantID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get cart coupon: %w", err)
+	}
+	if cartCoupon != nil {
+		discount, err := couponDiscount(s.repo, cartCoupon.CouponCode, userID, restaurantID, subtotal, false)
+		switch {
+		case err == nil:
+			opts.Discounts = append(opts.Discounts, discount)
+		case apperr.IsKind(err, apperr.KindFailedPrecondition), apperr.IsKind(err, apperr.KindNotFound):
+			couponErr = err
+		default:
+			return nil, nil, err
+		}
+	}
+
+	bill, err = s.pricer.Quote(lines, opts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to price cart: %w", err)
+	}
+	return bill, couponErr, nil
+}
+
+// IncrementProductQuantity increments the quantity of the product in the user's cart.
+// It applies to the product's line without options or instructions; UpdateCartLine
+// changes customized lines.
+//
+// The cart item is locked for the duration of the update. The method returns a NotFound error
+// if the product is not in the cart, or an error if the operation fails.
+func (s *OrderCartService) IncrementProductQuantity(ctx context.Context, req *orderCartPb.IncrementProductQuantityRequest) (*orderCartPb.IncrementProductQuantityResponse, error) {
+	if err := auth.RequireUser(ctx, req.UserId); err != nil {
+		return nil, err
+	}
+
+	err := s.repo.WithTx(ctx, func(repo repository.OrderCartRepository) error {
+		item, err := repo.LockCartItem(req.UserId, req.RestaurantId, req.ProductId, "")
+		if err != nil {
+			return err
 		}
+		if err := checkLineQuantity(item.Quantity + 1); err != nil {
+			return err
+		}
+		return repo.UpdateCartItemQuantity(req.UserId, req.RestaurantId, req.ProductId, "", item.Quantity+1)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to increment quantity: %w", err)
 	}
 
 	return &orderCartPb.IncrementProductQuantityResponse{
+		Success: true,
 		Message: "Product quantity incremented successfully",
 	}, nil
 }
 
-// DecrementProductQuantity decrements the quantity of the product in the user's cart. If the product is not found in the cart, the method does nothing.
+// DecrementProductQuantity decrements the quantity of the product in the user's cart, removing it when the quantity reaches zero.
+// Like IncrementProductQuantity it applies to the product's line without options or instructions.
 //
-// The method returns an error if the operation fails.
+// The cart item is locked for the duration of the update. The method returns a NotFound error
+// if the product is not in the cart, or an error if the operation fails.
 func (s *OrderCartService) DecrementProductQuantity(ctx context.Context, req *orderCartPb.DecrementProductQuantityRequest) (*orderCartPb.DecrementProductQuantityResponse, error) {
-	items, err := s.repo.GetCartItems(req.UserId, req.RestaurantId)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get cart items: %w", err)
+	if err := auth.RequireUser(ctx, req.UserId); err != nil {
+		return nil, err
 	}
 
-	itemFound := false
-	for _, item := range items {
-		if item.ProductID == req.ProductId {
-			itemFound = true
-			if item.Quantity > 1 {
-				err := s.repo.UpdateCartItemQuantity(req.UserId, req.RestaurantId, req.ProductId, item.Quantity-1)
-				if err != nil {
-					return nil, fmt.Errorf("failed to decrement quantity: %w", err)
-				}
-			} else {
-				err := s.repo.RemoveFromCart(req.UserId, req.RestaurantId, req.ProductId)
-				if err != nil {
-					return nil, fmt.Errorf("failed to remove item: %w", err)
-				}
-			}
-			break
+	err := s.repo.WithTx(ctx, func(repo repository.OrderCartRepository) error {
+		item, err := repo.LockCartItem(req.UserId, req.RestaurantId, req.ProductId, "")
+		if err != nil {
+			return err
 		}
-	}
-
-	if !itemFound {
-		return &orderCartPb.DecrementProductQuantityResponse{
-			Message: "Product not found in cart",
-		}, nil
+		if item.Quantity > 1 {
+			return repo.UpdateCartItemQuantity(req.UserId, req.RestaurantId, req.ProductId, "", item.Quantity-1)
+		}
+		return repo.RemoveCartLine(req.UserId, req.RestaurantId, req.ProductId, "")
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrement quantity: %w", err)
 	}
 
 	return &orderCartPb.DecrementProductQuantityResponse{
+		Success: true,
 		Message: "Product quantity decremented successfully",
 	}, nil
 }
 
-// RemoveProductFromCart removes a product from the user's cart.
+// checkLineQuantity rejects cart line quantities above the per-line limit.
+func checkLineQuantity(quantity int32) error {
+	if quantity > validation.MaxQuantityPerLine {
+		return apperr.InvalidArgument("cart line quantity too large", apperr.FieldViolation{
+			Field:       "quantity",
+			Description: fmt.Sprintf("a cart line may hold at most %d units", validation.MaxQuantityPerLine),
+		})
+	}
+	return nil
+}
+
+// RemoveProductFromCart removes a product from the user's cart, including
+// every customized line of it.
 //
 // The method returns an error if the operation fails.
 func (s *OrderCartService) RemoveProductFromCart(ctx context.Context, req *orderCartPb.RemoveProductFromCartRequest) (*orderCartPb.RemoveProductFromCartResponse, error) {
+	if err := auth.RequireUser(ctx, req.UserId); err != nil {
+		return nil, err
+	}
+
 	err := s.repo.RemoveFromCart(req.UserId, req.RestaurantId, req.ProductId)
 	if err != nil {
 		return nil, fmt.Errorf("failed to remove product from cart: %w", err)
 	}
 
 	return &orderCartPb.RemoveProductFromCartResponse{
+		Success: true,
 		Message: "Product removed from cart successfully",
 	}, nil
 }
@@ -260,12 +399,17 @@ func (s *OrderCartService) RemoveProductFromCart(ctx context.Context, req *order
 //
 // The method returns an error if the operation fails.
 func (s *OrderCartService) ClearCart(ctx context.Context, req *orderCartPb.ClearCartRequest) (*orderCartPb.ClearCartResponse, error) {
+	if err := auth.RequireUser(ctx, req.UserId); err != nil {
+		return nil, err
+	}
+
 	err := s.repo.ClearCart(req.UserId, req.RestaurantId)
 	if err != nil {
 		return nil, fmt.Errorf("failed to clear cart: %w", err)
 	}
 
 	return &orderCartPb.ClearCartResponse{
+		Success: true,
 		Message: "Cart cleared successfully",
 	}, nil
 }
@@ -278,22 +422,58 @@ func (s *OrderCartService) ClearCart(ctx context.Context, req *orderCartPb.Clear
 // This method performs the following steps:
 // 1. Retrieves the user's cart items.
 // 2. Filters the items by the provided restaurant ID and calculates the total cost.
-// 3. Creates a new order with the filtered items and a "PENDING" status.
-// 4. Removes the processed items from the user's cart.
+// 3. Creates a new order with a "PAYMENT_PENDING" status and a pending payment.
+// 4. Removes the processed items from the user's cart in the same transaction.
+// 5. Authorizes the payment with the payment provider.
+//
+// Once the payment is authorized the order is "RESERVING" and outbox
+// messages decrement the stock. Clients may instead send "COD" or "WALLET"
+// in a "payment-method" metadata entry: cash on delivery orders take no
+// payment and wallet orders hold the total in the user's wallet, failing with
+// INSUFFICIENT_WALLET_BALANCE if it is too low. Both start "RESERVING" at once. It becomes "PENDING" once the outbox
+// dispatcher has reserved the stock for every item, or "FAILED" if the
+// reservation cannot be completed. If the payment is declined or fails the
+// order is "FAILED" and a PAYMENT_DECLINED or PAYMENT_FAILED error is
+// returned.
 //
 // The method returns an error if any of the operations fail or if no items
 // match the specified restaurant ID.
+//
+// Clients may send an "idempotency-key" metadata entry; retries carrying the
+// same key for the same user return the original response instead of placing
+// another order.
+//
+// If a product's price changed since it was added to the cart the order fails
+// with a PRICE_CHANGED FailedPrecondition error listing the old and new
+// prices; RefreshCart updates the cart. Clients may instead send the total
+// they showed the user in an "expected-total" metadata entry, and the order
+// is placed at the latest prices only if it costs exactly that.
+//
+// Clients may book a future delivery slot by sending it as an RFC 3339
+// timestamp in a "scheduled-for" metadata entry. The order is then
+// "SCHEDULED" until the scheduler releases it to the restaurant a lead time
+// before the slot. Depending on the schedule policy its stock is reserved
+// right away or only when it is released.
 func (s *OrderCartService) PlaceOrderByRestID(ctx context.Context, req *orderCartPb.PlaceOrderByRestIDRequest) (*orderCartPb.PlaceOrderByRestIDResponse, error) {
-	restaurantClient, err := clients.NewRestaurantClient()
-	if err != nil {
-		return nil, fmt.Errorf("failed to create restaurant client: %w", err)
+	if err := auth.RequireUser(ctx, req.UserId); err != nil {
+		return nil, err
 	}
 
+	if key := metadataValue(ctx, idempotencyKeyHeader); key != "" {
+		return s.placeOrderIdempotent(ctx, req, key)
+	}
+	return s.placeOrder(ctx, req, nil)
+}
+
+// placeOrder places the order described by req. If record is set the
+// response is stored for its idempotency key in the transaction that saves
+// the order, so a retry can never place a duplicate.
+func (s *OrderCartService) placeOrder(ctx context.Context, req *orderCartPb.PlaceOrderByRestIDRequest, record *models.IdempotentRequest) (*orderCartPb.PlaceOrderByRestIDResponse, error) {
 	// Get restaurant details
 	restaurantReq := &restaurantPb.GetRestaurantByIDRequest{
 		RestaurantId: req.RestaurantId,
 	}
-	restaurantResp, err := restaurantClient.GetRestaurantByID(ctx, restaurantReq)
+	restaurantResp, err := s.restaurantClient.GetRestaurantByID(ctx, restaurantReq)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get restaurant details: %w", err)
 	}
@@ -302,12 +482,12 @@ func (s *OrderCartService) PlaceOrderByRestID(ctx context.Context, req *orderCar
 	banStatusReq := &restaurantPb.CheckRestaurantBanStatusRequest{
 		RestaurantId: req.RestaurantId,
 	}
-	banStatus, err := restaurantClient.CheckRestaurantBanStatus(ctx, banStatusReq)
+	banStatus, err := s.restaurantClient.CheckRestaurantBanStatus(ctx, banStatusReq)
 	if err != nil {
 		return nil, fmt.Errorf("failed to check restaurant status: %w", err)
 	}
 	if banStatus.IsBanned {
-		return nil, fmt.Errorf("restaurant is banned: %s", banStatus.Reason)
+		return nil, apperr.RestaurantBanned(req.RestaurantId, banStatus.Reason)
 	}
 
 	// Get cart items
@@ -317,88 +497,121 @@ func (s *OrderCartService) PlaceOrderByRestID(ctx context.Context, req *orderCar
 	}
 
 	if len(cartItems) == 0 {
-		return nil, fmt.Errorf("cart is empty for restaurant %s", req.RestaurantId)
+		return nil, apperr.FailedPrecondition("CART_EMPTY", fmt.Sprintf("cart is empty for restaurant %s", req.RestaurantId))
 	}
 
-	// Calculate total amount and create order items
-	var totalAmount float64
+	// Get latest product details for every cart item
+	products, lookupErrs := s.fetchProducts(ctx, req.RestaurantId, cartItems)
+
+	// Get the current price of every selected option
+	options, unavailable, err := s.currentOptions(cartItems)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create order items at the latest prices
 	var orderItems []models.OrderItem
+	ordered := make(map[string]int32, len(cartItems))
 
-	for _, item := range cartItems {
-		// Get latest product details
-		productReq := &restaurantPb.GetProductByIDRequest{
-			ProductId: item.ProductID,
-		}
-		productResp, err := restaurantClient.GetProductByID(ctx, productReq)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get product details for %s: %w", item.ProductID, err)
+	for i, item := range cartItems {
+		if lookupErrs[i] != nil {
+			return nil, lookupErrs[i]
 		}
+		product := products[i]
 
-		if productResp.Product == nil {
-			return nil, fmt.Errorf("product %s not found", item.ProductID)
+		if unavailable[i] {
+			return nil, apperr.FailedPrecondition("OPTION_UNAVAILABLE",
+				fmt.Sprintf("an option selected for %s is no longer available", item.ProductName))
 		}
 
-		// Check stock
-		if productResp.Product.Stock < item.Quantity {
-			return nil, fmt.Errorf("insufficient stock for product %s: available %d, required %d",
-				item.ProductName, productResp.Product.Stock, item.Quantity)
+		// Check stock, counting every line of the product
+		ordered[item.ProductID] += item.Quantity
+		if product.Stock < ordered[item.ProductID] {
+			return nil, apperr.InsufficientStock(item.ProductID, item.ProductName, product.Stock, ordered[item.ProductID])
 		}
 
 		// Create order item
 		orderItem := models.OrderItem{
-			ProductID:   item.ProductID,
-			ProductName: productResp.Product.Name,
-			Description: productResp.Product.Description,
-			Category:    productResp.Product.Category,
-			Price:       productResp.Product.Price,
-			Quantity:    item.Quantity,
+			ProductID:           item.ProductID,
+			ProductName:         product.Name,
+			Description:         product.Description,
+			Category:            product.Category,
+			Price:               money.FromMajor(product.Price, money.DefaultCurrency),
+			Quantity:            item.Quantity,
+			LineKey:             item.LineKey,
+			Options:             options[i],
+			SpecialInstructions: item.SpecialInstructions,
 		}
 		orderItems = append(orderItems, orderItem)
-		totalAmount += productResp.Product.Price * float64(item.Quantity)
+	}
 
-		// Decrease stock
-		decrementReq := &restaurantPb.DecrementProductStockByValueByValueRequest{
-			ProductId:    item.ProductID,
-			RestaurantId: req.RestaurantId,
-			Value:        item.Quantity,
-		}
-		_, err = restaurantClient.DecrementProductStockByValue(ctx, decrementReq)
-		if err != nil {
-			return nil, fmt.Errorf("failed to update stock for product %s: %w", item.ProductID, err)
-		}
+	// Charge the prices the cart showed, unless the client confirmed the
+	// total at the latest prices
+	expected, err := expectedTotal(ctx)
+	if err != nil {
+		return nil, err
+	}
+	changes := priceChanges(cartItems, orderItems)
+	if len(changes) > 0 && expected == nil {
+		return nil, apperr.PriceChanged(changes, nil, nil)
+	}
+
+	// Check the requested delivery slot, if any, and the payment method
+	scheduledFor, err := s.scheduledFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	paymentMethod, err := requestedPaymentMethod(ctx)
+	if err != nil {
+		return nil, err
 	}
 
 	// Create order
+	orderID := fmt.Sprintf("order_%s", uuid.New().String())
 	order := &models.Order{
-		OrderID:           fmt.Sprintf("order_%s", uuid.New().String()),
+		OrderID:           orderID,
 		UserID:            req.UserId,
 		RestaurantID:      req.RestaurantId,
 		RestaurantName:    restaurantResp.RestaurantName,
 		RestaurantPhone:   restaurantResp.PhoneNumber,
-		TotalAmount:       totalAmount,
-		OrderStatus:       "PENDING",
+		OrderStatus:       string(orderstate.PaymentPending),
 		CreatedAt:         time.Now(),
 		OrderItems:        orderItems,
 		DeliveryAddressID: req.DeliveryAddressId,
+		PaymentMethod:     paymentMethod,
+		ScheduledFor:      scheduledFor,
+	}
+	if scheduledFor != nil && s.schedule.DeferStock {
+		order.StockDeferred = true
 	}
 
-	// Get delivery address details and validate
-	userClient, err := clients.NewUserClient()
-	if err != nil {
-		return nil, fmt.Errorf("failed to create user client: %w", err)
+	// Orders paid online wait for their payment before reserving stock; the
+	// others reserve it right away unless it is deferred
+	var outbox []models.OutboxMessage
+	if paymentMethod != payments.MethodOnline {
+		if order.StockDeferred {
+			order.OrderStatus = string(orderstate.Scheduled)
+		} else {
+			order.OrderStatus = string(orderstate.Reserving)
+			outbox, err = stockReservation(order)
+			if err != nil {
+				return nil, err
+			}
+		}
 	}
 
+	// Get delivery address details and validate
 	validateAddressReq := &userPb.ValidateUserAddressRequest{
 		UserId:    req.UserId,
 		AddressId: req.DeliveryAddressId,
 	}
-	validateAddressResp, err := userClient.ValidateUserAddress(ctx, validateAddressReq)
+	validateAddressResp, err := s.userClient.ValidateUserAddress(ctx, validateAddressReq)
 	if err != nil {
 		return nil, fmt.Errorf("failed to validate delivery address: %w", err)
 	}
 
 	if !validateAddressResp.IsValid {
-		return nil, fmt.Errorf("invalid delivery address: %s", validateAddressResp.Message)
+		return nil, apperr.InvalidAddress(req.DeliveryAddressId, validateAddressResp.Message)
 	}
 
 	// Update order with address details
@@ -407,108 +620,205 @@ func (s *OrderCartService) PlaceOrderByRestID(ctx context.Context, req *orderCar
 	order.State = validateAddressResp.Address.State
 	order.Pincode = validateAddressResp.Address.Pincode
 
-	// Save order
-	err = s.repo.CreateOrder(order)
-	if err != nil {
-		// Attempt to rollback stock changes
-		for _, item := range orderItems {
-			incrementReq := &restaurantPb.IncremenentProductStockByValueRequest{
-				ProductId:    item.ProductID,
-				RestaurantId: req.RestaurantId,
-				Value:        item.Quantity,
+	// Save order and clear the cart in one transaction. The cart is locked and
+	// compared with what was priced so items added meanwhile are not lost.
+	err = s.repo.WithTx(ctx, func(repo repository.OrderCartRepository) error {
+		lockedItems, err := repo.LockCartItems(req.UserId, req.RestaurantId)
+		if err != nil {
+			return fmt.Errorf("failed to lock cart: %w", err)
+		}
+		if !sameCartItems(cartItems, lockedItems) {
+			return apperr.Conflict("cart changed while placing the order, please retry")
+		}
+
+		// Re-validate the cart's coupon against the order; it is locked so
+		// its usage limits hold until the redemption is recorded
+		opts := pricing.Options{Pincode: order.Pincode}
+		cartCoupon, err := repo.GetCartCoupon(req.UserId, req.RestaurantId)
+		if err != nil {
+			return fmt.Errorf("failed to get cart coupon: %w", err)
+		}
+		if cartCoupon != nil {
+			subtotal, err := pricing.OrderTotal(orderItems)
+			if err != nil {
+				return fmt.Errorf("failed to price order: %w", err)
 			}
-			_, rollbackErr := restaurantClient.IncremenentProductStockByValue(ctx, incrementReq)
-			if rollbackErr != nil {
-				// Log rollback error but return original error
-				log.Printf("Failed to rollback stock for product %s: %v", item.ProductID, rollbackErr)
+			discount, err := couponDiscount(repo, cartCoupon.CouponCode, req.UserId, req.RestaurantId, subtotal, true)
+			if err != nil {
+				return err
 			}
+			opts.Discounts = append(opts.Discounts, discount)
 		}
-		return nil, fmt.Errorf("failed to create order: %w", err)
-	}
 
-	// Convert order items to protobuf format
-	var orderItemsPb []*orderCartPb.OrderItem
-	for _, item := range order.OrderItems {
-		orderItemsPb = append(orderItemsPb, &orderCartPb.OrderItem{
-			ProductId:   item.ProductID,
-			ProductName: item.ProductName,
-			Description: item.Description,
-			Category:    item.Category,
-			Price:       item.Price,
-			Quantity:    item.Quantity,
-		})
-	}
+		// Price the order for the delivery address and freeze the bill onto it
+		bill, err := s.pricer.Quote(pricing.OrderLines(orderItems), opts)
+		if err != nil {
+			return fmt.Errorf("failed to price order: %w", err)
+		}
+		if expected != nil && bill.GrandTotal.Minor != expected.Minor {
+			return apperr.PriceChanged(changes, expected, &bill.GrandTotal)
+		}
+		order.Total = bill.GrandTotal
+		order.OrderCharges = bill.Charges(orderID)
+		bill.FreezeItems(order.OrderItems)
+
+		// Take the payment: online payments are authorized once the order is
+		// saved, wallet payments hold the funds now and COD takes none
+		switch paymentMethod {
+		case payments.MethodOnline:
+			order.Payment = &models.Payment{
+				PaymentID: fmt.Sprintf("pay_%s", uuid.New().String()),
+				OrderID:   orderID,
+				Provider:  s.paymentProvider.Name(),
+				Status:    payments.StatusPending,
+				Amount:    bill.GrandTotal,
+			}
+		case payments.MethodWallet:
+			if err := repo.HoldWalletFunds(req.UserId, orderID, bill.GrandTotal); err != nil {
+				return err
+			}
+			authorizedAt := time.Now()
+			order.Payment = &models.Payment{
+				PaymentID:    fmt.Sprintf("pay_%s", uuid.New().String()),
+				OrderID:      orderID,
+				Provider:     payments.WalletProviderName,
+				Status:       payments.StatusAuthorized,
+				Amount:       bill.GrandTotal,
+				AuthorizedAt: &authorizedAt,
+			}
+		}
 
-	// Convert order to protobuf format
-	orderPb := &orderCartPb.Order{
-		OrderId:      order.OrderID,
-		UserId:       order.UserID,
-		RestaurantId: order.RestaurantID,
-		Items:        orderItemsPb,
-		TotalAmount:  order.TotalAmount,
-		OrderStatus:  order.OrderStatus,
-		CreatedAt:    order.CreatedAt.Format(time.RFC3339),
-		DeliveryAddress: &orderCartPb.Address{
-			StreetName: order.StreetName,
-			Locality:   order.Locality,
-			State:      order.State,
-			Pincode:    order.Pincode,
-		},
-	}
+		// Copy the instructions left on the cart
+		instructions, err := repo.GetCartInstructions(req.UserId, req.RestaurantId)
+		if err != nil {
+			return fmt.Errorf("failed to get cart instructions: %w", err)
+		}
+		if instructions != nil {
+			order.DeliveryInstructions = instructions.DeliveryInstructions
+			order.KitchenNote = instructions.KitchenNote
+		}
 
-	// Clear cart
-	err = s.repo.ClearCart(req.UserId, req.RestaurantId)
+		if err := repo.CreateOrder(order, outbox); err != nil {
+			return fmt.Errorf("failed to create order: %w", err)
+		}
+		if cartCoupon != nil {
+			err := repo.RedeemCoupon(&models.CouponRedemption{
+				CouponCode: cartCoupon.CouponCode,
+				UserID:     req.UserId,
+				OrderID:    orderID,
+				Discount:   bill.Discount,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to redeem coupon: %w", err)
+			}
+			if err := repo.RemoveCartCoupon(req.UserId, req.RestaurantId); err != nil {
+				return fmt.Errorf("failed to remove cart coupon: %w", err)
+			}
+		}
+		if instructions != nil {
+			if err := repo.RemoveCartInstructions(req.UserId, req.RestaurantId); err != nil {
+				return fmt.Errorf("failed to remove cart instructions: %w", err)
+			}
+		}
+		if err := repo.ClearCart(req.UserId, req.RestaurantId); err != nil {
+			return fmt.Errorf("failed to clear cart: %w", err)
+		}
+		if record != nil {
+			return completeIdempotentRequest(repo, record, placeOrderResponse(order))
+		}
+		return nil
+	})
 	if err != nil {
-		log.Printf("Failed to clear cart for user %s: %v", req.UserId, err)
-		// Continue with order placement even if cart clearing fails
+		return nil, err
+	}
+
+	// Stock is reserved by the outbox dispatcher once the payment is
+	// authorized. Retries then replay the authorized order.
+	if paymentMethod == payments.MethodOnline {
+		if err := s.authorizePayment(ctx, order); err != nil {
+			return nil, err
+		}
+		if record != nil {
+			if err := completeIdempotentRequest(s.repo, record, placeOrderResponse(order)); err != nil {
+				log.Printf("Failed to update response for idempotency key %s of user %s: %v", record.IdempotencyKey, record.UserID, err)
+			}
+		}
 	}
 
+	return placeOrderResponse(order), nil
+}
+
+// placeOrderResponse returns the response to placing order.
+func placeOrderResponse(order *models.Order) *orderCartPb.PlaceOrderByRestIDResponse {
+	message := "Order placed successfully, reserving stock"
+	switch {
+	case order.OrderStatus == string(orderstate.PaymentPending):
+		message = "Order placed, waiting for its payment to be confirmed"
+	case order.ScheduledFor != nil:
+		message = fmt.Sprintf("Order scheduled for %s", order.ScheduledFor.Format(time.RFC3339))
+	}
 	return &orderCartPb.PlaceOrderByRestIDResponse{
 		Success: true,
-		Order:   orderPb,
+		Order:   orderToPb(order),
 		OrderId: order.OrderID,
-		Message: "Order placed successfully",
-	}, nil
+		Message: message,
+	}
+}
+
+// stockReservation builds the outbox messages that decrement the stock of
+// every item of order.
+func stockReservation(order *models.Order) ([]models.OutboxMessage, error) {
+	var outbox []models.OutboxMessage
+	for i, item := range order.OrderItems {
+		msg, err := repository.NewStockOutboxMessage(repository.OutboxDecrementStock, repository.StockPayload{
+			OrderID:      order.OrderID,
+			RestaurantID: order.RestaurantID,
+			ProductID:    item.ProductID,
+			Quantity:     item.Quantity,
+			Key:          repository.StockLineKey(order.OrderID, i),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to build stock reservation: %w", err)
+		}
+		outbox = append(outbox, msg)
+	}
+	return outbox, nil
+}
+
+// sameCartItems reports whether two reads of a cart returned the same lines
+// with the same quantities.
+func sameCartItems(a, b []models.CartItem) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	quantities := make(map[uint]int32, len(a))
+	for _, item := range a {
+		quantities[item.ID] = item.Quantity
+	}
+	for _, item := range b {
+		if quantity, ok := quantities[item.ID]; !ok || quantity != item.Quantity {
+			return false
+		}
+	}
+	return true
 }
 
 // GetOrderDetailsAll retrieves all orders for a specified user ID.
 //
 // The method returns an error if the operation fails.
 func (s *OrderCartService) GetOrderDetailsAll(ctx context.Context, req *orderCartPb.GetOrderDetailsAllRequest) (*orderCartPb.GetOrderDetailsAllResponse, error) {
+	if err := auth.RequireUser(ctx, req.UserId); err != nil {
+		return nil, err
+	}
+
 	orders, err := s.repo.GetAllOrders(req.UserId)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get orders: %w", err)
 	}
 
 	var pbOrders []*orderCartPb.Order
-	for _, order := range orders {
-		var orderItems []*orderCartPb.OrderItem
-		for _, item := range order.OrderItems {
-			orderItems = append(orderItems, &orderCartPb.OrderItem{
-				ProductId:   item.ProductID,
-				ProductName: item.ProductName,
-				Description: item.Description,
-				Category:    item.Category,
-				Price:       item.Price,
-				Quantity:    item.Quantity,
-			})
-		}
-
-		pbOrders = append(pbOrders, &orderCartPb.Order{
-			OrderId:      order.OrderID,
-			UserId:       order.UserID,
-			RestaurantId: order.RestaurantID,
-			Items:        orderItems,
-			TotalAmount:  order.TotalAmount,
-			OrderStatus:  order.OrderStatus,
-			CreatedAt:    order.CreatedAt.Format(time.RFC3339),
-			DeliveryAddress: &orderCartPb.Address{
-				StreetName: order.StreetName,
-				Locality:   order.Locality,
-				State:      order.State,
-				Pincode:    order.Pincode,
-			},
-		})
+	for i := range orders {
+		pbOrders = append(pbOrders, orderToPb(&orders[i]))
 	}
 
 	return &orderCartPb.GetOrderDetailsAllResponse{
@@ -526,80 +836,80 @@ func (s *OrderCartService) GetOrderDetailsByID(ctx context.Context, req *orderCa
 		return nil, fmt.Errorf("failed to get order: %w", err)
 	}
 
-	var orderItems []*orderCartPb.OrderItem
-	for _, item := range order.OrderItems {
-		orderItems = append(orderItems, &orderCartPb.OrderItem{
-			ProductId:   item.ProductID,
-			ProductName: item.ProductName,
-			Description: item.Description,
-			Category:    item.Category,
-			Price:       item.Price,
-			Quantity:    item.Quantity,
-		})
-	}
-
-	pbOrder := &orderCartPb.Order{
-		OrderId:      order.OrderID,
-		UserId:       order.UserID,
-		RestaurantId: order.RestaurantID,
-		Items:        orderItems,
-		TotalAmount:  order.TotalAmount,
-		OrderStatus:  order.OrderStatus,
-		CreatedAt:    order.CreatedAt.Format(time.RFC3339),
-		DeliveryAddress: &orderCartPb.Address{
-			StreetName: order.StreetName,
-			Locality:   order.Locality,
-			State:      order.State,
-			Pincode:    order.Pincode,
-		},
+	if err := auth.RequireOrderParty(ctx, order.UserID, order.RestaurantID); err != nil {
+		return nil, err
 	}
 
 	return &orderCartPb.GetOrderDetailsByIDResponse{
-		Order:   pbOrder,
+		Order:   orderToPb(order),
 		Message: "Order details retrieved successfully",
 	}, nil
 }
 
-// CancelOrder cancels an order by ID if the user is authorized and the order is in the "PENDING" status.
+// GetOrderBill returns the bill an order was placed with.
 //
-// The method returns an error if the operation fails or if the order is not found, or if the user is not authorized to cancel the order,
-// or if the order is not in the "PENDING" status.
-func (s *OrderCartService) CancelOrder(ctx context.Context, req *orderCartPb.CancelOrderRequest) (*orderCartPb.CancelOrderResponse, error) {
+// The method returns an error if the operation fails or if the order is not found.
+func (s *OrderCartService) GetOrderBill(ctx context.Context, req *GetOrderBillRequest) (*GetOrderBillResponse, error) {
 	order, err := s.repo.GetOrderByID(req.OrderId)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get order: %w", err)
 	}
 
-	if order.UserID != req.UserId {
-		return &orderCartPb.CancelOrderResponse{
-			Success: false,
-			Message: "Unauthorized to cancel this order",
-		}, nil
+	if err := auth.RequireOrderParty(ctx, order.UserID, order.RestaurantID); err != nil {
+		return nil, err
+	}
+
+	subtotal, err := pricing.OrderTotal(order.OrderItems)
+	if err != nil {
+		return nil, fmt.Errorf("failed to price order: %w", err)
 	}
 
-	if order.OrderStatus != "PENDING" {
-		return &orderCartPb.CancelOrderResponse{
-			Success: false,
-			Message: "Order cannot be cancelled in current status",
-		}, nil
+	return &GetOrderBillResponse{
+		OrderId: order.OrderID,
+		Bill:    billToPb(pricing.OrderLines(order.OrderItems), subtotal, order.OrderCharges, order.Total),
+		Message: "Order bill retrieved successfully",
+	}, nil
+}
+
+// CancelOrder cancels an order by ID if the user is authorized and the order lifecycle allows a user cancellation.
+//
+// The method returns an error if the operation fails or if the order is not found, or if the user is not authorized to cancel the order.
+// A FailedPrecondition error is returned if the order can no longer be cancelled by the user.
+func (s *OrderCartService) CancelOrder(ctx context.Context, req *orderCartPb.CancelOrderRequest) (*orderCartPb.CancelOrderResponse, error) {
+	if err := auth.RequireUser(ctx, req.UserId); err != nil {
+		return nil, err
 	}
 
-	err = s.repo.UpdateOrderStatus(req.OrderId, "CANCELLED")
+	order, err := s.repo.GetOrderByID(req.OrderId)
 	if err != nil {
-		return nil, fmt.Errorf("failed to cancel order: %w", err)
+		return nil, fmt.Errorf("failed to get order: %w", err)
+	}
+
+	if order.UserID != req.UserId {
+		return nil, apperr.Unauthorized("unauthorized to cancel this order")
+	}
+
+	if err := s.transitionOrder(ctx, order, orderstate.ActorUser, req.UserId, string(orderstate.Cancelled), req.Reason); err != nil {
+		return nil, err
 	}
 
 	return &orderCartPb.CancelOrderResponse{
-		Success: true,
-		Message: "Order cancelled successfully",
+		Success:      true,
+		Message:      "Order cancelled successfully",
+		CancelReason: req.Reason,
 	}, nil
 }
 
 // UpdateOrderStatus updates the status of an order.
 //
-// The method validates that the order exists and belongs to the specified restaurant
-// before updating its status. Returns an error if the operation fails.
+// The method validates that the order exists and belongs to the specified restaurant,
+// and that the restaurant is allowed to move the order to the requested status.
+// Unknown statuses are rejected with InvalidArgument and illegal moves with FailedPrecondition.
 func (s *OrderCartService) UpdateOrderStatus(ctx context.Context, req *orderCartPb.UpdateOrderStatusRequest) (*orderCartPb.UpdateOrderStatusResponse, error) {
+	if err := auth.RequireRestaurant(ctx, req.RestaurantId); err != nil {
+		return nil, err
+	}
+
 	// Get the order to validate ownership
 	order, err := s.repo.GetOrderByID(req.OrderId)
 	if err != nil {
@@ -608,95 +918,165 @@ func (s *OrderCartService) UpdateOrderStatus(ctx context.Context, req *orderCart
 
 	// Validate restaurant ownership
 	if order.RestaurantID != req.RestaurantId {
-		return &orderCartPb.UpdateOrderStatusResponse{
-			Success: false,
-			Message: "Unauthorized: Order does not belong to this restaurant",
-		}, nil
+		return nil, apperr.Unauthorized("order does not belong to this restaurant")
 	}
 
 	// Update order status
-	err = s.repo.UpdateOrderStatus(req.OrderId, req.NewStatus)
-	if err != nil {
-		return nil, fmt.Errorf("failed to update order status: %w", err)
+	if err := s.transitionOrder(ctx, order, orderstate.ActorRestaurant, req.RestaurantId, req.NewStatus, req.StatusNote); err != nil {
+		return nil, err
 	}
 
 	return &orderCartPb.UpdateOrderStatusResponse{
-		Success: true,
-		Message: fmt.Sprintf("Order status updated to %s successfully", req.NewStatus),
+		Success:       true,
+		Message:       fmt.Sprintf("Order status updated to %s successfully", order.OrderStatus),
+		CurrentStatus: order.OrderStatus,
 	}, nil
 }
 
+// transitionOrder validates and persists a status change for order on behalf
+// of actor, recording it in the order's timeline. On success order.OrderStatus
+// holds the new status.
+func (s *OrderCartService) transitionOrder(ctx context.Context, order *models.Order, actor orderstate.Actor, actorID, newStatus, reason string) error {
+	next, err := checkTransition(actor, order.OrderStatus, newStatus)
+	if err != nil {
+		return err
+	}
+
+	event := &models.OrderStatusEvent{
+		OrderID:    order.OrderID,
+		FromStatus: order.OrderStatus,
+		ToStatus:   string(next),
+		ActorType:  string(actor),
+		ActorID:    actorID,
+		Reason:     reason,
+	}
+	if next == orderstate.Cancelled {
+		err = s.repo.UpdateOrderCancellation(event)
+	} else {
+		err = s.repo.UpdateOrderStatus(event)
+	}
+	if err != nil {
+		return statusUpdateError(order.OrderID, err)
+	}
+
+	order.OrderStatus = string(next)
+	if next == orderstate.Cancelled {
+		order.CancelReason = reason
+	}
+	return nil
+}
+
+// checkTransition reports whether actor may move an order from one status to
+// another, as an InvalidArgument error for unknown statuses or an
+// INVALID_STATUS_TRANSITION FailedPrecondition error for illegal moves.
+func checkTransition(actor orderstate.Actor, from, to string) (orderstate.Status, error) {
+	next, err := orderstate.Transition(actor, from, to)
+	if err != nil {
+		var transitionErr *orderstate.TransitionError
+		if errors.As(err, &transitionErr) {
+			return "", apperr.FailedPrecondition("INVALID_STATUS_TRANSITION", err.Error())
+		}
+		return "", apperr.InvalidArgument(err.Error(), apperr.FieldViolation{Field: "newStatus", Description: err.Error()})
+	}
+	return next, nil
+}
+
+// statusUpdateError wraps an error from persisting a status change of an
+// order, reporting concurrent changes as a Conflict.
+func statusUpdateError(orderID string, err error) error {
+	if errors.Is(err, repository.ErrOrderStatusConflict) {
+		return apperr.Conflict(fmt.Sprintf("order %s was modified concurrently, please retry", orderID))
+	}
+	return fmt.Errorf("failed to update order status: %w", err)
+}
+
 // OrderCart Service - Simple Order Confirmation
 func (s *OrderCartService) ConfirmOrder(ctx context.Context, req *orderCartPb.ConfirmOrderRequest) (*orderCartPb.ConfirmOrderResponse, error) {
+	if err := auth.RequireRestaurant(ctx, req.RestaurantId); err != nil {
+		return nil, err
+	}
+
 	// Update the order status to CONFIRMED
 	updateResp, err := s.UpdateOrderStatus(ctx, &orderCartPb.UpdateOrderStatusRequest{
 		OrderId:      req.OrderId,
 		RestaurantId: req.RestaurantId,
-		NewStatus:    "CONFIRMED",
+		NewStatus:    string(orderstate.Confirmed),
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to confirm order: %w", err)
-	}
-
-	if !updateResp.Success {
-		return &orderCartPb.ConfirmOrderResponse{
-			Success:     false,
-			Message:     updateResp.Message,
-			OrderStatus: "PENDING",
-		}, nil
+		return nil, err
 	}
 
 	return &orderCartPb.ConfirmOrderResponse{
 		Success:     true,
 		Message:     "Order confirmed successfully",
-		OrderStatus: "CONFIRMED",
+		OrderStatus: updateResp.CurrentStatus,
 	}, nil
 }
 
 // GetRestaurantOrders retrieves all orders for a specified restaurant ID.
+// The shared Order message has no fields for delivery instructions, kitchen
+// notes or item options, and the shared proto cannot change from this
+// service, so kitchen clients must call GetRestaurantKitchenOrders to see them.
+//
+// TODO: return the instructions here once the shared OrderCart proto adds
+// them to Order and OrderItem, and move kitchen clients back to this method.
 //
 // The method returns an error if the operation fails.
 func (s *OrderCartService) GetRestaurantOrders(ctx context.Context, req *orderCartPb.GetRestaurantOrdersRequest) (*orderCartPb.GetRestaurantOrdersResponse, error) {
+	if err := auth.RequireRestaurant(ctx, req.RestaurantId); err != nil {
+		return nil, err
+	}
+
 	orders, err := s.repo.GetRestaurantOrders(req.RestaurantId, req.Status)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get restaurant orders: %w", err)
 	}
 
 	var pbOrders []*orderCartPb.Order
-	for _, order := range orders {
-		var orderItems []*orderCartPb.OrderItem
-		for _, item := range order.OrderItems {
-			orderItems = append(orderItems, &orderCartPb.OrderItem{
-				ProductId:   item.ProductID,
-				ProductName: item.ProductName,
-				Description: item.Description,
-				Category:    item.Category,
-				Price:       item.Price,
-				Quantity:    item.Quantity,
-			})
-		}
-
-		pbOrders = append(pbOrders, &orderCartPb.Order{
-			OrderId:      order.OrderID,
-			UserId:       order.UserID,
-			RestaurantId: order.RestaurantID,
-			Items:        orderItems,
-			TotalAmount:  order.TotalAmount,
-			OrderStatus:  order.OrderStatus,
-			CreatedAt:    order.CreatedAt.Format(time.RFC3339),
-			DeliveryAddress: &orderCartPb.Address{
-				StreetName: order.StreetName,
-				Locality:   order.Locality,
-				State:      order.State,
-				Pincode:    order.Pincode,
-			},
-		})
+	for i := range orders {
+		pbOrders = append(pbOrders, orderToPb(&orders[i]))
 	}
 
-	fmt.Println(pbOrders, "pbOrders")
-
 	return &orderCartPb.GetRestaurantOrdersResponse{
 		Orders:  pbOrders,
 		Message: "Orders retrieved successfully",
 	}, nil
 }
+
+// GetOrderTimeline returns the status history of an order, oldest first.
+//
+// The method returns an error if the order is not found or the history cannot be read.
+func (s *OrderCartService) GetOrderTimeline(ctx context.Context, req *GetOrderTimelineRequest) (*GetOrderTimelineResponse, error) {
+	order, err := s.repo.GetOrderByID(req.OrderId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order: %w", err)
+	}
+
+	if err := auth.RequireOrderParty(ctx, order.UserID, order.RestaurantID); err != nil {
+		return nil, err
+	}
+
+	events, err := s.repo.GetOrderStatusEvents(order.OrderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order timeline: %w", err)
+	}
+
+	var timeline []*OrderStatusEvent
+	for _, event := range events {
+		timeline = append(timeline, &OrderStatusEvent{
+			FromStatus: event.FromStatus,
+			ToStatus:   event.ToStatus,
+			ActorType:  event.ActorType,
+			ActorId:    event.ActorID,
+			Reason:     event.Reason,
+			CreatedAt:  event.CreatedAt.Format(time.RFC3339),
+		})
+	}
+
+	return &GetOrderTimelineResponse{
+		OrderId:       order.OrderID,
+		CurrentStatus: order.OrderStatus,
+		Events:        timeline,
+		Message:       "Order timeline retrieved successfully",
+	}, nil
+}
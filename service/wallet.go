@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/auth"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/models"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/money"
+)
+
+const (
+	defaultWalletTransactionsLimit = 50
+	maxWalletTransactionsLimit     = 200
+	maxWalletDescriptionLength     = 255
+)
+
+// GetWalletBalance returns the balance of the user's wallet and how much of
+// it is held for orders that have not been confirmed yet.
+func (s *OrderCartService) GetWalletBalance(ctx context.Context, req *GetWalletBalanceRequest) (*GetWalletBalanceResponse, error) {
+	if err := auth.RequireUser(ctx, req.UserId); err != nil {
+		return nil, err
+	}
+
+	wallet, err := s.repo.GetWallet(req.UserId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get wallet: %w", err)
+	}
+
+	return &GetWalletBalanceResponse{
+		Wallet:  walletToPb(wallet),
+		Message: "Wallet balance retrieved successfully",
+	}, nil
+}
+
+// GetWalletTransactions returns a page of the user's wallet ledger, newest
+// first.
+func (s *OrderCartService) GetWalletTransactions(ctx context.Context, req *GetWalletTransactionsRequest) (*GetWalletTransactionsResponse, error) {
+	if err := auth.RequireUser(ctx, req.UserId); err != nil {
+		return nil, err
+	}
+
+	limit := int(req.Limit)
+	if limit == 0 {
+		limit = defaultWalletTransactionsLimit
+	}
+	entries, err := s.repo.GetWalletTransactions(req.UserId, limit, int(req.Offset))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get wallet transactions: %w", err)
+	}
+
+	var transactions []*WalletTransaction
+	for _, entry := range entries {
+		transactions = append(transactions, &WalletTransaction{
+			Type:         entry.Type,
+			Amount:       entry.Amount.Major(),
+			Currency:     entry.Amount.Currency,
+			OrderId:      entry.OrderID,
+			Description:  entry.Description,
+			BalanceAfter: entry.BalanceAfter.Major(),
+			HeldAfter:    entry.HeldAfter.Major(),
+			CreatedAt:    entry.CreatedAt.Format(time.RFC3339),
+		})
+	}
+
+	return &GetWalletTransactionsResponse{
+		Transactions: transactions,
+		Message:      "Wallet transactions retrieved successfully",
+	}, nil
+}
+
+// CreditWallet adds money to a user's wallet, e.g. a top-up or a goodwill
+// credit. It is only available to admins.
+func (s *OrderCartService) CreditWallet(ctx context.Context, req *CreditWalletRequest) (*CreditWalletResponse, error) {
+	if err := auth.RequireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	amount := money.FromMajor(req.Amount, money.DefaultCurrency)
+	wallet, err := s.repo.CreditWallet(req.UserId, amount, req.Description)
+	if err != nil {
+		return nil, fmt.Errorf("failed to credit wallet: %w", err)
+	}
+
+	return &CreditWalletResponse{
+		Wallet:  walletToPb(wallet),
+		Message: fmt.Sprintf("Wallet credited with %s", amount),
+	}, nil
+}
+
+func walletToPb(wallet *models.Wallet) *Wallet {
+	return &Wallet{
+		UserId:    wallet.UserID,
+		Balance:   wallet.Balance.Major(),
+		Held:      wallet.Held.Major(),
+		Available: money.New(wallet.Balance.Minor-wallet.Held.Minor, wallet.Balance.Currency).Major(),
+		Currency:  wallet.Balance.Currency,
+	}
+}
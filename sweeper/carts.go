@@ -0,0 +1,100 @@
+package sweeper
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/repository"
+)
+
+const defaultBatchSize = 100
+
+// CartSweeper removes carts that have not been touched for longer than the
+// cart TTL, archiving their items first if configured to, and purges cart
+// items that were removed from their cart more than a TTL ago.
+type CartSweeper struct {
+	repo      repository.OrderCartRepository
+	ttl       time.Duration
+	interval  time.Duration
+	archive   bool
+	batchSize int
+}
+
+func NewCartSweeper(repo repository.OrderCartRepository, ttl, interval time.Duration, archive bool) *CartSweeper {
+	return &CartSweeper{
+		repo:      repo,
+		ttl:       ttl,
+		interval:  interval,
+		archive:   archive,
+		batchSize: defaultBatchSize,
+	}
+}
+
+// Run sweeps stale carts every interval until ctx is cancelled.
+func (s *CartSweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Sweep(ctx); err != nil {
+			log.Printf("Cart sweep failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep removes every cart that is stale now, a batch at a time, stopping
+// early if ctx is cancelled.
+func (s *CartSweeper) Sweep(ctx context.Context) error {
+	cutoff := time.Now().Add(-s.ttl)
+	var carts, items int64
+
+	for ctx.Err() == nil {
+		keys, err := s.repo.FindStaleCarts(cutoff, s.batchSize)
+		if err != nil {
+			return fmt.Errorf("failed to find stale carts: %w", err)
+		}
+
+		var removed int64
+		for _, key := range keys {
+			n, err := s.repo.SweepCart(key, cutoff, s.archive)
+			if err != nil {
+				return fmt.Errorf("failed to sweep cart of user %s at restaurant %s: %w", key.UserID, key.RestaurantID, err)
+			}
+			if n > 0 {
+				carts++
+				removed += n
+			}
+		}
+		items += removed
+
+		// A batch that removed nothing was entirely touched since it was
+		// found; stop rather than find the same carts again
+		if len(keys) < s.batchSize || removed == 0 {
+			break
+		}
+	}
+
+	for ctx.Err() == nil {
+		n, err := s.repo.PurgeDeletedCartItems(cutoff, s.batchSize)
+		if err != nil {
+			return fmt.Errorf("failed to purge deleted cart items: %w", err)
+		}
+		items += n
+		if n < int64(s.batchSize) {
+			break
+		}
+	}
+
+	if items > 0 {
+		log.Printf("Cart sweep removed %d stale carts and %d cart items", carts, items)
+	}
+	return nil
+}
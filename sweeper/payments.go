@@ -0,0 +1,97 @@
+package sweeper
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/repository"
+)
+
+// expiredPaymentReason is recorded on payments whose authorization never
+// completed.
+const expiredPaymentReason = "authorization not completed in time"
+
+// PaymentSweeper fails orders whose payment is still waiting for
+// authorization long after they were placed, for instance because the
+// replica authorizing it stopped. Their items go back into the user's cart.
+type PaymentSweeper struct {
+	repo      repository.OrderCartRepository
+	timeout   time.Duration
+	interval  time.Duration
+	batchSize int
+}
+
+// NewPaymentSweeper returns a PaymentSweeper that fails orders whose payment
+// has been pending for longer than timeout, checking every interval.
+func NewPaymentSweeper(repo repository.OrderCartRepository, timeout, interval time.Duration) *PaymentSweeper {
+	return &PaymentSweeper{
+		repo:      repo,
+		timeout:   timeout,
+		interval:  interval,
+		batchSize: defaultBatchSize,
+	}
+}
+
+// Run sweeps stale pending payments every interval until ctx is cancelled.
+func (s *PaymentSweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Sweep(ctx); err != nil {
+			log.Printf("Pending payment sweep failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep fails every order whose payment is pending for too long now, a batch
+// at a time, stopping early if ctx is cancelled. Orders held by another
+// replica are skipped and picked up on a later run if still pending. An order
+// that fails to be expired is skipped too, so that it does not hold up the
+// others, and tried again on the next run.
+func (s *PaymentSweeper) Sweep(ctx context.Context) error {
+	cutoff := time.Now().Add(-s.timeout)
+	var expired int
+	var failed []string
+
+	for ctx.Err() == nil {
+		orderIDs, err := s.repo.FindStalePendingPayments(cutoff, failed, s.batchSize)
+		if err != nil {
+			return fmt.Errorf("failed to find stale pending payments: %w", err)
+		}
+
+		var batch, batchFailed int
+		for _, orderID := range orderIDs {
+			ok, err := s.repo.ExpirePendingPayment(orderID, expiredPaymentReason)
+			if err != nil {
+				log.Printf("Failed to expire pending payment of order %s: %v", orderID, err)
+				failed = append(failed, orderID)
+				batchFailed++
+				continue
+			}
+			if ok {
+				batch++
+			}
+		}
+		expired += batch
+
+		// A batch that expired nothing and had no failures to leave out is
+		// held by other replicas; finding it again would only spin
+		if len(orderIDs) < s.batchSize || (batch == 0 && batchFailed == 0) {
+			break
+		}
+	}
+
+	if expired > 0 || len(failed) > 0 {
+		log.Printf("Failed %d orders whose payment was not authorized in time, %d could not be expired", expired, len(failed))
+	}
+	return nil
+}
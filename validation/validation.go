@@ -0,0 +1,270 @@
+package validation
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"google.golang.org/grpc"
+
+	orderCartPb "github.com/liju-github/CentralisedFoodbuddyMicroserviceProto/OrderCart"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/apperr"
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/orderstate"
+)
+
+const (
+	// MaxQuantityPerLine is the largest quantity a single cart line may hold.
+	MaxQuantityPerLine = 50
+	// MaxCartLines is the largest number of distinct lines in one restaurant cart.
+	MaxCartLines = 30
+	// MaxOptionsPerLine is the largest number of options selected on one cart line.
+	MaxOptionsPerLine = 10
+	// MaxInstructionsLength is the longest special instruction a cart line may carry.
+	MaxInstructionsLength = 255
+	// MaxOrderNoteLength is the longest delivery instruction or kitchen note an order may carry.
+	MaxOrderNoteLength = 500
+
+	maxIDLength         = 255
+	maxNoteLength       = 255
+	maxCouponCodeLength = 50
+)
+
+var (
+	idPattern      = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	orderIDPattern = regexp.MustCompile(`^order_[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+)
+
+// Validator is implemented by request types that validate themselves.
+type Validator interface {
+	Validate() error
+}
+
+// UnaryServerInterceptor rejects requests that fail Validate with an
+// InvalidArgument error listing every invalid field.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := Validate(req); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// Validate checks the fields of an OrderCart request. Requests of other types
+// are validated through Validator if they implement it.
+func Validate(req interface{}) error {
+	var v Violations
+
+	switch r := req.(type) {
+	case *orderCartPb.AddProductToCartRequest:
+		v.RequireID("userId", r.UserId)
+		v.RequireID("productId", r.ProductId)
+		v.Quantity("quantity", r.Quantity)
+	case *orderCartPb.GetCartItemsRequest:
+		v.RequireID("userId", r.UserId)
+		v.RequireID("restaurantId", r.RestaurantId)
+	case *orderCartPb.GetCartByRestaurantRequest:
+		v.RequireID("userId", r.UserId)
+		v.RequireID("restaurantId", r.RestaurantId)
+	case *orderCartPb.GetAllCartsRequest:
+		v.RequireID("userId", r.UserId)
+	case *orderCartPb.IncrementProductQuantityRequest:
+		v.RequireID("userId", r.UserId)
+		v.RequireID("productId", r.ProductId)
+		v.RequireID("restaurantId", r.RestaurantId)
+	case *orderCartPb.DecrementProductQuantityRequest:
+		v.RequireID("userId", r.UserId)
+		v.RequireID("productId", r.ProductId)
+		v.RequireID("restaurantId", r.RestaurantId)
+	case *orderCartPb.RemoveProductFromCartRequest:
+		v.RequireID("userId", r.UserId)
+		v.RequireID("productId", r.ProductId)
+		v.RequireID("restaurantId", r.RestaurantId)
+	case *orderCartPb.ClearCartRequest:
+		v.RequireID("userId", r.UserId)
+		v.RequireID("restaurantId", r.RestaurantId)
+	case *orderCartPb.ValidateCartItemsRequest:
+		v.RequireID("userId", r.UserId)
+		v.RequireID("restaurantId", r.RestaurantId)
+	case *orderCartPb.PlaceOrderByRestIDRequest:
+		v.RequireID("userId", r.UserId)
+		v.RequireID("restaurantId", r.RestaurantId)
+		v.RequireID("deliveryAddressId", r.DeliveryAddressId)
+	case *orderCartPb.GetOrderDetailsAllRequest:
+		v.RequireID("userId", r.UserId)
+		v.OptionalStatus("status", r.Status)
+		v.DateRange("startDate", r.StartDate, "endDate", r.EndDate)
+	case *orderCartPb.GetOrderDetailsByIDRequest:
+		v.RequireOrderID("orderId", r.OrderId)
+		v.OptionalID("userId", r.UserId)
+	case *orderCartPb.CancelOrderRequest:
+		v.RequireOrderID("orderId", r.OrderId)
+		v.RequireID("userId", r.UserId)
+		v.MaxLength("reason", r.Reason, maxNoteLength)
+	case *orderCartPb.UpdateOrderStatusRequest:
+		v.RequireOrderID("orderId", r.OrderId)
+		v.RequireID("restaurantId", r.RestaurantId)
+		v.RequireStatus("newStatus", r.NewStatus)
+		v.MaxLength("statusNote", r.StatusNote, maxNoteLength)
+	case *orderCartPb.GetRestaurantOrdersRequest:
+		v.RequireID("restaurantId", r.RestaurantId)
+		v.OptionalStatus("status", r.Status)
+		v.DateRange("startDate", r.StartDate, "endDate", r.EndDate)
+	case *orderCartPb.ConfirmOrderRequest:
+		v.RequireOrderID("orderId", r.OrderId)
+		v.RequireID("restaurantId", r.RestaurantId)
+	case Validator:
+		return r.Validate()
+	}
+
+	return v.Err()
+}
+
+// Violations collects the invalid fields of a request.
+type Violations []apperr.FieldViolation
+
+// Add records that field is invalid.
+func (v *Violations) Add(field, description string) {
+	*v = append(*v, apperr.FieldViolation{Field: field, Description: description})
+}
+
+// Err returns an InvalidArgument error listing the violations, or nil if
+// there are none.
+func (v Violations) Err() error {
+	if len(v) == 0 {
+		return nil
+	}
+	message := fmt.Sprintf("invalid %s: %s", v[0].Field, v[0].Description)
+	if len(v) > 1 {
+		message = fmt.Sprintf("%s (and %d more)", message, len(v)-1)
+	}
+	return apperr.InvalidArgument(message, v...)
+}
+
+// RequireID checks that value is a non-empty identifier.
+func (v *Violations) RequireID(field, value string) {
+	if value == "" {
+		v.Add(field, "is required")
+		return
+	}
+	v.OptionalID(field, value)
+}
+
+// OptionalID checks that value, if set, is a well-formed identifier.
+func (v *Violations) OptionalID(field, value string) {
+	if value == "" {
+		return
+	}
+	if len(value) > maxIDLength {
+		v.Add(field, fmt.Sprintf("must be at most %d characters", maxIDLength))
+		return
+	}
+	if !idPattern.MatchString(value) {
+		v.Add(field, "may only contain letters, digits, '-' and '_'")
+	}
+}
+
+// RequireOrderID checks that value is an order ID issued by this service.
+func (v *Violations) RequireOrderID(field, value string) {
+	if value == "" {
+		v.Add(field, "is required")
+		return
+	}
+	if !orderIDPattern.MatchString(value) {
+		v.Add(field, "is not a valid order ID")
+	}
+}
+
+// RequireCouponCode checks that value is a well-formed coupon code.
+func (v *Violations) RequireCouponCode(field, value string) {
+	if value == "" {
+		v.Add(field, "is required")
+		return
+	}
+	if len(value) > maxCouponCodeLength {
+		v.Add(field, fmt.Sprintf("must be at most %d characters", maxCouponCodeLength))
+		return
+	}
+	if !idPattern.MatchString(value) {
+		v.Add(field, "may only contain letters, digits, '-' and '_'")
+	}
+}
+
+// Quantity checks that value is a valid cart line quantity.
+func (v *Violations) Quantity(field string, value int32) {
+	if value < 1 || value > MaxQuantityPerLine {
+		v.Add(field, fmt.Sprintf("must be between 1 and %d", MaxQuantityPerLine))
+	}
+}
+
+// RequireStatus checks that value is a known order status.
+func (v *Violations) RequireStatus(field, value string) {
+	if value == "" {
+		v.Add(field, "is required")
+		return
+	}
+	v.OptionalStatus(field, value)
+}
+
+// OptionalStatus checks that value, if set, is a known order status.
+func (v *Violations) OptionalStatus(field, value string) {
+	if value == "" {
+		return
+	}
+	if _, err := orderstate.Parse(value); err != nil {
+		v.Add(field, "is not a known order status")
+	}
+}
+
+// MaxLength checks that value has at most max characters.
+func (v *Violations) MaxLength(field, value string, max int) {
+	if utf8.RuneCountInString(value) > max {
+		v.Add(field, fmt.Sprintf("must be at most %d characters", max))
+	}
+}
+
+// Note checks that value is free text of at most max characters without
+// control characters other than line breaks.
+func (v *Violations) Note(field, value string, max int) {
+	if !utf8.ValidString(value) {
+		v.Add(field, "must be valid UTF-8 text")
+		return
+	}
+	if utf8.RuneCountInString(value) > max {
+		v.Add(field, fmt.Sprintf("must be at most %d characters", max))
+		return
+	}
+	for _, r := range value {
+		if unicode.IsControl(r) && r != '\n' {
+			v.Add(field, "must not contain control characters")
+			return
+		}
+	}
+}
+
+// DateRange checks that the optional start and end dates are RFC 3339
+// timestamps or YYYY-MM-DD dates, and that start is not after end.
+func (v *Violations) DateRange(startField, start, endField, end string) {
+	startTime, startOK := v.date(startField, start)
+	endTime, endOK := v.date(endField, end)
+	if startOK && endOK && startTime.After(endTime) {
+		v.Add(startField, "must not be after "+endField)
+	}
+}
+
+func (v *Violations) date(field, value string) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, false
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, true
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, true
+	}
+	v.Add(field, "must be an RFC 3339 timestamp or a YYYY-MM-DD date")
+	return time.Time{}, false
+}
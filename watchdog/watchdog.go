@@ -0,0 +1,132 @@
+package watchdog
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/liju-github/FoodBuddyMicroserviceOrderCart/repository"
+)
+
+const defaultBatchSize = 100
+
+const (
+	// cancelReason is recorded on orders cancelled by the watchdog and
+	// cancelMessage is sent to their users.
+	cancelReason  = "not accepted by the restaurant in time"
+	cancelMessage = "Your order was cancelled because the restaurant did not accept it in time. Any payment taken will be returned."
+)
+
+// Watchdog cancels pending orders that their restaurant did not accept within
+// the acceptance window, so that users are not left waiting forever. Every
+// replica may run one; each order is cancelled by a single replica.
+type Watchdog struct {
+	repo      repository.OrderCartRepository
+	window    time.Duration
+	overrides map[string]time.Duration
+	interval  time.Duration
+	batchSize int
+}
+
+// NewWatchdog returns a Watchdog that cancels orders pending for longer than
+// window, or the window in overrides for their restaurant, checking every
+// interval.
+func NewWatchdog(repo repository.OrderCartRepository, window time.Duration, overrides map[string]time.Duration, interval time.Duration) *Watchdog {
+	return &Watchdog{
+		repo:      repo,
+		window:    window,
+		overrides: overrides,
+		interval:  interval,
+		batchSize: defaultBatchSize,
+	}
+}
+
+// ParseOverrides parses per-restaurant acceptance windows given as a comma
+// separated list of restaurantID:duration pairs, e.g. "rest1:5m,rest2:30m".
+func ParseOverrides(value string) (map[string]time.Duration, error) {
+	overrides := make(map[string]time.Duration)
+	for _, pair := range strings.Split(value, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		restaurantID, window, ok := strings.Cut(pair, ":")
+		restaurantID, window = strings.TrimSpace(restaurantID), strings.TrimSpace(window)
+		if !ok || restaurantID == "" || window == "" {
+			return nil, fmt.Errorf("invalid acceptance window %q: expected restaurantID:duration", pair)
+		}
+		d, err := time.ParseDuration(window)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid acceptance window %q", pair)
+		}
+		overrides[restaurantID] = d
+	}
+	return overrides, nil
+}
+
+// Run cancels expired orders every interval until ctx is cancelled.
+func (w *Watchdog) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.CancelExpired(ctx); err != nil {
+			log.Printf("Unaccepted order cancellation failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CancelExpired cancels every pending order whose acceptance window has
+// passed, a batch at a time, stopping early if ctx is cancelled. Orders held
+// by another replica are skipped and picked up on a later run if still
+// pending. An order that fails to be cancelled is skipped too, so that it
+// does not hold up the others, and tried again on the next run.
+func (w *Watchdog) CancelExpired(ctx context.Context) error {
+	var cancelled int
+	var failed []string
+	for ctx.Err() == nil {
+		now := time.Now()
+		overrides := make(map[string]time.Time, len(w.overrides))
+		for restaurantID, window := range w.overrides {
+			overrides[restaurantID] = now.Add(-window)
+		}
+
+		orderIDs, err := w.repo.FindUnacceptedOrders(now.Add(-w.window), overrides, failed, w.batchSize)
+		if err != nil {
+			return fmt.Errorf("failed to find unaccepted orders: %w", err)
+		}
+
+		var batch, batchFailed int
+		for _, orderID := range orderIDs {
+			expired, err := w.repo.ExpireUnacceptedOrder(orderID, cancelReason, cancelMessage)
+			if err != nil {
+				log.Printf("Failed to cancel unaccepted order %s: %v", orderID, err)
+				failed = append(failed, orderID)
+				batchFailed++
+				continue
+			}
+			if expired {
+				batch++
+			}
+		}
+		cancelled += batch
+
+		// A batch that cancelled nothing and had no failures to leave out is
+		// held by other replicas; finding it again would only spin
+		if len(orderIDs) < w.batchSize || (batch == 0 && batchFailed == 0) {
+			break
+		}
+	}
+
+	if cancelled > 0 || len(failed) > 0 {
+		log.Printf("Cancelled %d orders not accepted in time, %d failed", cancelled, len(failed))
+	}
+	return nil
+}